@@ -0,0 +1,671 @@
+package contagiongo
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/ksuid"
+)
+
+// abcConfig describes the fitting of configuration parameters to observed
+// data using Approximate Bayesian Computation (ABC). Parameters are drawn
+// from their priors, simulated, and accepted if the distance between the
+// simulated and observed summary statistics is within the tolerance.
+type abcConfig struct {
+	Method         string    `toml:"method"` // rejection, smc
+	NumParticles   int       `toml:"num_particles"`
+	Tolerance      float64   `toml:"tolerance"`       // only for rejection
+	Tolerances     []float64 `toml:"tolerances"`      // only for smc, one per round
+	MaxSimulations int       `toml:"max_simulations"` // per round, unlimited if 0
+	OutputPath     string    `toml:"output_path"`
+
+	Priors     []*abcPriorConfig     `toml:"prior"`
+	Statistics []*abcStatisticConfig `toml:"statistic"`
+
+	validated bool
+}
+
+// Validate checks the validity of the ABC configuration.
+func (c *abcConfig) Validate() error {
+	err := checkKeyword(c.Method, "ABC method", "rejection", "smc")
+	if err != nil {
+		return err
+	}
+	if c.NumParticles < 1 {
+		return fmt.Errorf(InvalidIntParameterError, "num_particles", c.NumParticles, "must be greater than or equal to 1")
+	}
+	switch strings.ToLower(c.Method) {
+	case "rejection":
+		if c.Tolerance <= 0 {
+			return fmt.Errorf(InvalidFloatParameterError, "tolerance", c.Tolerance, "must be greater than 0")
+		}
+	case "smc":
+		if len(c.Tolerances) == 0 {
+			return fmt.Errorf("ABC-SMC requires at least one tolerance")
+		}
+		for i, tol := range c.Tolerances {
+			if tol <= 0 {
+				return fmt.Errorf(InvalidFloatParameterError, "tolerance", tol, "must be greater than 0")
+			}
+			if i > 0 && tol >= c.Tolerances[i-1] {
+				return fmt.Errorf(InvalidFloatParameterError, "tolerance", tol, "must be less than the tolerance of the previous round")
+			}
+		}
+	}
+	if c.MaxSimulations < 0 {
+		return fmt.Errorf(InvalidIntParameterError, "max_simulations", c.MaxSimulations, "must be greater than or equal to 0")
+	}
+	if len(c.OutputPath) == 0 {
+		return fmt.Errorf(InvalidStringParameterError, "output_path", "\"\"", "ABC output path cannot be empty")
+	}
+	if len(c.Priors) == 0 {
+		return fmt.Errorf("ABC has no priors")
+	}
+	for _, p := range c.Priors {
+		err := p.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if len(c.Statistics) == 0 {
+		return fmt.Errorf("ABC has no summary statistics")
+	}
+	for _, s := range c.Statistics {
+		err := s.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	c.validated = true
+	return nil
+}
+
+// abcPriorConfig describes the prior distribution of a configuration
+// field being fitted.
+type abcPriorConfig struct {
+	Section      string  `toml:"section"`    // simulation, intrahost_model, transmission_model
+	ModelName    string  `toml:"model_name"` // only for intrahost_model and transmission_model, all models if empty
+	Field        string  `toml:"field"`
+	Distribution string  `toml:"distribution"` // uniform, loguniform, normal
+	Min          float64 `toml:"min"`          // only for uniform and loguniform
+	Max          float64 `toml:"max"`          // only for uniform and loguniform
+	Mean         float64 `toml:"mean"`         // only for normal
+	SD           float64 `toml:"sd"`           // only for normal
+
+	// integer indicates that the field is an integer so drawn values
+	// are rounded
+	integer   bool
+	validated bool
+}
+
+// Validate checks the validity of the prior.
+func (c *abcPriorConfig) Validate() error {
+	err := checkKeyword(c.Section, "prior section", "simulation", "intrahost_model", "transmission_model")
+	if err != nil {
+		return err
+	}
+	if len(c.Field) == 0 {
+		return fmt.Errorf(InvalidStringParameterError, "field", "\"\"", "field name cannot be empty")
+	}
+	err = checkKeyword(c.Distribution, "prior distribution", "uniform", "loguniform", "normal")
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(c.Distribution) {
+	case "uniform":
+		if c.Min >= c.Max {
+			return fmt.Errorf(InvalidFloatParameterError, "min", c.Min, "must be less than max")
+		}
+	case "loguniform":
+		if c.Min <= 0 {
+			return fmt.Errorf(InvalidFloatParameterError, "min", c.Min, "must be greater than 0")
+		}
+		if c.Min >= c.Max {
+			return fmt.Errorf(InvalidFloatParameterError, "min", c.Min, "must be less than max")
+		}
+	case "normal":
+		if c.SD <= 0 {
+			return fmt.Errorf(InvalidFloatParameterError, "sd", c.SD, "must be greater than 0")
+		}
+	}
+	c.validated = true
+	return nil
+}
+
+// Name returns the label used for the parameter in the posterior sample.
+func (c *abcPriorConfig) Name() string {
+	return fieldLabel(c.Section, c.ModelName, c.Field)
+}
+
+// sample draws a value from the prior.
+func (c *abcPriorConfig) sample(r *rand.Rand) float64 {
+	var x float64
+	switch strings.ToLower(c.Distribution) {
+	case "loguniform":
+		x = math.Exp(math.Log(c.Min) + r.Float64()*(math.Log(c.Max)-math.Log(c.Min)))
+	case "normal":
+		x = c.Mean + c.SD*r.NormFloat64()
+	default:
+		x = c.Min + r.Float64()*(c.Max-c.Min)
+	}
+	return c.round(x)
+}
+
+// round rounds x to the nearest integer if the field is an integer.
+func (c *abcPriorConfig) round(x float64) float64 {
+	if c.integer {
+		return math.Round(x)
+	}
+	return x
+}
+
+// density returns the probability density of the prior at x.
+func (c *abcPriorConfig) density(x float64) float64 {
+	switch strings.ToLower(c.Distribution) {
+	case "uniform":
+		if x < c.Min || x > c.Max {
+			return 0
+		}
+		return 1 / (c.Max - c.Min)
+	case "loguniform":
+		if x < c.Min || x > c.Max {
+			return 0
+		}
+		return 1 / (x * (math.Log(c.Max) - math.Log(c.Min)))
+	case "normal":
+		return normalDensity(x, c.Mean, c.SD)
+	}
+	return 0
+}
+
+// abcStatisticConfig describes a summary statistic of the simulation
+// and its observed values at particular generations.
+type abcStatisticConfig struct {
+	Statistic   string    `toml:"statistic"` // prevalence, genotype_count, nucleotide_diversity, tree_size, tree_depth
+	Generations []int     `toml:"generations"`
+	Observed    []float64 `toml:"observed"`
+	Weight      float64   `toml:"weight"` // defaults to 1
+
+	validated bool
+}
+
+// Validate checks the validity of the summary statistic.
+func (c *abcStatisticConfig) Validate() error {
+	err := checkKeyword(c.Statistic, "summary statistic", "prevalence", "genotype_count", "nucleotide_diversity", "tree_size", "tree_depth")
+	if err != nil {
+		return err
+	}
+	if len(c.Generations) == 0 {
+		return fmt.Errorf("summary statistic %s has no generations", c.Statistic)
+	}
+	if len(c.Observed) != len(c.Generations) {
+		return fmt.Errorf(UnequalIntParameterError, "number of observed values", len(c.Generations), len(c.Observed))
+	}
+	for _, t := range c.Generations {
+		if t < 0 {
+			return fmt.Errorf(InvalidIntParameterError, "generation", t, "must be greater than or equal to 0")
+		}
+	}
+	if c.Weight < 0 {
+		return fmt.Errorf(InvalidFloatParameterError, "weight", c.Weight, "must be greater than or equal to 0")
+	}
+	// Assign default value
+	if c.Weight == 0 {
+		c.Weight = 1
+	}
+	c.validated = true
+	return nil
+}
+
+// compute returns the value of the statistic given the current state
+// of the simulation.
+func (c *abcStatisticConfig) compute(sim Epidemic) float64 {
+	switch strings.ToLower(c.Statistic) {
+	case "prevalence":
+		return Prevalence(sim)
+	case "genotype_count":
+		return float64(GenotypeCount(sim))
+	case "nucleotide_diversity":
+		return NucleotideDiversity(sim)
+	case "tree_size":
+		return float64(len(sim.GenotypeNodeMap()))
+	case "tree_depth":
+		return float64(TreeDepth(sim))
+	}
+	return 0
+}
+
+// Prevalence returns the proportion of hosts carrying at least
+// one pathogen.
+func Prevalence(sim Epidemic) float64 {
+	hosts := sim.HostMap()
+	if len(hosts) == 0 {
+		return 0
+	}
+	var infected int
+	for _, host := range hosts {
+		if host.PathogenPopSize() > 0 {
+			infected++
+		}
+	}
+	return float64(infected) / float64(len(hosts))
+}
+
+// genotypeCounts returns the number of pathogens carrying each genotype
+// across all hosts.
+func genotypeCounts(sim Epidemic) map[ksuid.KSUID]int {
+	counts := make(map[ksuid.KSUID]int)
+	for _, host := range sim.HostMap() {
+		for _, node := range host.Pathogens() {
+			counts[node.GenotypeUID()]++
+		}
+	}
+	return counts
+}
+
+// GenotypeCount returns the number of unique genotypes among the
+// pathogens of all hosts.
+func GenotypeCount(sim Epidemic) int {
+	return len(genotypeCounts(sim))
+}
+
+// NucleotideDiversity returns the average number of differences per site
+// between two pathogens sampled from all hosts without replacement.
+func NucleotideDiversity(sim Epidemic) float64 {
+	counts := make(map[ksuid.KSUID]int)
+	sequences := make(map[ksuid.KSUID][]uint8)
+	var n int
+	for _, host := range sim.HostMap() {
+		for _, node := range host.Pathogens() {
+			uid := node.GenotypeUID()
+			if counts[uid] == 0 {
+				sequences[uid] = node.Sequence()
+			}
+			counts[uid]++
+			n++
+		}
+	}
+	if n < 2 {
+		return 0
+	}
+	var numSites int
+	for _, sequence := range sequences {
+		numSites = len(sequence)
+		break
+	}
+	if numSites == 0 {
+		return 0
+	}
+	// Sum the expected heterozygosity of each site
+	var total float64
+	for pos := 0; pos < numSites; pos++ {
+		states := make(map[uint8]int)
+		for uid, sequence := range sequences {
+			states[sequence[pos]] += counts[uid]
+		}
+		var homozygosity float64
+		for _, count := range states {
+			p := float64(count) / float64(n)
+			homozygosity += p * p
+		}
+		total += (1 - homozygosity) * float64(n) / float64(n-1)
+	}
+	return total / float64(numSites)
+}
+
+// TreeDepth returns the largest number of ancestors between a genotype
+// node and a root of the genotype tree.
+func TreeDepth(sim Epidemic) int {
+	depths := make(map[ksuid.KSUID]int)
+	var depth func(node GenotypeNode) int
+	depth = func(node GenotypeNode) int {
+		if d, exists := depths[node.UID()]; exists {
+			return d
+		}
+		var d int
+		for _, parent := range node.Parents() {
+			if pd := depth(parent) + 1; pd > d {
+				d = pd
+			}
+		}
+		depths[node.UID()] = d
+		return d
+	}
+	var maxDepth int
+	for _, node := range sim.GenotypeNodeMap() {
+		if d := depth(node); d > maxDepth {
+			maxDepth = d
+		}
+	}
+	return maxDepth
+}
+
+// ABCParticle is a set of parameter values accepted during ABC fitting.
+type ABCParticle struct {
+	Values   []float64
+	Weight   float64
+	Distance float64
+}
+
+// ABCSimulator runs a simulation using the given parameter values and seed
+// and returns the summary statistics computed using SummaryStatistics.
+type ABCSimulator func(values []float64, seed int64) ([]float64, error)
+
+// ABCParameterNames returns the labels of the fitted parameters in the
+// order of the values in each ABCParticle.
+func (c *EvoEpiConfig) ABCParameterNames() []string {
+	if c.ABC == nil {
+		return nil
+	}
+	names := make([]string, len(c.ABC.Priors))
+	for i, p := range c.ABC.Priors {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// ApplyABCValues sets the fitted parameters of the configuration to the
+// given values in the order of the priors.
+func (c *EvoEpiConfig) ApplyABCValues(values []float64) error {
+	if c.ABC == nil {
+		return fmt.Errorf("configuration has no abc section")
+	}
+	if len(values) != len(c.ABC.Priors) {
+		return fmt.Errorf(UnequalIntParameterError, "number of parameter values", len(c.ABC.Priors), len(values))
+	}
+	for i, p := range c.ABC.Priors {
+		err := c.SetField(p.Section, p.ModelName, p.Field, values[i])
+		if err != nil {
+			return errors.Wrap(err, "applying ABC parameters failed")
+		}
+	}
+	return nil
+}
+
+// SummaryStatistics runs a newly created simulation to the end without
+// printing progress and returns the summary statistics in the abc section,
+// ordered by statistic and generation. If the simulation stops before a
+// particular generation, the statistic is computed at the last generation.
+// Each generation runs the same steps as a regular run, including
+// interventions and changes to the host population.
+func (c *EvoEpiConfig) SummaryStatistics(sim EpidemicSimulation) []float64 {
+	stats := c.ABC.Statistics
+	values := make([][]float64, len(stats))
+	observed := make([][]bool, len(stats))
+	for j, s := range stats {
+		values[j] = make([]float64, len(s.Generations))
+		observed[j] = make([]bool, len(s.Generations))
+	}
+	observe := func(t int) {
+		for j, s := range stats {
+			for k, g := range s.Generations {
+				if g == t {
+					values[j][k] = s.compute(sim)
+					observed[j][k] = true
+				}
+			}
+		}
+	}
+	sim.Initialize()
+	sim.Update(0)
+	observe(0)
+	for sim.Time() < sim.NumGenerations() && !sim.Stopped() {
+		t := sim.Time() + 1
+		stepEpidemic(sim, t)
+		observe(t)
+	}
+	sim.Finalize()
+	var summary []float64
+	for j, s := range stats {
+		for k := range s.Generations {
+			if !observed[j][k] {
+				values[j][k] = s.compute(sim)
+			}
+			summary = append(summary, values[j][k])
+		}
+	}
+	return summary
+}
+
+// distance returns the weighted Euclidean distance between the
+// simulated and observed summary statistics.
+func (c *abcConfig) distance(summary []float64) float64 {
+	var sum float64
+	var i int
+	for _, s := range c.Statistics {
+		for _, obs := range s.Observed {
+			d := summary[i] - obs
+			sum += s.Weight * d * d
+			i++
+		}
+	}
+	return math.Sqrt(sum)
+}
+
+// RunABC fits the parameters declared in the abc section. The rejection
+// method draws parameters from the priors until enough particles are
+// accepted. The smc method (ABC-SMC) runs one rejection round per
+// tolerance, where later rounds draw parameters by perturbing the
+// particles accepted in the previous round. Proposals are simulated in
+// batches of numWorkers, but particles are accepted in the order they were
+// proposed so that results only depend on the seed.
+func (c *EvoEpiConfig) RunABC(seed int64, numWorkers int, simulate ABCSimulator) ([]*ABCParticle, error) {
+	if c.ABC == nil {
+		return nil, fmt.Errorf("configuration has no abc section")
+	}
+	if !c.ABC.validated {
+		err := c.ABC.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if numWorkers < 1 {
+		return nil, fmt.Errorf(InvalidIntParameterError, "number of workers", numWorkers, "must be greater than or equal to 1")
+	}
+	for _, p := range c.ABC.Priors {
+		kind, err := c.fieldKind(p.Section, p.ModelName, p.Field)
+		if err != nil {
+			return nil, err
+		}
+		p.integer = kind == reflect.Int
+	}
+	tolerances := []float64{c.ABC.Tolerance}
+	if strings.ToLower(c.ABC.Method) == "smc" {
+		tolerances = c.ABC.Tolerances
+	}
+	var particles []*ABCParticle
+	for round, tolerance := range tolerances {
+		var err error
+		particles, err = c.ABC.runRound(round, tolerance, particles, seed, numWorkers, simulate)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ABC round %d failed", round+1)
+		}
+	}
+	return particles, nil
+}
+
+// runRound accepts particles whose distance is within the tolerance.
+// Parameters are drawn from the priors if there are no previous particles.
+// Proposals whose simulation failed are rejected. The round only fails if
+// every simulation failed, either after as many simulations as particles
+// or when the maximum number of simulations is reached.
+func (c *abcConfig) runRound(round int, tolerance float64, prev []*ABCParticle, seed int64, numWorkers int, simulate ABCSimulator) ([]*ABCParticle, error) {
+	// Perturbation kernel scale is twice the weighted variance of the
+	// previous particles (Beaumont et al. 2009)
+	var scales []float64
+	if prev != nil {
+		scales = make([]float64, len(c.Priors))
+		for j := range c.Priors {
+			var mean, variance float64
+			for _, p := range prev {
+				mean += p.Weight * p.Values[j]
+			}
+			for _, p := range prev {
+				variance += p.Weight * (p.Values[j] - mean) * (p.Values[j] - mean)
+			}
+			scales[j] = math.Sqrt(2 * variance)
+		}
+	}
+	propose := func(k int) ([]float64, int64) {
+		r := NewRand(DeriveSeed(seed, round, k))
+		values := make([]float64, len(c.Priors))
+		if prev == nil {
+			for j, p := range c.Priors {
+				values[j] = p.sample(r)
+			}
+			return values, r.Int63()
+		}
+		// Perturb a particle picked according to its weight until the
+		// perturbed values are allowed by the priors
+		for {
+			u := r.Float64()
+			picked := prev[len(prev)-1]
+			for _, p := range prev {
+				if u < p.Weight {
+					picked = p
+					break
+				}
+				u -= p.Weight
+			}
+			density := 1.0
+			for j, p := range c.Priors {
+				values[j] = p.round(picked.Values[j] + scales[j]*r.NormFloat64())
+				density *= p.density(values[j])
+			}
+			if density > 0 {
+				return values, r.Int63()
+			}
+		}
+	}
+
+	type proposal struct {
+		values   []float64
+		distance float64
+		err      error
+	}
+	var particles []*ABCParticle
+	var numSimulations, numFailed int
+	var lastErr error
+	for len(particles) < c.NumParticles {
+		if numFailed > 0 && numFailed == numSimulations && numSimulations >= c.NumParticles {
+			return nil, errors.Wrapf(lastErr, "all %d simulations failed", numSimulations)
+		}
+		batch := make([]proposal, numWorkers)
+		if c.MaxSimulations > 0 && numSimulations+numWorkers > c.MaxSimulations {
+			batch = batch[:c.MaxSimulations-numSimulations]
+		}
+		if len(batch) == 0 {
+			if numFailed > 0 && numFailed == numSimulations {
+				return nil, errors.Wrapf(lastErr, "all %d simulations failed", numSimulations)
+			}
+			return nil, fmt.Errorf("accepted %d of %d particles after %d simulations, tolerance %f may be too small", len(particles), c.NumParticles, numSimulations, tolerance)
+		}
+		var wg sync.WaitGroup
+		for b := range batch {
+			wg.Add(1)
+			go func(b int) {
+				defer wg.Done()
+				values, simSeed := propose(numSimulations + b)
+				summary, err := simulate(values, simSeed)
+				if err != nil {
+					batch[b] = proposal{err: err}
+					return
+				}
+				batch[b] = proposal{values: values, distance: c.distance(summary)}
+			}(b)
+		}
+		wg.Wait()
+		for _, p := range batch {
+			numSimulations++
+			if p.err != nil {
+				numFailed++
+				lastErr = p.err
+				fmt.Printf(" abc round %d\tsimulation %d failed: %s\n", round+1, numSimulations, p.err)
+				continue
+			}
+			if p.distance <= tolerance {
+				particles = append(particles, &ABCParticle{Values: p.values, Distance: p.distance})
+				if len(particles) == c.NumParticles {
+					break
+				}
+			}
+		}
+	}
+	fmt.Printf(" abc round %d\ttolerance %f\taccepted %d of %d simulations\t%d failed\n", round+1, tolerance, len(particles), numSimulations, numFailed)
+
+	// Compute importance weights and normalize
+	var total float64
+	for _, particle := range particles {
+		particle.Weight = 1
+		if prev != nil {
+			prior := 1.0
+			for j, p := range c.Priors {
+				prior *= p.density(particle.Values[j])
+			}
+			var kernel float64
+			for _, p := range prev {
+				k := p.Weight
+				for j := range c.Priors {
+					k *= perturbationDensity(particle.Values[j], p.Values[j], scales[j])
+				}
+				kernel += k
+			}
+			particle.Weight = prior / kernel
+		}
+		total += particle.Weight
+	}
+	for _, particle := range particles {
+		particle.Weight /= total
+	}
+	return particles, nil
+}
+
+// normalDensity returns the probability density of the normal
+// distribution at x.
+func normalDensity(x, mean, sd float64) float64 {
+	z := (x - mean) / sd
+	return math.Exp(-z*z/2) / (sd * math.Sqrt(2*math.Pi))
+}
+
+// perturbationDensity returns the density of perturbing x0 into x using
+// a normal kernel. A kernel with zero scale leaves values unchanged.
+func perturbationDensity(x, x0, scale float64) float64 {
+	if scale == 0 {
+		if x == x0 {
+			return 1
+		}
+		return 0
+	}
+	return normalDensity(x, x0, scale)
+}
+
+// WriteABCPosterior writes the accepted particles and their weights
+// to a CSV file.
+func WriteABCPosterior(path string, names []string, particles []*ABCParticle) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(FileWriteError(err), "writing ABC posterior failed")
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "particle,weight,distance,%s\n", strings.Join(names, ","))
+	for i, p := range particles {
+		values := make([]string, len(p.Values))
+		for j, v := range p.Values {
+			values[j] = fmt.Sprintf("%v", v)
+		}
+		fmt.Fprintf(w, "%d,%v,%v,%s\n", i+1, p.Weight, p.Distance, strings.Join(values, ","))
+	}
+	err = w.Flush()
+	if err != nil {
+		return errors.Wrap(FileWriteError(err), "writing ABC posterior failed")
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package contagiongo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestABCPriorConfig_Sample(t *testing.T) {
+	r := NewRand(1)
+	priors := []*abcPriorConfig{
+		{Section: "transmission_model", Field: "transmission_prob", Distribution: "uniform", Min: 0.2, Max: 0.4},
+		{Section: "intrahost_model", Field: "mutation_rate", Distribution: "loguniform", Min: 1e-6, Max: 1e-3},
+		{Section: "intrahost_model", Field: "constant_pop_size", Distribution: "uniform", Min: 10, Max: 20, integer: true},
+	}
+	for _, p := range priors {
+		err := p.Validate()
+		if err != nil {
+			t.Fatalf(UnexpectedErrorWhileError, "validating prior", err)
+		}
+		for i := 0; i < 100; i++ {
+			x := p.sample(r)
+			if x < p.Min || x > p.Max {
+				t.Errorf(FloatNotBetweenError, p.Field, p.Min, p.Max, x)
+			}
+			if p.density(x) <= 0 {
+				t.Errorf("expected positive prior density of %s at %f", p.Field, x)
+			}
+			if p.integer && x != math.Round(x) {
+				t.Errorf("expected integer %s, got %f instead", p.Field, x)
+			}
+		}
+	}
+}
+
+func TestABCConfig_Distance(t *testing.T) {
+	c := &abcConfig{
+		Statistics: []*abcStatisticConfig{
+			{Statistic: "prevalence", Generations: []int{1, 2}, Observed: []float64{0.5, 0.5}, Weight: 1},
+			{Statistic: "tree_size", Generations: []int{2}, Observed: []float64{10}, Weight: 4},
+		},
+	}
+	expected := 5.0 // sqrt(3^2 + 0^2 + 4 * 2^2)
+	if d := c.distance([]float64{3.5, 0.5, 12}); math.Abs(d-expected) > 1e-9 {
+		t.Errorf(UnequalFloatParameterError, "distance", expected, d)
+	}
+}
+
+func TestABCConfig_RunRoundFailures(t *testing.T) {
+	c := &abcConfig{
+		Method:       "rejection",
+		NumParticles: 5,
+		Tolerance:    1,
+		OutputPath:   "posterior.csv",
+		Priors: []*abcPriorConfig{
+			{Section: "transmission_model", Field: "transmission_prob", Distribution: "uniform", Min: 0, Max: 1},
+		},
+		Statistics: []*abcStatisticConfig{
+			{Statistic: "prevalence", Generations: []int{1}, Observed: []float64{0}, Weight: 1},
+		},
+	}
+	err := c.Validate()
+	if err != nil {
+		t.Fatalf(UnexpectedErrorWhileError, "validating ABC configuration", err)
+	}
+	// Proposals with failed simulations are rejected
+	simulate := func(values []float64, seed int64) ([]float64, error) {
+		if values[0] < 0.5 {
+			return nil, fmt.Errorf("simulation failed")
+		}
+		return values, nil
+	}
+	particles, err := c.runRound(0, c.Tolerance, nil, 1, 2, simulate)
+	if err != nil {
+		t.Fatalf(UnexpectedErrorWhileError, "running ABC round", err)
+	}
+	if len(particles) != c.NumParticles {
+		t.Errorf(UnequalIntParameterError, "number of particles", c.NumParticles, len(particles))
+	}
+	var numFailed int
+	for _, p := range particles {
+		if p.Values[0] < 0.5 {
+			numFailed++
+		}
+	}
+	if numFailed > 0 {
+		t.Errorf("expected no particles from failed simulations, got %d", numFailed)
+	}
+	// The round fails only if every simulation fails
+	fail := func(values []float64, seed int64) ([]float64, error) {
+		return nil, fmt.Errorf("simulation failed")
+	}
+	_, err = c.runRound(0, c.Tolerance, nil, 1, 2, fail)
+	if err == nil {
+		t.Errorf("expected an error if every simulation fails")
+	}
+}
+
+func TestEvoEpiConfig_SummaryStatisticsIntervention(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "abc")
+	if err != nil {
+		t.Fatalf(UnexpectedErrorWhileError, "creating temporary directory", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	conf := loadTestConfig(t, tmpDir, `
+[[intervention]]
+action = "vaccinate"
+generation = 3
+num_hosts = 4
+host_ids = [5,6,7,8]
+`)
+	conf.ABC = &abcConfig{
+		Statistics: []*abcStatisticConfig{
+			{Statistic: "prevalence", Generations: []int{2, 5}, Observed: []float64{0, 0}},
+		},
+	}
+	sim := newTestSimulation(t, conf, &NullLogger{}, 1)
+	if n := countStatus(sim, VaccinatedStatusCode); n != 0 {
+		t.Fatalf(UnequalIntParameterError, "number of vaccinated hosts before the run", 0, n)
+	}
+	conf.SummaryStatistics(sim)
+	// Hosts far from the first infection are still susceptible when
+	// vaccinated and stay vaccinated until the end
+	if n := countStatus(sim, VaccinatedStatusCode); n == 0 {
+		t.Errorf("expected vaccinated hosts after running the scheduled vaccination, got none")
+	}
+	if sim.Time() != sim.NumGenerations() {
+		t.Errorf(UnequalIntParameterError, "last generation", sim.NumGenerations(), sim.Time())
+	}
+}
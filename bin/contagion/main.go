@@ -1,11 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
-	"math/rand"
+	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	contagion "github.com/kentwait/contagiongo"
@@ -15,18 +19,63 @@ func main() {
 	numCPUPtr := flag.Int("threads", runtime.NumCPU(), "number of CPU threads")
 	loggerTypePtr := flag.String("logger", "csv", "data logger type (csv|sqlite)")
 	// quietPtr := flag.Bool("quiet", true, "completely supress feedback")
-	seedNumPtr := flag.Int64("seed", time.Now().UTC().UnixNano(), "random seed. Uses Unix time in nanoseconds as default")
+	parallelPtr := flag.Int("parallel-instances", 1, "number of simulation instances to run at the same time")
+	resumePtr := flag.String("resume", "", "continue the simulation from the specified checkpoint file. Other instances with checkpoints are also continued and instances that have not started are run")
+	seedNumPtr := flag.Int64("seed", time.Now().UTC().UnixNano(), "random seed. Each instance uses a seed derived from this value. Uses Unix time in nanoseconds as default")
 	// benchmarkPtr := flag.String("benchmark", "", "Benchmark mode. Logs memory and wall time and saves to the specified path")
 	flag.Parse()
-	// Set random number
-	rand.Seed(*seedNumPtr)
 	// Set number of CPUs to be used
 	runtime.GOMAXPROCS(*numCPUPtr)
 
+	if *parallelPtr < 1 {
+		log.Fatalf("invalid number of parallel instances %d, must be greater than or equal to 1", *parallelPtr)
+	}
+
 	// Create a new logger
 	// l := log.New(os.Stdout, "", log.LstdFlags)
+	// Run a parameter sweep if the sweep subcommand is given
+	if flag.Arg(0) == "sweep" {
+		if *resumePtr != "" {
+			log.Fatal("resuming from a checkpoint is not supported in sweep mode")
+		}
+		runSweep(flag.Arg(1), *loggerTypePtr, *seedNumPtr, *parallelPtr)
+		return
+	}
+	// Generate or describe a host network if the network subcommand is given
+	if flag.Arg(0) == "network" {
+		switch flag.Arg(1) {
+		case "generate":
+			generateNetwork(flag.Arg(2), flag.Arg(3))
+		case "stats":
+			networkStats(flag.Arg(2))
+		default:
+			log.Fatalf("%s is not a valid network command (generate|stats)", flag.Arg(1))
+		}
+		return
+	}
+	// Fit parameters if the abc subcommand is given
+	if flag.Arg(0) == "abc" {
+		if *resumePtr != "" {
+			log.Fatal("resuming from a checkpoint is not supported in abc mode")
+		}
+		runABC(flag.Arg(1), *seedNumPtr, *parallelPtr)
+		return
+	}
 	// Load config file
 	configPath := flag.Arg(0)
+	var cp *contagion.Checkpoint
+	if *resumePtr != "" {
+		var err error
+		cp, err = contagion.LoadCheckpoint(*resumePtr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Use the configuration of the checkpointed simulation
+		// if none is given
+		if configPath == "" {
+			configPath = cp.ConfigPath
+		}
+	}
 	conf, err := contagion.LoadEvoEpiConfig(configPath)
 	if err != nil {
 		log.Fatal(err)
@@ -36,43 +85,324 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	if conf.Sweep != nil {
+		log.Fatalf("%s declares a parameter sweep, use the sweep subcommand to run it", configPath)
+	}
 	firstStart := time.Now()
+	seed := *seedNumPtr
+	instanceIDs := allInstances(conf)
+	var checkpoints map[int]*contagion.Checkpoint
+	if *resumePtr != "" {
+		// Instances that have not started must use the same seeds as
+		// in the interrupted run
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "seed" && *seedNumPtr != cp.MasterSeed {
+				log.Fatalf("checkpoint was created using seed %d, cannot resume using seed %d", cp.MasterSeed, *seedNumPtr)
+			}
+		})
+		seed = cp.MasterSeed
+		instanceIDs, checkpoints, err = resumeInstances(conf, cp)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	runInstances(conf, *loggerTypePtr, seed, *parallelPtr, instanceIDs, checkpoints)
+	log.Printf("Completed all runs in %s.", time.Since(firstStart))
+}
+
+// allInstances returns the IDs of all instances in the configuration.
+func allInstances(conf *contagion.EvoEpiConfig) []int {
+	instanceIDs := make([]int, conf.NumInstances())
+	for i := range instanceIDs {
+		instanceIDs[i] = i + 1
+	}
+	return instanceIDs
+}
+
+// resumeInstances returns the instances that still have to be run after
+// an interrupted run and the checkpoints to continue them from. The given
+// checkpoint is used for its own instance while the checkpoints of the
+// other instances are read from the log path. Instances without a
+// checkpoint are run from the start and finished instances are skipped.
+func resumeInstances(conf *contagion.EvoEpiConfig, cp *contagion.Checkpoint) ([]int, map[int]*contagion.Checkpoint, error) {
+	var instanceIDs []int
+	checkpoints := make(map[int]*contagion.Checkpoint)
 	for i := 1; i <= conf.NumInstances(); i++ {
-		log.Printf("starting instance %03d\n", i)
+		instanceCp := cp
+		if i != cp.InstanceID {
+			path := contagion.CheckpointPath(conf.LogPath(), i)
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				instanceIDs = append(instanceIDs, i)
+				continue
+			}
+			var err error
+			instanceCp, err = contagion.LoadCheckpoint(path)
+			if err != nil {
+				return nil, nil, err
+			}
+			if instanceCp.MasterSeed != cp.MasterSeed {
+				return nil, nil, fmt.Errorf("checkpoint of instance %03d was created using seed %d instead of %d", i, instanceCp.MasterSeed, cp.MasterSeed)
+			}
+		}
+		if instanceCp.Finished {
+			log.Printf("instance %03d already finished\n", i)
+			continue
+		}
+		instanceIDs = append(instanceIDs, i)
+		checkpoints[i] = instanceCp
+	}
+	return instanceIDs, checkpoints, nil
+}
+
+// runInstances runs the given simulation instances using a fixed number of
+// workers. Instances that have a checkpoint continue from the saved
+// generation. Each worker creates its own simulation and logger, so only as
+// many simulations as there are workers are kept in memory at the same time.
+func runInstances(conf *contagion.EvoEpiConfig, loggerType string, seed int64, numWorkers int, instanceIDs []int, checkpoints map[int]*contagion.Checkpoint) {
+	instances := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range instances {
+				start := time.Now()
+				sim, err := newSimulation(conf, loggerType, seed, i)
+				if err != nil {
+					log.Fatalf("error creating a new simulation from the configuration file: %s", err)
+				}
+				if cp, ok := checkpoints[i]; ok {
+					log.Printf("resuming instance %03d from generation %d\n", i, cp.Generation)
+					err = cp.Restore(sim)
+					if err != nil {
+						log.Fatalf("error restoring simulation from checkpoint: %s", err)
+					}
+				} else {
+					log.Printf("starting instance %03d\n", i)
+				}
+				sim.Run(i)
+				log.Printf("Finished instance %03d in %s.\n\n", i, time.Since(start))
+			}
+		}()
+	}
+	for _, i := range instanceIDs {
+		instances <- i
+	}
+	close(instances)
+	wg.Wait()
+}
+
+// runSweep runs every point of the parameter sweep declared in the
+// configuration file. Each point is run with its own log directory and
+// a master seed derived from the given seed and the run ID.
+func runSweep(configPath, loggerType string, seed int64, numWorkers int) {
+	firstStart := time.Now()
+	conf, err := contagion.LoadEvoEpiConfig(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = conf.Validate()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if conf.Sweep == nil {
+		log.Fatalf("%s has no sweep section", configPath)
+	}
+	points, err := conf.SweepPoints(seed)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.MkdirAll(conf.Sweep.LogPath, 0755)
+	if err != nil {
+		log.Fatal(err)
+	}
+	manifestPath := filepath.Join(conf.Sweep.LogPath, "manifest.csv")
+	err = contagion.WriteSweepManifest(manifestPath, conf.SweepParameterNames(), points)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d sweep runs to %s\n", len(points), manifestPath)
+	for _, point := range points {
+		// Reload the configuration so that values assigned by validation
+		// in a previous run do not carry over
+		conf, err := contagion.LoadEvoEpiConfig(configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = conf.ApplySweepPoint(point)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = conf.Validate()
+		if err != nil {
+			log.Fatalf("error validating sweep run %04d: %s", point.RunID, err)
+		}
+		log.Printf("starting sweep run %04d\n", point.RunID)
 		start := time.Now()
-		// Create a new logger for every realization
-		var logger contagion.DataLogger
-		switch *loggerTypePtr {
-		case "csv":
-			logger = contagion.NewCSVLogger(conf.LogPath(), i)
-		case "sqlite":
-			logger = contagion.NewSQLiteLogger(conf.LogPath(), i)
-		default:
-			log.Fatalf("%s is not a valid logger type (csv|sqlite)", *loggerTypePtr)
-		}
-		// Create a new simulation based on the epidemic model
-		var sim contagion.EpidemicSimulation
-		switch conf.SimParams.EpidemicModel {
-		case "si":
-			sim, err = contagion.NewSISimulation(conf, logger)
-		case "sir":
-			sim, err = contagion.NewSIRSimulation(conf, logger)
-		case "sis":
-			sim, err = contagion.NewSISSimulation(conf, logger)
-		case "endtrans":
-			sim, err = contagion.NewEndTransSimulation(conf, logger)
-		case "exchange":
-			sim, err = contagion.NewExchangeSimulation(conf, logger)
-		default:
-			err = fmt.Errorf("epidemic model %s has not yet been implemented", conf.SimParams.EpidemicModel)
+		runInstances(conf, loggerType, contagion.DeriveSeed(seed, point.RunID), numWorkers, allInstances(conf), nil)
+		log.Printf("Finished sweep run %04d in %s.\n\n", point.RunID, time.Since(start))
+	}
+	log.Printf("Completed all sweep runs in %s.", time.Since(firstStart))
+}
+
+// runABC fits the parameters declared in the abc section of the
+// configuration file and writes the accepted particles to the output path.
+// Simulations do not write logs.
+func runABC(configPath string, seed int64, numWorkers int) {
+	start := time.Now()
+	conf, err := contagion.LoadEvoEpiConfig(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = conf.Validate()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if conf.ABC == nil {
+		log.Fatalf("%s has no abc section", configPath)
+	}
+	simulate := func(values []float64, seed int64) ([]float64, error) {
+		// Reload the configuration so that values assigned by validation
+		// in a previous simulation do not carry over
+		conf, err := contagion.LoadEvoEpiConfig(configPath)
+		if err != nil {
+			return nil, err
+		}
+		err = conf.ApplyABCValues(values)
+		if err != nil {
+			return nil, err
+		}
+		err = conf.Validate()
+		if err != nil {
+			return nil, err
 		}
+		sim, err := newEpidemicSimulation(conf, &contagion.NullLogger{})
 		if err != nil {
-			log.Fatalf("error creating a new simulation from the configuration file: %s", err)
+			return nil, err
 		}
-		sim.Run(i)
-		log.Printf("Finished instance %03d in %s.\n\n", i, time.Since(start))
+		sim.SetSeed(seed)
+		return conf.SummaryStatistics(sim), nil
 	}
-	log.Printf("Completed all runs in %s.", time.Since(firstStart))
+	particles, err := conf.RunABC(seed, numWorkers, simulate)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = contagion.WriteABCPosterior(conf.ABC.OutputPath, conf.ABCParameterNames(), particles)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d accepted particles to %s\n", len(particles), conf.ABC.OutputPath)
+	log.Printf("Completed fitting in %s.", time.Since(start))
+}
+
+// generateNetwork creates a random host network from the network section
+// of the configuration file and writes it to a file that can be used as
+// host_network_path. The file format is chosen from the file extension.
+func generateNetwork(configPath, outPath string) {
+	if configPath == "" || outPath == "" {
+		log.Fatal("usage: contagion network generate <config> <output path>")
+	}
+	conf, err := contagion.LoadEvoEpiConfig(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	network, err := conf.GenerateNetwork()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = contagion.WriteHostNetwork(outPath, "", network)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote network with %d connected hosts to %s\n", network.ConnectedPopSize(), outPath)
+}
+
+// networkStats prints the structure of a host network as JSON. The path
+// can be a configuration file or a host network file. Only configuration
+// files report hosts in host_popsize that have no connections.
+func networkStats(path string) {
+	if path == "" {
+		log.Fatal("usage: contagion network stats <config or network path>")
+	}
+	var network contagion.HostNetwork
+	var popSize int
+	var err error
+	if strings.ToLower(filepath.Ext(path)) == ".toml" {
+		conf, err := contagion.LoadEvoEpiConfig(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = conf.Validate()
+		if err != nil {
+			log.Fatal(err)
+		}
+		network, err = conf.HostNetwork()
+		if err != nil {
+			log.Fatal(err)
+		}
+		popSize = conf.SimParams.HostPopSize
+	} else {
+		network, err = contagion.LoadHostNetwork(path, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	b, err := json.MarshalIndent(contagion.ComputeNetworkStats(network, popSize), "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(b))
+}
+
+// newSimulation creates a new logger and a new simulation based on the
+// epidemic model for a particular realization. The seed of the realization
+// is derived from the master seed and the instance number.
+func newSimulation(conf *contagion.EvoEpiConfig, loggerType string, seed int64, i int) (contagion.EpidemicSimulation, error) {
+	// Create a new logger for every realization
+	var logger contagion.DataLogger
+	switch loggerType {
+	case "csv":
+		logger = contagion.NewCSVLogger(conf.LogPath(), i)
+	case "sqlite":
+		logger = contagion.NewSQLiteLogger(conf.LogPath(), i)
+	default:
+		log.Fatalf("%s is not a valid logger type (csv|sqlite)", loggerType)
+	}
+	sim, err := newEpidemicSimulation(conf, logger)
+	if err != nil {
+		return nil, err
+	}
+	sim.SetSeed(contagion.DeriveSeed(seed, i))
+	sim.SetMasterSeed(seed)
+	return sim, nil
+}
+
+// newEpidemicSimulation creates a new simulation based on the
+// epidemic model that writes to the given logger.
+func newEpidemicSimulation(conf *contagion.EvoEpiConfig, logger contagion.DataLogger) (contagion.EpidemicSimulation, error) {
+	switch conf.SimParams.EpidemicModel {
+	case "si":
+		return contagion.NewSISimulation(conf, logger)
+	case "sir":
+		return contagion.NewSIRSimulation(conf, logger)
+	case "sis":
+		return contagion.NewSISSimulation(conf, logger)
+	case "sirs":
+		return contagion.NewSIRSSimulation(conf, logger)
+	case "sei":
+		return contagion.NewSEISimulation(conf, logger)
+	case "seir":
+		return contagion.NewSEIRSimulation(conf, logger)
+	case "seirs":
+		return contagion.NewSEIRSSimulation(conf, logger)
+	case "endtrans":
+		return contagion.NewEndTransSimulation(conf, logger)
+	case "exchange":
+		return contagion.NewExchangeSimulation(conf, logger)
+	case "compartmental":
+		return contagion.NewCompartmentalSimulation(conf, logger)
+	}
+	return nil, fmt.Errorf("epidemic model %s has not yet been implemented", conf.SimParams.EpidemicModel)
 }
 
 // func logMemory(interval int) {
@@ -97,6 +97,8 @@ func main() {
 	tableNameMap["status"] = "Status"
 	tableNameMap["trans"] = "Transmission"
 	tableNameMap["tree"] = "Tree"
+	tableNameMap["intervention"] = "Intervention"
+	tableNameMap["demography"] = "Demography"
 	// Columns based on content type of CSV
 	columnNameMap := make(map[string]string)
 	columnNameMap["freq"] = "(id integer not null primary key, instance int, generation int, hostID int, genotypeID text, freq int)"
@@ -105,6 +107,8 @@ func main() {
 	columnNameMap["status"] = "(id integer not null primary key, instance int, generation int, hostID int, status int)"
 	columnNameMap["trans"] = "(id integer not null primary key, instance int, generation int, fromHostID int, toHostID int, nodeID text)"
 	columnNameMap["tree"] = "(id integer not null primary key, instance int, generation int, hostID int, parentNodeID text, nodeID text)"
+	columnNameMap["intervention"] = "(id integer not null primary key, instance int, generation int, interventionID int, action text, hostID int, value real)"
+	columnNameMap["demography"] = "(id integer not null primary key, instance int, generation int, hostID int, event text, status int)"
 	// Insert statement based on content type of CSV
 	insertStmtMap := make(map[string]string)
 	insertStmtMap["freq"] = "insert into %s (instance, generation, hostID, genotypeID, freq) values(?, ?, ?, ?, ?)"
@@ -113,6 +117,8 @@ func main() {
 	insertStmtMap["status"] = "insert into %s (instance, generation, hostID, status) values(?, ?, ?, ?)"
 	insertStmtMap["trans"] = "insert into %s (instance, generation, fromHostID, toHostID, nodeID) values(?, ?, ?, ?, ?)"
 	insertStmtMap["tree"] = "insert into %s (instance, generation, hostID, parentNodeID, nodeID) values(?, ?, ?, ?, ?)"
+	insertStmtMap["intervention"] = "insert into %s (instance, generation, interventionID, action, hostID, value) values(?, ?, ?, ?, ?, ?)"
+	insertStmtMap["demography"] = "insert into %s (instance, generation, hostID, event, status) values(?, ?, ?, ?, ?)"
 
 	// Path to folder with CSV files to process
 	// Accepts one or more args, each representing a folder path
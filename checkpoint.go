@@ -0,0 +1,278 @@
+package contagiongo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/ksuid"
+)
+
+// Checkpoint is a snapshot of a running simulation instance that can be
+// used to continue the simulation from the generation it was saved.
+type Checkpoint struct {
+	// ConfigPath is the path of the configuration file used to create
+	// the simulation.
+	ConfigPath string `json:"config_path"`
+	InstanceID int    `json:"instance_id"`
+	Generation int    `json:"generation"`
+	// Finished is true if the simulation instance ran until the last
+	// generation or until a stop condition was triggered.
+	Finished bool `json:"finished"`
+	// Seed is the seed of the simulation instance. Random number streams
+	// in each generation are derived from this seed.
+	Seed int64 `json:"seed"`
+	// MasterSeed is the seed that the seeds of all instances are derived
+	// from. Instances that have not started when resuming use seeds
+	// derived from this seed.
+	MasterSeed     int64                 `json:"master_seed"`
+	Statuses       map[int]int           `json:"statuses"`
+	Timers         map[int]int           `json:"timers"`
+	InfectionTimes map[int]int           `json:"infection_times"`
+	Nodes          []checkpointNode      `json:"nodes"`
+	Hosts          map[int][]ksuid.KSUID `json:"hosts"`
+	// ImmuneHistories are the epitopes remembered by each host.
+	ImmuneHistories map[int][]ImmuneMemory `json:"immune_histories"`
+	// Isolated are the hosts whose connections were removed
+	// by an intervention.
+	Isolated      []int               `json:"isolated"`
+	Interventions []InterventionState `json:"interventions"`
+	// NextHostID and Connections are only saved if hosts enter and
+	// leave the population.
+	NextHostID  int                    `json:"next_host_id,omitempty"`
+	Connections []checkpointConnection `json:"connections,omitempty"`
+}
+
+// checkpointConnection records a one way connection between two hosts.
+type checkpointConnection struct {
+	From   int     `json:"from"`
+	To     int     `json:"to"`
+	Weight float64 `json:"weight"`
+}
+
+// checkpointNode records a genotype node and its lineage.
+type checkpointNode struct {
+	UID      ksuid.KSUID   `json:"uid"`
+	Sequence []uint8       `json:"sequence"`
+	Subs     int           `json:"subs"`
+	Recombs  int           `json:"recombs"`
+	Parents  []ksuid.KSUID `json:"parents"`
+}
+
+// CheckpointPath returns the path of the checkpoint file of a particular
+// simulation instance. Follows the naming convention of the CSV logger.
+func CheckpointPath(basepath string, i int) string {
+	if info, err := os.Stat(basepath); err == nil && info.IsDir() {
+		basepath += "log"
+	}
+	return strings.TrimSuffix(basepath, ".") + fmt.Sprintf(".%03d.ckpt", i)
+}
+
+// NewCheckpoint creates a snapshot of the current state of the simulation.
+func NewCheckpoint(sim EpidemicSimulation) *Checkpoint {
+	cp := new(Checkpoint)
+	cp.ConfigPath = sim.ConfigPath()
+	cp.InstanceID = sim.InstanceID()
+	cp.Generation = sim.Time()
+	cp.Finished = sim.Stopped() || sim.Time() >= sim.NumGenerations()
+	cp.Seed = sim.Seed()
+	cp.MasterSeed = sim.MasterSeed()
+	cp.Statuses = make(map[int]int)
+	cp.Timers = make(map[int]int)
+	cp.InfectionTimes = make(map[int]int)
+	cp.Hosts = make(map[int][]ksuid.KSUID)
+	cp.ImmuneHistories = make(map[int][]ImmuneMemory)
+	for hostID, host := range sim.HostMap() {
+		cp.Statuses[hostID] = sim.HostStatus(hostID)
+		cp.Timers[hostID] = sim.HostTimer(hostID)
+		cp.InfectionTimes[hostID] = sim.InfectionTime(hostID)
+		if history := host.ImmuneHistory(); len(history) > 0 {
+			cp.ImmuneHistories[hostID] = history
+		}
+		pathogens := host.Pathogens()
+		uids := make([]ksuid.KSUID, len(pathogens))
+		for i, node := range pathogens {
+			uids[i] = node.UID()
+		}
+		cp.Hosts[hostID] = uids
+		if sim.HostIsolated(hostID) {
+			cp.Isolated = append(cp.Isolated, hostID)
+		}
+	}
+	sort.Ints(cp.Isolated)
+	for _, iv := range sim.Interventions() {
+		cp.Interventions = append(cp.Interventions, iv.State())
+	}
+	if d := sim.Demography(); d != nil {
+		cp.NextHostID = d.NextHostID
+		network := sim.HostNetwork()
+		for _, a := range sortedHostIDs(sim) {
+			neighbors := network.GetNeighbors(a)
+			sort.Ints(neighbors)
+			for _, b := range neighbors {
+				cp.Connections = append(cp.Connections, checkpointConnection{a, b, network.Connection(a, b)})
+			}
+		}
+	}
+	for uid, node := range sim.GenotypeNodeMap() {
+		n := checkpointNode{
+			UID:      uid,
+			Sequence: node.Sequence(),
+			Parents:  make([]ksuid.KSUID, len(node.Parents())),
+		}
+		if gn, ok := node.(*genotypeNode); ok {
+			n.Subs = gn.subs
+			n.Recombs = gn.recombs
+		}
+		for i, parent := range node.Parents() {
+			n.Parents[i] = parent.UID()
+		}
+		cp.Nodes = append(cp.Nodes, n)
+	}
+	return cp
+}
+
+// WriteCheckpoint saves the current state of the simulation to the given
+// path. The file is replaced atomically to avoid leaving a corrupted checkpoint
+// if the simulation is interrupted while saving.
+func WriteCheckpoint(sim EpidemicSimulation, path string) error {
+	cp := NewCheckpoint(sim)
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return errors.Wrap(err, "encoding checkpoint failed")
+	}
+	tmpPath := path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, b, 0644)
+	if err != nil {
+		return errors.Wrap(FileWriteError(err), "writing checkpoint failed")
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return errors.Wrap(FileWriteError(err), "writing checkpoint failed")
+	}
+	return nil
+}
+
+// LoadCheckpoint reads a checkpoint saved using WriteCheckpoint.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(FileOpenError(err), "loading checkpoint failed")
+	}
+	cp := new(Checkpoint)
+	err = json.Unmarshal(b, cp)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding checkpoint failed")
+	}
+	return cp, nil
+}
+
+// Restore replaces the state of a newly created simulation with the state
+// saved in the checkpoint. Records in the simulation's logs after the
+// checkpoint generation are discarded.
+func (cp *Checkpoint) Restore(sim EpidemicSimulation) error {
+	// Rebuild genotype tree. Parents are restored before their children.
+	records := make(map[ksuid.KSUID]checkpointNode)
+	for _, n := range cp.Nodes {
+		records[n.UID] = n
+	}
+	tree := EmptyGenotypeTree().(*genotypeTree)
+	var restore func(uid ksuid.KSUID) (GenotypeNode, error)
+	restore = func(uid ksuid.KSUID) (GenotypeNode, error) {
+		if node, exists := tree.nodes[uid]; exists {
+			return node, nil
+		}
+		n, exists := records[uid]
+		if !exists {
+			return nil, fmt.Errorf("genotype node %s not found in checkpoint", uid)
+		}
+		parents := make([]GenotypeNode, len(n.Parents))
+		for i, parentUID := range n.Parents {
+			parent, err := restore(parentUID)
+			if err != nil {
+				return nil, err
+			}
+			parents[i] = parent
+		}
+		return tree.newNode(n.UID, n.Sequence, n.Subs, n.Recombs, parents...), nil
+	}
+	for _, n := range cp.Nodes {
+		if _, err := restore(n.UID); err != nil {
+			return errors.Wrap(err, "restoring genotype tree failed")
+		}
+	}
+	sim.SetGenotypeTree(tree)
+
+	// Restore hosts that entered or left the population and
+	// their connections
+	if d := sim.Demography(); d != nil {
+		d.NextHostID = cp.NextHostID
+		for _, hostID := range sortedHostIDs(sim) {
+			if _, exists := cp.Statuses[hostID]; !exists {
+				sim.RemoveHost(hostID)
+			}
+		}
+		for hostID := range cp.Statuses {
+			if sim.Host(hostID) == nil {
+				sim.AddHost(d.createHost(hostID))
+			}
+		}
+		network := EmptyAdjacencyMatrix()
+		for _, c := range cp.Connections {
+			network.AddWeightedConnection(c.From, c.To, c.Weight)
+		}
+		sim.SetHostNetwork(network)
+	}
+
+	// Restore host states
+	for hostID, host := range sim.HostMap() {
+		status, exists := cp.Statuses[hostID]
+		if !exists {
+			return errors.Wrap(IntKeyNotFoundError(hostID), "restoring host status failed")
+		}
+		sim.SetHostStatus(hostID, status)
+		sim.SetHostTimer(hostID, cp.Timers[hostID])
+		sim.SetInfectionTime(hostID, cp.InfectionTimes[hostID])
+		host.RemoveAllPathogens()
+		pathogens := make([]GenotypeNode, len(cp.Hosts[hostID]))
+		for i, uid := range cp.Hosts[hostID] {
+			pathogens[i] = tree.nodes[uid]
+		}
+		host.AddPathogens(pathogens...)
+		host.SetImmuneHistory(cp.ImmuneHistories[hostID])
+	}
+	for _, hostID := range cp.Isolated {
+		sim.SetHostIsolated(hostID, true)
+	}
+	// Continue interventions. Changes to models are applied again in the
+	// order they were originally applied.
+	interventions := sim.Interventions()
+	if len(cp.Interventions) != len(interventions) {
+		return fmt.Errorf(UnequalIntParameterError, "number of interventions", len(interventions), len(cp.Interventions))
+	}
+	order := make([]int, len(interventions))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return cp.Interventions[order[i]].LastApplied < cp.Interventions[order[j]].LastApplied
+	})
+	for _, i := range order {
+		interventions[i].Restore(sim, cp.Interventions[i])
+	}
+	sim.SetInstanceID(cp.InstanceID)
+	sim.SetTime(cp.Generation)
+	sim.SetSeed(cp.Seed)
+	sim.SetMasterSeed(cp.MasterSeed)
+
+	// Remove records logged after the checkpoint
+	err := sim.Truncate(cp.Generation)
+	if err != nil {
+		return errors.Wrap(err, "restoring logs failed")
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package contagiongo
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// genotypeFreqs returns the number of pathogens of each genotype
+// in every host.
+func genotypeFreqs(sim Epidemic) map[int]map[string]int {
+	freqs := make(map[int]map[string]int)
+	for hostID, host := range sim.HostMap() {
+		freqs[hostID] = make(map[string]int)
+		for _, node := range host.Pathogens() {
+			freqs[hostID][fmt.Sprint(node.Sequence())]++
+		}
+	}
+	return freqs
+}
+
+func TestCheckpoint_Restore(t *testing.T) {
+	var seed int64 = 11
+	checkpointTime, interruptTime := 5, 8
+	tests := []struct {
+		name  string
+		extra string
+	}{
+		{"infection", ""},
+		{"demography", `
+[demography]
+birth_rate = 0.05
+death_rate = 0.03
+immigration_rate = 0.5
+immigrant_infection_prob = 0.5
+attachment = "random"
+num_connections = 2
+`},
+		{"isolation", `
+[[intervention]]
+action = "isolate"
+generation = 2
+interval = 3
+num_hosts = 2
+selection = "random"
+duration = 4
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "contagion")
+			if err != nil {
+				t.Fatalf(UnexpectedErrorWhileError, "creating temporary directory", err)
+			}
+			defer os.RemoveAll(dir)
+			conf := loadTestConfig(t, dir, tt.extra)
+			refPath := filepath.Join(dir, "ref")
+			resumedPath := filepath.Join(dir, "resumed")
+
+			// Uninterrupted run
+			ref := newTestSimulation(t, conf, NewCSVLogger(refPath, 1), seed)
+			ref.Run(1)
+
+			// Run that saves a checkpoint and is interrupted a few
+			// generations later without finalizing its logs
+			sim := newTestSimulation(t, conf, NewCSVLogger(resumedPath, 1), seed)
+			sim.SetInstanceID(1)
+			sim.Initialize()
+			sim.Update(0)
+			cpPath := CheckpointPath(resumedPath, 1)
+			for gen := 1; gen <= interruptTime; gen++ {
+				if stepEpidemic(sim, gen) {
+					t.Fatalf("simulation stopped at generation %d before being interrupted", gen)
+				}
+				if gen == checkpointTime {
+					err = WriteCheckpoint(sim, cpPath)
+					if err != nil {
+						t.Fatalf(UnexpectedErrorWhileError, "writing checkpoint", err)
+					}
+				}
+			}
+
+			// Continue from the checkpoint in a new simulation
+			cp, err := LoadCheckpoint(cpPath)
+			if err != nil {
+				t.Fatalf(UnexpectedErrorWhileError, "loading checkpoint", err)
+			}
+			resumed := newTestSimulation(t, conf, NewCSVLogger(resumedPath, 1), seed+1)
+			err = cp.Restore(resumed)
+			if err != nil {
+				t.Fatalf(UnexpectedErrorWhileError, "restoring checkpoint", err)
+			}
+			if resumed.Time() != checkpointTime {
+				t.Errorf(UnequalIntParameterError, "restored generation", checkpointTime, resumed.Time())
+			}
+			resumed.Run(1)
+
+			if resumed.Time() != ref.Time() {
+				t.Errorf(UnequalIntParameterError, "final generation", ref.Time(), resumed.Time())
+			}
+			if len(resumed.HostMap()) != len(ref.HostMap()) {
+				t.Fatalf(UnequalIntParameterError, "number of hosts", len(ref.HostMap()), len(resumed.HostMap()))
+			}
+			refFreqs, resumedFreqs := genotypeFreqs(ref), genotypeFreqs(resumed)
+			for hostID := range ref.HostMap() {
+				if resumed.Host(hostID) == nil {
+					t.Errorf("expected host %d to exist", hostID)
+					continue
+				}
+				if status := resumed.HostStatus(hostID); status != ref.HostStatus(hostID) {
+					t.Errorf("expected host %d status %d, instead got %d", hostID, ref.HostStatus(hostID), status)
+				}
+				if fmt.Sprint(resumedFreqs[hostID]) != fmt.Sprint(refFreqs[hostID]) {
+					t.Errorf("expected host %d genotypes %v, instead got %v", hostID, refFreqs[hostID], resumedFreqs[hostID])
+				}
+			}
+			for _, name := range []string{"g", "n", "freq", "tree", "status", "trans", "intervention", "demography"} {
+				refLog, err := ioutil.ReadFile(fmt.Sprintf("%s.001.%s.csv", refPath, name))
+				if err != nil {
+					t.Fatalf(UnexpectedErrorWhileError, "reading log", err)
+				}
+				resumedLog, err := ioutil.ReadFile(fmt.Sprintf("%s.001.%s.csv", resumedPath, name))
+				if err != nil {
+					t.Fatalf(UnexpectedErrorWhileError, "reading log", err)
+				}
+				if !bytes.Equal(refLog, resumedLog) {
+					t.Errorf("expected %s log of the resumed run to be identical to the uninterrupted run", name)
+				}
+			}
+		})
+	}
+}
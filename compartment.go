@@ -0,0 +1,192 @@
+package contagiongo
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// The following are keywords for the conditions that trigger a
+// transition between compartments in a user-defined compartmental model.
+const (
+	// TimerTrigger fires when the host's timer for the current status
+	// runs out.
+	TimerTrigger = "timer"
+	// InfectionTrigger fires when the host carries at least one pathogen.
+	InfectionTrigger = "infection"
+	// ClearanceTrigger fires when the host no longer carries any pathogen.
+	ClearanceTrigger = "clearance"
+	// LoadAboveTrigger fires when the pathogen population size of the
+	// host is greater than or equal to the transition threshold.
+	LoadAboveTrigger = "load_above"
+	// LoadBelowTrigger fires when the pathogen population size of the
+	// host is less than the transition threshold.
+	LoadBelowTrigger = "load_below"
+	// InfectiveThresholdTrigger fires when the host reaches the infective
+	// threshold set in its intrahost model.
+	InfectiveThresholdTrigger = "infective_threshold"
+	// ClearanceThresholdTrigger fires when the host reaches the clearance
+	// threshold set in its intrahost model.
+	ClearanceThresholdTrigger = "clearance_threshold"
+)
+
+// presetStatusCodes maps the names of preset compartments to their
+// corresponding status codes.
+var presetStatusCodes = map[string]int{
+	"susceptible": SusceptibleStatusCode,
+	"exposed":     ExposedStatusCode,
+	"infected":    InfectedStatusCode,
+	"infective":   InfectiveStatusCode,
+	"removed":     RemovedStatusCode,
+	"recovered":   RecoveredStatusCode,
+	"dead":        DeadStatusCode,
+	"vaccinated":  VaccinatedStatusCode,
+}
+
+// Compartment describes an epidemiological status in a user-defined
+// compartmental model and what hosts are allowed to do while in it.
+type Compartment struct {
+	Name string
+	Code int
+	// Duration is the number of generations a host stays in this
+	// compartment before its timer runs out. If 0, the duration is taken
+	// from the host's intrahost model when the code is a preset status
+	// code. Otherwise the compartment has no timer.
+	Duration int
+	// Infected indicates that pathogens replicate and mutate inside hosts
+	// in this compartment. Pathogens are cleared from hosts that enter a
+	// compartment that is not infected.
+	Infected bool
+	// Infectable indicates that hosts in this compartment can receive
+	// pathogens from transmitting hosts.
+	Infectable bool
+	// Transmits indicates that hosts in this compartment can transmit
+	// pathogens to their neighbors.
+	Transmits bool
+}
+
+// Transition describes a directed change from one compartment to another
+// that happens when its trigger condition is satisfied.
+type Transition struct {
+	From      int
+	To        int
+	Trigger   string
+	Threshold int
+	Prob      float64
+}
+
+// Check returns true if the transition condition is satisfied given
+// the host and the host's current timer.
+func (tr *Transition) Check(host Host, timer int) bool {
+	switch tr.Trigger {
+	case TimerTrigger:
+		return timer == 0
+	case InfectionTrigger:
+		return host.PathogenPopSize() > 0
+	case ClearanceTrigger:
+		return host.PathogenPopSize() == 0
+	case LoadAboveTrigger:
+		return host.PathogenPopSize() >= tr.Threshold
+	case LoadBelowTrigger:
+		return host.PathogenPopSize() < tr.Threshold
+	case InfectiveThresholdTrigger:
+		return InfectiveThresholdReached(host)
+	case ClearanceThresholdTrigger:
+		return ClearanceThresholdReached(host)
+	}
+	return false
+}
+
+// CompartmentalModel is a graph of compartments connected by transitions
+// that describes the course of infection in a host.
+type CompartmentalModel struct {
+	compartments map[int]*Compartment
+	transitions  map[int][]*Transition
+}
+
+// NewCompartmentalModel creates a new compartmental model from a list of
+// compartments and the transitions between them. Transitions originating
+// from the same compartment are evaluated in the given order.
+func NewCompartmentalModel(compartments []*Compartment, transitions []*Transition) *CompartmentalModel {
+	m := new(CompartmentalModel)
+	m.compartments = make(map[int]*Compartment)
+	m.transitions = make(map[int][]*Transition)
+	for _, c := range compartments {
+		m.compartments[c.Code] = c
+	}
+	for _, tr := range transitions {
+		m.transitions[tr.From] = append(m.transitions[tr.From], tr)
+	}
+	return m
+}
+
+// Compartment returns the compartment associated with the status code.
+// Returns nil if the status is not part of the model.
+func (m *CompartmentalModel) Compartment(status int) *Compartment {
+	return m.compartments[status]
+}
+
+// Transitions returns the list of transitions that start from
+// the given status.
+func (m *CompartmentalModel) Transitions(status int) []*Transition {
+	return m.transitions[status]
+}
+
+// InfectableStatuses returns the sorted list of status codes whose hosts
+// can receive pathogens.
+func (m *CompartmentalModel) InfectableStatuses() []int {
+	var statuses []int
+	for code, c := range m.compartments {
+		if c.Infectable {
+			statuses = append(statuses, code)
+		}
+	}
+	sort.Ints(statuses)
+	return statuses
+}
+
+// TransmittingStatuses returns the sorted list of status codes whose
+// hosts can transmit pathogens.
+func (m *CompartmentalModel) TransmittingStatuses() []int {
+	var statuses []int
+	for code, c := range m.compartments {
+		if c.Transmits {
+			statuses = append(statuses, code)
+		}
+	}
+	sort.Ints(statuses)
+	return statuses
+}
+
+// NextStatus evaluates the transitions that start from the current status
+// of the host and returns the new status. Returns false if the host
+// remains in its current status.
+func (m *CompartmentalModel) NextStatus(r *rand.Rand, host Host, status, timer int) (int, bool) {
+	for _, tr := range m.transitions[status] {
+		if !tr.Check(host, timer) {
+			continue
+		}
+		if tr.Prob >= 1 || r.Float64() < tr.Prob {
+			return tr.To, true
+		}
+	}
+	return status, false
+}
+
+// StatusDuration returns the number of generations the host will stay
+// in the given status.
+func (m *CompartmentalModel) StatusDuration(r *rand.Rand, host Host, status int) int {
+	c := m.compartments[status]
+	if c == nil {
+		return -1
+	}
+	if c.Duration > 0 {
+		if host.GetIntrahostModel().ProbabilisticDuration() {
+			return poisson(r, float64(c.Duration))
+		}
+		return c.Duration
+	}
+	if status >= SusceptibleStatusCode && status <= VaccinatedStatusCode {
+		return host.GetIntrahostModel().StatusDuration(r, status)
+	}
+	return -1
+}
@@ -0,0 +1,57 @@
+package contagiongo
+
+import "testing"
+
+var compartmentalModelTests = []struct {
+	desc      string
+	status    int
+	timer     int
+	pathogens int
+	output    int
+	changed   bool
+}{
+	{"susceptible without pathogens", SusceptibleStatusCode, -1, 0, SusceptibleStatusCode, false},
+	{"susceptible receives pathogens", SusceptibleStatusCode, -1, 3, ExposedStatusCode, true},
+	{"exposed below threshold", ExposedStatusCode, 5, 4, ExposedStatusCode, false},
+	{"exposed reaches threshold", ExposedStatusCode, 5, 5, InfectiveStatusCode, true},
+	{"infective timer runs out", InfectiveStatusCode, 0, 5, RemovedStatusCode, true},
+	{"infective clears pathogens", InfectiveStatusCode, 3, 0, RemovedStatusCode, true},
+	{"removed has no transitions", RemovedStatusCode, 0, 0, RemovedStatusCode, false},
+}
+
+func TestCompartmentalModel_NextStatus(t *testing.T) {
+	model := NewCompartmentalModel(
+		[]*Compartment{
+			{Name: "susceptible", Code: SusceptibleStatusCode, Infectable: true},
+			{Name: "exposed", Code: ExposedStatusCode, Infected: true},
+			{Name: "infective", Code: InfectiveStatusCode, Infected: true, Transmits: true},
+			{Name: "removed", Code: RemovedStatusCode},
+		},
+		[]*Transition{
+			{From: SusceptibleStatusCode, To: ExposedStatusCode, Trigger: InfectionTrigger, Prob: 1},
+			{From: ExposedStatusCode, To: InfectiveStatusCode, Trigger: LoadAboveTrigger, Threshold: 5, Prob: 1},
+			{From: InfectiveStatusCode, To: RemovedStatusCode, Trigger: TimerTrigger, Prob: 1},
+			{From: InfectiveStatusCode, To: RemovedStatusCode, Trigger: ClearanceTrigger, Prob: 1},
+		},
+	)
+	tree := EmptyGenotypeTree()
+	r := NewRand(0)
+	for _, tt := range compartmentalModelTests {
+		t.Run(tt.desc, func(t *testing.T) {
+			host := EmptySequenceHost(0)
+			for i := 0; i < tt.pathogens; i++ {
+				host.AddPathogens(tree.NewNode(newNodeUID(r), []uint8{0, 1, 0}, 0))
+			}
+			status, changed := model.NextStatus(r, host, tt.status, tt.timer)
+			if status != tt.output || changed != tt.changed {
+				t.Errorf("expected %d (%t), got %d (%t) instead", tt.output, tt.changed, status, changed)
+			}
+		})
+	}
+	if statuses := model.InfectableStatuses(); len(statuses) != 1 || statuses[0] != SusceptibleStatusCode {
+		t.Errorf("expected infectable statuses %v, got %v instead", []int{SusceptibleStatusCode}, statuses)
+	}
+	if statuses := model.TransmittingStatuses(); len(statuses) != 1 || statuses[0] != InfectiveStatusCode {
+		t.Errorf("expected transmitting statuses %v, got %v instead", []int{InfectiveStatusCode}, statuses)
+	}
+}
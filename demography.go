@@ -0,0 +1,202 @@
+package contagiongo
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// The following are the events recorded when a host enters or leaves
+// the population.
+const (
+	BirthEvent        = "birth"
+	DeathEvent        = "death"
+	DiseaseDeathEvent = "disease_death"
+	ImmigrationEvent  = "immigration"
+	EmigrationEvent   = "emigration"
+)
+
+// The following are the rules used to connect new hosts to the
+// existing hosts in the network.
+const (
+	// RandomAttachment connects a new host to hosts picked uniformly
+	// at random.
+	RandomAttachment = "random"
+	// PreferentialAttachment connects a new host to hosts picked with
+	// probability proportional to their number of connections plus one.
+	PreferentialAttachment = "preferential"
+)
+
+// Demography adds and removes hosts from the simulation every generation.
+// New hosts enter the population as susceptible hosts and are connected
+// to existing hosts using two way connections.
+type Demography struct {
+	// BirthRate is the expected number of births per host per generation.
+	BirthRate float64
+	// DeathRate is the probability that a host dies from causes unrelated
+	// to the disease in a generation.
+	DeathRate float64
+	// DiseaseDeathRate is the probability that an infected host dies
+	// from the disease in a generation. Hosts in the dead status are
+	// always removed.
+	DiseaseDeathRate float64
+	// ImmigrationRate is the expected number of hosts that enter the
+	// population per generation.
+	ImmigrationRate float64
+	// EmigrationRate is the probability that a host leaves the population
+	// in a generation.
+	EmigrationRate float64
+	// ImmigrantInfectionProb is the probability that an immigrant carries
+	// pathogens. Infected immigrants carry the pathogens seeded in one of
+	// the hosts at the start of the simulation.
+	ImmigrantInfectionProb float64
+	// Attachment is the rule used to connect new hosts.
+	Attachment string
+	// NumConnections is the number of hosts each new host is connected to.
+	NumConnections int
+	// ConnectionWeight is the weight of each new connection.
+	ConnectionWeight float64
+
+	IntrahostModel    IntrahostModel
+	FitnessModel      FitnessModel
+	TransmissionModel TransmissionModel
+	// Seeds are the sets of sequences carried by infected immigrants.
+	Seeds [][][]uint8
+	// NextHostID is the ID assigned to the next host that enters the
+	// population. IDs of hosts that left are never reused.
+	NextHostID int
+}
+
+// Update removes hosts that died or emigrated, then adds newborn hosts
+// and immigrants at generation t. Hosts are removed in order of host ID
+// and new hosts are added in increasing order of ID so that the same
+// seed always results in the same population.
+func (d *Demography) Update(sim Epidemic, t int) []DemographyPackage {
+	r := sim.Rand(t, demographyStream)
+	var records []DemographyPackage
+	ids := sortedHostIDs(sim)
+	remaining := make([]int, 0, len(ids))
+	for _, id := range ids {
+		host := sim.Host(id)
+		status := sim.HostStatus(id)
+		var event string
+		switch {
+		case status == DeadStatusCode:
+			event = DiseaseDeathEvent
+		case r.Float64() < d.DeathRate:
+			event = DeathEvent
+		case host.PathogenPopSize() > 0 && r.Float64() < d.DiseaseDeathRate:
+			event = DiseaseDeathEvent
+		case r.Float64() < d.EmigrationRate:
+			event = EmigrationEvent
+		}
+		if event == "" {
+			remaining = append(remaining, id)
+			continue
+		}
+		sim.RemoveHost(id)
+		records = append(records, DemographyPackage{genID: t, hostID: id, event: event, status: status})
+	}
+
+	births := poisson(r, d.BirthRate*float64(len(remaining)))
+	immigrants := poisson(r, d.ImmigrationRate)
+	if births+immigrants == 0 {
+		return records
+	}
+	network := sim.HostNetwork()
+	for i := 0; i < births+immigrants; i++ {
+		host := d.createHost(d.NextHostID)
+		d.NextHostID++
+		sim.AddHost(host)
+		d.connect(r, network, host.ID(), remaining)
+		remaining = append(remaining, host.ID())
+		if i < births {
+			records = append(records, DemographyPackage{genID: t, hostID: host.ID(), event: BirthEvent, status: SusceptibleStatusCode})
+			continue
+		}
+		if len(d.Seeds) > 0 && r.Float64() < d.ImmigrantInfectionProb {
+			for _, sequence := range d.Seeds[r.Intn(len(d.Seeds))] {
+				genotype := sim.GenotypeTree().NewNode(newNodeUID(r), sequence, 0)
+				host.AddPathogens(genotype)
+				RememberInfection(host, sequence, t)
+			}
+			sim.SetInfectionTime(host.ID(), t)
+		}
+		records = append(records, DemographyPackage{genID: t, hostID: host.ID(), event: ImmigrationEvent, status: SusceptibleStatusCode})
+	}
+	sim.SetHostNetwork(network)
+	return records
+}
+
+// createHost returns an empty host that uses the models assigned
+// to new hosts.
+func (d *Demography) createHost(id int) Host {
+	host := EmptySequenceHost(id)
+	host.SetIntrahostModel(d.IntrahostModel)
+	host.SetFitnessModel(d.FitnessModel)
+	host.SetTransmissionModel(d.TransmissionModel)
+	return host
+}
+
+// connect adds two way connections between the new host and hosts picked
+// from candidates using the attachment rule. The new host is connected to
+// every candidate if there are fewer candidates than connections.
+func (d *Demography) connect(r *rand.Rand, network HostNetwork, id int, candidates []int) {
+	n := d.NumConnections
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	pool := append([]int{}, candidates...)
+	weights := make([]float64, len(pool))
+	var total float64
+	for i, c := range pool {
+		weights[i] = 1
+		if d.Attachment == PreferentialAttachment {
+			weights[i] += float64(len(network.GetNeighbors(c)))
+		}
+		total += weights[i]
+	}
+	for k := 0; k < n; k++ {
+		// Pick without replacement
+		x := r.Float64() * total
+		i := 0
+		for ; i < len(pool)-1; i++ {
+			x -= weights[i]
+			if x < 0 {
+				break
+			}
+		}
+		network.AddWeightedBiConnection(id, pool[i], d.ConnectionWeight)
+		total -= weights[i]
+		pool = append(pool[:i], pool[i+1:]...)
+		weights = append(weights[:i], weights[i+1:]...)
+	}
+}
+
+// changePopulation adds and removes hosts at generation t and records
+// each event. Does nothing if the population is closed.
+func changePopulation(sim EpidemicSimulation, t int) {
+	d := sim.Demography()
+	if d == nil {
+		return
+	}
+	c := make(chan DemographyPackage)
+	go func() {
+		for _, pack := range d.Update(sim, t) {
+			pack.instanceID = sim.InstanceID()
+			c <- pack
+		}
+		close(c)
+	}()
+	sim.WriteDemography(c)
+}
+
+// sortedHostIDs returns the IDs of hosts in the simulation in
+// increasing order.
+func sortedHostIDs(sim Epidemic) []int {
+	ids := make([]int, 0, len(sim.HostMap()))
+	for id := range sim.HostMap() {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
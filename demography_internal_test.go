@@ -0,0 +1,45 @@
+package contagiongo
+
+import "testing"
+
+func TestSequenceNodeEpidemic_AddRemoveHost(t *testing.T) {
+	sim := new(SequenceNodeEpidemic)
+	sim.hosts = make(map[int]Host)
+	sim.statuses = make(map[int]int)
+	sim.timers = make(map[int]int)
+	sim.infectionTimes = make(map[int]int)
+	network := EmptyAdjacencyMatrix()
+	for i := 0; i < 3; i++ {
+		sim.hosts[i] = EmptySequenceHost(i)
+	}
+	network.AddWeightedBiConnection(0, 1, 1)
+	network.AddWeightedBiConnection(1, 2, 1)
+	sim.setHostNetwork(network)
+
+	sim.RemoveHost(1)
+	if _, exists := sim.HostMap()[1]; exists {
+		t.Errorf("expected host 1 to be removed")
+	}
+	for _, id := range []int{0, 2} {
+		if n := len(sim.HostNeighbors(id)); n != 0 {
+			t.Errorf(UnequalIntParameterError, "number of neighbors", 0, n)
+		}
+	}
+
+	d := &Demography{NumConnections: 2, ConnectionWeight: 1, Attachment: RandomAttachment}
+	host := d.createHost(3)
+	sim.AddHost(host)
+	if status := sim.HostStatus(3); status != SusceptibleStatusCode {
+		t.Errorf(UnequalIntParameterError, "status", SusceptibleStatusCode, status)
+	}
+	d.connect(NewRand(0), sim.HostNetwork(), 3, []int{0, 2})
+	sim.SetHostNetwork(sim.HostNetwork())
+	for _, id := range []int{0, 2} {
+		if w := sim.HostConnection(id, 3); w != 1 {
+			t.Errorf(UnequalFloatParameterError, "connection weight", 1., w)
+		}
+	}
+	if n := len(sim.HostNeighbors(3)); n != 2 {
+		t.Errorf(UnequalIntParameterError, "number of neighbors", 2, n)
+	}
+}
@@ -2,9 +2,13 @@ package contagiongo
 
 import (
 	"fmt"
+	"log"
 	"math"
+	"math/rand"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/segmentio/ksuid"
 )
@@ -26,6 +30,12 @@ type Epidemic interface {
 	// SetHostTimer sets the number of generations for the host to
 	// remain in its current status.
 	SetHostTimer(id, interval int)
+	// InfectionTime returns the generation when the host was last
+	// infected while carrying no pathogens. Seeded hosts are infected
+	// at generation 0.
+	InfectionTime(id int) int
+	// SetInfectionTime sets the generation when the host was infected.
+	SetInfectionTime(id, t int)
 	// InfectableStatuses returns the list of statuses that infected
 	// hosts can transmit to.
 	InfectableStatuses() []int
@@ -39,6 +49,37 @@ type Epidemic interface {
 	// HostNeighbors retrieves the directly connected hosts to the current
 	// host based on the supplied adjacency matrix.
 	HostNeighbors(id int) []Host
+	// HostContacts returns the hosts that the host can transmit to at
+	// generation t. These are the neighbors of the host in a host network,
+	// or hosts picked at random from patches in a metapopulation.
+	HostContacts(t, id int) []Host
+	// UpdateNetwork replaces host connections with the connections present
+	// at generation t if the host network changes over time. It should be
+	// called at the start of every generation.
+	UpdateNetwork(t int)
+	// HostIsolated returns true if all connections of the host are removed.
+	HostIsolated(id int) bool
+	// SetHostIsolated removes all connections of the host if isolated is
+	// true, or restores them otherwise.
+	SetHostIsolated(id int, isolated bool)
+	// Interventions returns the interventions applied during the
+	// simulation in the order they are applied every generation.
+	Interventions() []Intervention
+	// AddHost adds a new susceptible host to the simulation. The host has
+	// no connections until they are added to the host network and the
+	// network is replaced using SetHostNetwork.
+	AddHost(host Host)
+	// RemoveHost removes the host and all its connections from the
+	// simulation.
+	RemoveHost(id int)
+	// HostNetwork returns the current connections between hosts.
+	HostNetwork() HostNetwork
+	// SetHostNetwork replaces host connections and rebuilds the
+	// neighborhood of each host.
+	SetHostNetwork(network HostNetwork)
+	// Demography returns the processes that add and remove hosts every
+	// generation. Returns nil if the population is closed.
+	Demography() *Demography
 
 	// NewInstance creates a new instance from the stored configuration
 	NewInstance() (Epidemic, error)
@@ -51,6 +92,28 @@ type Epidemic interface {
 	// start of the simulation.
 	GenotypeSet() GenotypeSet
 
+	// GenotypeTree returns the tree that records the lineage of all
+	// GenotypeNodes seen since the start of the simulation.
+	GenotypeTree() GenotypeTree
+	// SetGenotypeTree replaces the current genotype tree. This is used
+	// to restore a simulation from a checkpoint.
+	SetGenotypeTree(tree GenotypeTree)
+
+	// SetSeed sets the seed of the simulation instance. All random number
+	// streams used in the simulation are derived from this seed.
+	SetSeed(seed int64)
+	// Seed returns the seed of the simulation instance.
+	Seed() int64
+	// SetMasterSeed sets the seed that the seed of every simulation
+	// instance is derived from.
+	SetMasterSeed(seed int64)
+	// MasterSeed returns the seed that the seed of every simulation
+	// instance is derived from.
+	MasterSeed() int64
+	// Rand returns a new random number generator whose stream is
+	// determined by the seed of the simulation instance and the given IDs.
+	Rand(ids ...int) *rand.Rand
+
 	// StopSimulation check whether the simulation has satisfied at least one
 	// of the conditions that will halt the simulation in the current interation.
 	StopSimulation() bool
@@ -92,14 +155,23 @@ type SequenceNodeEpidemic struct {
 	hosts              map[int]Host
 	statuses           map[int]int
 	timers             map[int]int
+	infectionTimes     map[int]int
 	intrahostModels    map[int]IntrahostModel
 	fitnessModels      map[int]FitnessModel
 	transModels        map[int]TransmissionModel
 	hostNeighborhoods  map[int][]Host
 	hostNetwork        HostNetwork
+	temporalNetwork    TemporalNetwork
+	networkEpoch       int
+	metapopulation     *Metapopulation
+	isolated           map[int]bool
+	interventions      []Intervention
+	demography         *Demography
 	infectableStatuses []int
 	tree               GenotypeTree
 	config             Config
+	seed               int64
+	masterSeed         int64
 
 	stopConditions []StopCondition
 }
@@ -140,6 +212,22 @@ func (sim *SequenceNodeEpidemic) SetHostTimer(id, interval int) {
 	sim.timers[id] = interval
 }
 
+// InfectionTime returns the generation when the host was last
+// infected while carrying no pathogens. Seeded hosts are infected
+// at generation 0.
+func (sim *SequenceNodeEpidemic) InfectionTime(id int) int {
+	sim.RLock()
+	defer sim.RUnlock()
+	return sim.infectionTimes[id]
+}
+
+// SetInfectionTime sets the generation when the host was infected.
+func (sim *SequenceNodeEpidemic) SetInfectionTime(id, t int) {
+	sim.Lock()
+	defer sim.Unlock()
+	sim.infectionTimes[id] = t
+}
+
 // InfectableStatuses returns the list of statuses that infected
 // hosts can transmit to.
 func (sim *SequenceNodeEpidemic) InfectableStatuses() []int {
@@ -155,6 +243,9 @@ func (sim *SequenceNodeEpidemic) HostMap() map[int]Host {
 // HostConnection returns the weight of a connection between two hosts
 // if it exists, returns 0 otherwise.
 func (sim *SequenceNodeEpidemic) HostConnection(a, b int) float64 {
+	if sim.isolated[a] || sim.isolated[b] {
+		return 0
+	}
 	return sim.hostNetwork.Connection(a, b)
 }
 
@@ -164,6 +255,137 @@ func (sim *SequenceNodeEpidemic) HostNeighbors(id int) []Host {
 	return sim.hostNeighborhoods[id]
 }
 
+// HostContacts returns the hosts that the host can transmit to at
+// generation t. These are the neighbors of the host in a host network,
+// or hosts picked at random from patches in a metapopulation.
+func (sim *SequenceNodeEpidemic) HostContacts(t, id int) []Host {
+	if sim.metapopulation == nil {
+		return sim.HostNeighbors(id)
+	}
+	return sim.metapopulation.Contacts(sim.Rand(t, contactStream, id), sim, id)
+}
+
+// UpdateNetwork replaces host connections with the connections present
+// at generation t if the host network changes over time. Neighborhoods are
+// only rebuilt when connections have changed since the last update.
+func (sim *SequenceNodeEpidemic) UpdateNetwork(t int) {
+	if sim.temporalNetwork == nil {
+		return
+	}
+	// Number of changes that have happened up to generation t
+	epoch := sort.SearchInts(sim.temporalNetwork.ChangeTimes(), t+1)
+	if epoch == sim.networkEpoch {
+		return
+	}
+	sim.setHostNetwork(sim.temporalNetwork.Network(t))
+	sim.networkEpoch = epoch
+}
+
+// HostIsolated returns true if all connections of the host are removed.
+func (sim *SequenceNodeEpidemic) HostIsolated(id int) bool {
+	return sim.isolated[id]
+}
+
+// SetHostIsolated removes all connections of the host if isolated is
+// true, or restores them otherwise. Isolation persists when the host
+// network changes over time.
+func (sim *SequenceNodeEpidemic) SetHostIsolated(id int, isolated bool) {
+	if sim.isolated == nil {
+		sim.isolated = make(map[int]bool)
+	}
+	if sim.isolated[id] == isolated {
+		return
+	}
+	if isolated {
+		sim.isolated[id] = true
+	} else {
+		delete(sim.isolated, id)
+	}
+	sim.setHostNetwork(sim.hostNetwork)
+}
+
+// Interventions returns the interventions applied during the simulation.
+func (sim *SequenceNodeEpidemic) Interventions() []Intervention {
+	return sim.interventions
+}
+
+// AddHost adds a new susceptible host to the simulation. The host has
+// no connections until they are added to the host network and the
+// network is replaced using SetHostNetwork.
+func (sim *SequenceNodeEpidemic) AddHost(host Host) {
+	sim.Lock()
+	defer sim.Unlock()
+	id := host.ID()
+	sim.hosts[id] = host
+	sim.statuses[id] = SusceptibleStatusCode
+	sim.timers[id] = -1
+	sim.hostNeighborhoods[id] = []Host{}
+}
+
+// RemoveHost removes the host and all its connections from the
+// simulation. The host is also removed from the neighborhood of
+// every other host.
+func (sim *SequenceNodeEpidemic) RemoveHost(id int) {
+	sim.Lock()
+	defer sim.Unlock()
+	delete(sim.hosts, id)
+	delete(sim.statuses, id)
+	delete(sim.timers, id)
+	delete(sim.infectionTimes, id)
+	delete(sim.isolated, id)
+	delete(sim.hostNeighborhoods, id)
+	sim.hostNetwork.DeleteHost(id)
+	for i, neighbors := range sim.hostNeighborhoods {
+		for j, neighbor := range neighbors {
+			if neighbor.ID() == id {
+				sim.hostNeighborhoods[i] = append(neighbors[:j:j], neighbors[j+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// HostNetwork returns the current connections between hosts.
+func (sim *SequenceNodeEpidemic) HostNetwork() HostNetwork {
+	return sim.hostNetwork
+}
+
+// SetHostNetwork replaces host connections and rebuilds the
+// neighborhood of each host.
+func (sim *SequenceNodeEpidemic) SetHostNetwork(network HostNetwork) {
+	sim.setHostNetwork(network)
+}
+
+// Demography returns the processes that add and remove hosts every
+// generation. Returns nil if the population is closed.
+func (sim *SequenceNodeEpidemic) Demography() *Demography {
+	return sim.demography
+}
+
+// setHostNetwork replaces host connections and rebuilds the neighborhood
+// of each host. Neighbors are sorted by host ID.
+// Isolated hosts have no neighbors and are not neighbors of other hosts.
+func (sim *SequenceNodeEpidemic) setHostNetwork(network HostNetwork) {
+	sim.hostNetwork = network
+	sim.hostNeighborhoods = make(map[int][]Host)
+	for id := range sim.hosts {
+		if sim.isolated[id] {
+			continue
+		}
+		neighborIDs := network.GetNeighbors(id)
+		sort.Ints(neighborIDs)
+		sim.hostNeighborhoods[id] = make([]Host, 0, len(neighborIDs))
+		for _, neighborID := range neighborIDs {
+			if sim.isolated[neighborID] {
+				continue
+			}
+			if neighbor, exists := sim.hosts[neighborID]; exists {
+				sim.hostNeighborhoods[id] = append(sim.hostNeighborhoods[id], neighbor)
+			}
+		}
+	}
+}
+
 // NewInstance creates a new instance from the stored configuration
 func (sim *SequenceNodeEpidemic) NewInstance() (Epidemic, error) {
 	return sim.config.NewSimulation()
@@ -181,6 +403,49 @@ func (sim *SequenceNodeEpidemic) GenotypeSet() GenotypeSet {
 	return sim.tree.Set()
 }
 
+// GenotypeTree returns the tree that records the lineage of all
+// GenotypeNodes seen since the start of the simulation.
+func (sim *SequenceNodeEpidemic) GenotypeTree() GenotypeTree {
+	return sim.tree
+}
+
+// SetGenotypeTree replaces the current genotype tree. This is used
+// to restore a simulation from a checkpoint.
+func (sim *SequenceNodeEpidemic) SetGenotypeTree(tree GenotypeTree) {
+	sim.tree = tree
+}
+
+// SetSeed sets the seed of the simulation instance. All random number
+// streams used in the simulation are derived from this seed.
+func (sim *SequenceNodeEpidemic) SetSeed(seed int64) {
+	sim.seed = seed
+}
+
+// Seed returns the seed of the simulation instance.
+func (sim *SequenceNodeEpidemic) Seed() int64 {
+	return sim.seed
+}
+
+// SetMasterSeed sets the seed that the seed of every simulation
+// instance is derived from.
+func (sim *SequenceNodeEpidemic) SetMasterSeed(seed int64) {
+	sim.masterSeed = seed
+}
+
+// MasterSeed returns the seed that the seed of every simulation
+// instance is derived from.
+func (sim *SequenceNodeEpidemic) MasterSeed() int64 {
+	return sim.masterSeed
+}
+
+// Rand returns a new random number generator whose stream is determined
+// by the seed of the simulation instance and the given IDs. For example,
+// each host gets its own stream every generation so that results do not
+// depend on the order goroutines are scheduled.
+func (sim *SequenceNodeEpidemic) Rand(ids ...int) *rand.Rand {
+	return NewRand(DeriveSeed(sim.seed, ids...))
+}
+
 // StopSimulation check whether the simulation has satisfied at least one
 // of the conditions that will halt the simulation in the current
 // interation. Returns true is the simulation should stop, false otherwise.
@@ -193,7 +458,7 @@ func (sim *SequenceNodeEpidemic) StopSimulation() bool {
 			break
 		}
 	}
-	return continueSim
+	return !continueSim
 }
 
 // The following methods are used as goroutines that performs tasks within
@@ -208,11 +473,12 @@ func (sim *SequenceNodeEpidemic) SusceptibleProcess(i, t int, host Host, wg *syn
 
 // ExposedProcess executes within-host processes that occurs when a host
 // is in the exposed state. By default, it is same as InfectedProcess.
+// Whether the host becomes infective is decided during the update step
+// using the timer and the thresholds set in the intrahost model.
 func (sim *SequenceNodeEpidemic) ExposedProcess(i, t int, host Host, c chan<- MutationPackage, wg *sync.WaitGroup) {
 	// timer decrement is done within the InfectedProcess function
 	// Done() signal also executed within the InfectedProcess function
 	sim.InfectedProcess(i, t, host, c, wg)
-	// TODO: Threshold to be considered infective instead of exposed
 }
 
 // InfectedProcess executes within-host processes that occurs when a host
@@ -223,6 +489,12 @@ func (sim *SequenceNodeEpidemic) InfectedProcess(i, t int, host Host, c chan<- M
 	if host.PathogenPopSize() == 0 {
 		return
 	}
+	r := sim.Rand(t, processStream, host.ID())
+	// Pathogens similar to those of previous infections of the host
+	// replicate less
+	immuneSystem := HostImmuneSystem(host, sim.InfectionTime(host.ID())-1)
+	// Fitness may depend on the host and on its current pathogens
+	ctx := NewFitnessContext(t, sim.InfectionTime(host.ID()), host, pathogens)
 	var replicatedC <-chan GenotypeNode
 	switch strings.ToLower(host.GetIntrahostModel().ReplicationMethod()) {
 	case "relative":
@@ -232,7 +504,10 @@ func (sim *SequenceNodeEpidemic) InfectedProcess(i, t int, host Host, c chan<- M
 		var maxLogFitness float64
 		// Compute log total fitness and get max value
 		for i, pathogen := range pathogens {
-			logFitnesses[i] = pathogen.Fitness(host.GetFitnessModel())
+			logFitnesses[i] = FitnessInContext(host.GetFitnessModel(), ctx, pathogen)
+			if immuneSystem != nil {
+				logFitnesses[i] += math.Log(1 - immuneSystem.Protection(pathogen.Sequence()))
+			}
 			if maxLogFitness < logFitnesses[i] {
 				maxLogFitness = logFitnesses[i]
 			}
@@ -243,6 +518,12 @@ func (sim *SequenceNodeEpidemic) InfectedProcess(i, t int, host Host, c chan<- M
 		for _, logF := range logFitnesses {
 			c += math.Exp(logF - maxLogFitness)
 		}
+		// Infection is cleared if the immune system neutralizes
+		// all pathogens
+		if c == 0 {
+			host.RemoveAllPathogens()
+			return
+		}
 		// normalize
 		normedDecFitnesses := make([]float64, len(pathogens))
 		for i, logF := range logFitnesses {
@@ -253,19 +534,19 @@ func (sim *SequenceNodeEpidemic) InfectedProcess(i, t int, host Host, c chan<- M
 		// TODO: Expose this in interface
 		nextPopSize := host.GetIntrahostModel().NextPathogenPopSize(currentPopSize)
 		// Execute
-		replicatedC = MultinomialReplication(pathogens, normedDecFitnesses, nextPopSize)
+		replicatedC = MultinomialReplication(r, pathogens, normedDecFitnesses, nextPopSize)
 	case "absolute":
 		// Get decimal fitness values. Each value is the expected number of
 		// offspring
 		replicativeFitnesses := make([]float64, len(pathogens))
 		for i, pathogen := range pathogens {
-			replicativeFitnesses[i] = pathogen.Fitness(host.GetFitnessModel())
+			replicativeFitnesses[i] = FitnessInContext(host.GetFitnessModel(), ctx, pathogen)
 		}
 		// Execute
-		replicatedC = IntrinsicRateReplication(pathogens, replicativeFitnesses, nil)
+		replicatedC = IntrinsicRateReplication(r, pathogens, replicativeFitnesses, immuneSystem)
 	}
 	// Mutate replicated pathogens
-	mutatedC, newMutantsC := MutateSequence(replicatedC, sim.tree, host.GetIntrahostModel())
+	mutatedC, newMutantsC := MutateSequence(r, replicatedC, sim.tree, host.GetIntrahostModel())
 	// Clear current set of pathogens and get new set from the channel
 	host.RemoveAllPathogens()
 	var wg2 sync.WaitGroup
@@ -359,4 +640,109 @@ type EpidemicSimulation interface {
 	LogFrequency() int
 	SetStopped(b bool)
 	Stopped() bool
+	CheckpointFreq() int
+	CheckpointPath() string
+	ConfigPath() string
+}
+
+// runEpidemic instantiates, runs, and records a simulation.
+// If the simulation was restored from a checkpoint, it continues from the
+// generation after the checkpoint and appends to the existing logs.
+func runEpidemic(sim EpidemicSimulation, i int) {
+	sim.SetInstanceID(i)
+	if sim.Time() == 0 {
+		sim.Initialize()
+		// Initial state
+		sim.Update(0)
+	}
+
+	startTime := sim.Time()
+	var maxElapsed int64
+	// First five generations generation initializes time
+	for sim.Time() < startTime+6 && sim.Time() < sim.NumGenerations() {
+		t := sim.Time() + 1
+		fmt.Printf(" instance %04d\tgeneration %05d\n", i, t)
+		start := time.Now()
+		stop := stepEpidemic(sim, t)
+		checkpointEpidemic(sim)
+		// Check time elapsed
+		if elapsed := time.Since(start).Nanoseconds(); elapsed > maxElapsed {
+			maxElapsed = elapsed
+		}
+		// Feedback that simulation is stopping
+		if stop {
+			fmt.Printf(" [stop]       \tgeneration %05d\tstop condition triggered\n", sim.Time())
+			break
+		}
+	}
+	if !sim.Stopped() {
+		fmt.Printf(" \t\texpected time: %fms per generation\n", float64(maxElapsed)/1e6)
+	}
+	for sim.Time() < sim.NumGenerations() && !sim.Stopped() {
+		t := sim.Time() + 1
+		// Print only every ten steps is time is short
+		if maxElapsed < 0.02e9 {
+			if t%100 == 0 {
+				fmt.Printf(" instance %04d\tgeneration %05d\n", i, t)
+			}
+		} else if maxElapsed < 0.2e9 {
+			if t%10 == 0 {
+				fmt.Printf(" instance %04d\tgeneration %05d\n", i, t)
+			}
+		} else {
+			fmt.Printf(" instance %04d\tgeneration %05d\n", i, t)
+		}
+		stop := stepEpidemic(sim, t)
+		checkpointEpidemic(sim)
+		// Feedback that simulation is stopping
+		if stop {
+			fmt.Printf(" [stop]       \tgeneration %05d\tstop condition triggered\n", sim.Time())
+			break
+		}
+	}
+	// Save the final state so that resuming skips finished instances
+	if sim.CheckpointFreq() > 0 {
+		err := WriteCheckpoint(sim, sim.CheckpointPath())
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	fmt.Println(strings.Repeat("-", 80))
+	sim.Finalize()
+}
+
+// stepEpidemic runs generation t of the simulation. The host network,
+// interventions and the host population are updated before within-host
+// processes and transmission. Returns true if a stop condition was
+// triggered. Every loop that runs a simulation uses this function so that
+// the same model is simulated everywhere.
+func stepEpidemic(sim EpidemicSimulation, t int) bool {
+	sim.SetTime(t)
+	sim.UpdateNetwork(t)
+	intervene(sim, t)
+	changePopulation(sim, t)
+	sim.Process(t)
+	sim.Transmit(t)
+	// Check conditions before update
+	stop := sim.StopSimulation()
+	if stop {
+		sim.SetStopped(true)
+	}
+	// Update after condition. If stop, will override logging setting
+	// and log last generation
+	sim.Update(t)
+	return stop
+}
+
+// checkpointEpidemic saves the current state of the simulation to disk
+// every CheckpointFreq generations.
+func checkpointEpidemic(sim EpidemicSimulation) {
+	freq := sim.CheckpointFreq()
+	if freq < 1 || sim.Time()%freq != 0 || sim.Stopped() || sim.Time() >= sim.NumGenerations() {
+		return
+	}
+	err := WriteCheckpoint(sim, sim.CheckpointPath())
+	if err != nil {
+		log.Fatal(err)
+	}
 }
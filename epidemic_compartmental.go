@@ -0,0 +1,245 @@
+package contagiongo
+
+import (
+	"sync"
+
+	"github.com/segmentio/ksuid"
+)
+
+// CompartmentalConfig is a Config that also describes a user-defined
+// compartmental model.
+type CompartmentalConfig interface {
+	Config
+	CompartmentalModel() (*CompartmentalModel, error)
+}
+
+// CompartmentalSimulation creates and runs an epidemiological simulation
+// using a user-defined compartmental model. Status changes, intrahost
+// processes and transmission are determined by the compartments and
+// transitions declared in the configuration instead of being hard-coded.
+// Within this simulation, hosts may or may not run
+// independent genetic evolution simulations.
+type CompartmentalSimulation struct {
+	EpidemicSimulation
+	model *CompartmentalModel
+}
+
+// NewCompartmentalSimulation creates a new simulation based on
+// a user-defined compartmental model.
+func NewCompartmentalSimulation(config CompartmentalConfig, logger DataLogger) (*CompartmentalSimulation, error) {
+	sim := new(CompartmentalSimulation)
+	var err error
+	sim.EpidemicSimulation, err = NewSISimulation(config, logger)
+	if err != nil {
+		return nil, err
+	}
+	sim.model, err = config.CompartmentalModel()
+	if err != nil {
+		return nil, err
+	}
+	return sim, nil
+}
+
+// Model returns the compartmental model used by the simulation.
+func (sim *CompartmentalSimulation) Model() *CompartmentalModel {
+	return sim.model
+}
+
+// Run instantiates, runs, and records the a new simulation.
+func (sim *CompartmentalSimulation) Run(i int) {
+	runEpidemic(sim, i)
+}
+
+// Update looks at the timer or internal state to decide if
+// the status of the host remains the same of will change.
+// After the status updates, each host's status is recorded to file.
+func (sim *CompartmentalSimulation) Update(t int) {
+	// Update status first
+	c := make(chan StatusPackage)
+	d := make(chan GenotypeFreqPackage)
+	var wg sync.WaitGroup
+	// Read all hosts and process hosts concurrently
+	// These succeeding steps connects the simulation's record of
+	// each host's status and timer with the host's internal state.
+	for hostID, host := range sim.HostMap() {
+		// Simulation-level record of status and timer of particular host
+		timer := sim.HostTimer(hostID)
+		pack := StatusPackage{
+			instanceID: sim.InstanceID(),
+			genID:      t,
+			hostID:     hostID,
+			status:     sim.HostStatus(hostID), // current host status before checking
+		}
+		wg.Add(1)
+		go func(i, t int, host Host, timer int, pack StatusPackage, c chan<- StatusPackage, d chan<- GenotypeFreqPackage, wg *sync.WaitGroup) {
+			defer wg.Done()
+			r := sim.Rand(t, updateStream, host.ID())
+			// Transitions are looked up from the user-defined
+			// compartmental model instead of being hard-coded
+			newStatus, changed := sim.model.NextStatus(r, host, pack.status, timer)
+			if changed {
+				// Set new host status
+				newDuration := sim.model.StatusDuration(r, host, newStatus)
+				sim.SetHostStatus(host.ID(), newStatus)
+				sim.SetHostTimer(host.ID(), newDuration)
+				// Update status in pack and send
+				pack.status = newStatus
+				// Pathogens do not persist outside infected compartments
+				if c := sim.model.Compartment(newStatus); c == nil || !c.Infected {
+					host.RemoveAllPathogens()
+				}
+			}
+			// Send pack after all changes
+			c <- pack
+			// Record pathogen frequencies
+			counts := make(map[ksuid.KSUID]int)
+			for _, p := range host.Pathogens() {
+				counts[p.GenotypeUID()]++
+			}
+			for uid, freq := range counts {
+				d <- GenotypeFreqPackage{
+					instanceID: i,
+					genID:      t,
+					hostID:     host.ID(),
+					genotypeID: uid,
+					freq:       freq,
+				}
+			}
+		}(sim.InstanceID(), t, host, timer, pack, c, d, &wg)
+	}
+	go func() {
+		wg.Wait()
+		close(c)
+		close(d)
+	}()
+	// Write status  and genotype frequencies using DataLogger
+	var wg2 sync.WaitGroup
+	wg2.Add(2)
+	go func() {
+		if sim.Time() == 0 || sim.Time()%sim.LogFrequency() == 0 || sim.Stopped() {
+			sim.WriteStatus(c)
+		} else {
+			for range c {
+			}
+		}
+		wg2.Done()
+	}()
+	go func() {
+		if sim.Time() == 0 || sim.Time()%sim.LogFrequency() == 0 || sim.Stopped() {
+			sim.WriteGenotypeFreq(d)
+		} else {
+			for range d {
+			}
+		}
+		wg2.Done()
+	}()
+	wg2.Wait()
+}
+
+// Process runs the internal evolution simulation in each host.
+// During intrahost evolution, if new mutations appear, the new sequence
+// and ancestry is recorded to file.
+func (sim *CompartmentalSimulation) Process(t int) {
+	c := make(chan MutationPackage)
+	var wg sync.WaitGroup
+	// Read all hosts and process based on the current status of the host
+	for hostID, host := range sim.HostMap() {
+		// Run the intrahost process asynchronously depending on the
+		// current status of the host.
+		wg.Add(1)
+		compartment := sim.model.Compartment(sim.HostStatus(hostID))
+		switch {
+		case compartment != nil && compartment.Infected:
+			go sim.InfectedProcess(sim.InstanceID(), t, host, c, &wg)
+		case compartment != nil && !compartment.Infectable:
+			go sim.RemovedProcess(sim.InstanceID(), t, host, &wg)
+		default:
+			go sim.SusceptibleProcess(sim.InstanceID(), t, host, &wg)
+		}
+		// Decrement host timer.
+		// If status depends on timer, then timer will go positive integer
+		// to 0.
+		// If status is not dependent on timer, then will just decrement
+		// from -1 to more negative values
+		sim.SetHostTimer(hostID, sim.HostTimer(hostID)-1)
+	}
+	go func() {
+		wg.Wait()
+		close(c)
+	}()
+	// Write mutations to DataLogger
+	sim.WriteMutations(c)
+}
+
+// Transmit facilitates the sampling and migration process of pathogens
+// between hosts.
+func (sim *CompartmentalSimulation) Transmit(t int) {
+	c := make(chan TransmissionEvent)
+	d := make(chan TransmissionPackage)
+	var wg sync.WaitGroup
+	// Get hosts that can transmit and determine pathogen pop size
+	// Only hosts in a transmitting compartment can transmit
+	var transmittingHosts []Host
+	var pathogenPopSizes []int
+	for hostID, host := range sim.HostMap() {
+		if compartment := sim.model.Compartment(sim.HostStatus(hostID)); compartment != nil && compartment.Transmits {
+			transmittingHosts = append(transmittingHosts, host)
+			pathogenPopSizes = append(pathogenPopSizes, host.PathogenPopSize())
+		}
+	}
+	// Iterate using pre-assembled list of transmitting hosts
+	for i, host := range transmittingHosts {
+		// Iterate over host's contacts and create a new goroutine
+		// that determines whether pathogens transmit or not
+		hostID := host.ID()
+		count := pathogenPopSizes[i]
+		numMigrants := host.GetTransmissionModel().TransmissionSize(sim.Rand(t, transmitStream, hostID))
+		age := t - sim.InfectionTime(hostID)
+		transmissionProb := host.GetTransmissionModel().TransmissionProb(count, age)
+		weights := transmissionWeights(host.GetTransmissionModel(), host.Pathogens())
+		for _, neighbor := range sim.HostContacts(t, hostID) {
+			status := sim.HostStatus(neighbor.ID())
+			// Overrides default transmission prob set in the config file
+			if w := sim.HostConnection(hostID, neighbor.ID()); w > 0 {
+				transmissionProb = connectionTransmissionProb(host.GetTransmissionModel(), w, count, age)
+			}
+			for _, infectableStatus := range sim.InfectableStatuses() {
+				if status == infectableStatus {
+					wg.Add(1)
+					// Recovered and vaccinated hosts may be partially protected
+					prob := transmissionProb * infectionProb(neighbor, status)
+					go TransmitPathogens(sim.Rand(t, transmitStream, hostID, neighbor.ID()), sim.InstanceID(), t, host, neighbor, numMigrants, prob, count, weights, c, d, &wg)
+				}
+			}
+		}
+	}
+	go func() {
+		wg.Wait()
+		close(c)
+		close(d)
+	}()
+	// Add the new pathogen to the destination host
+	// and record
+	var wg2 sync.WaitGroup
+	wg2.Add(2)
+	// Pathogens are added only after all transmissions are decided so that
+	// pathogens picked from a host do not depend on goroutine scheduling
+	var events []TransmissionEvent
+	go func() {
+		for t := range c {
+			events = append(events, t)
+		}
+		wg2.Done()
+	}()
+	go func() {
+		if sim.LogTransmission() {
+			sim.WriteTransmission(d)
+		} else {
+			for range d {
+			}
+		}
+		wg2.Done()
+	}()
+	wg2.Wait()
+	infectHosts(sim, t, events)
+}
@@ -0,0 +1,223 @@
+package contagiongo
+
+import (
+	"sync"
+
+	"github.com/segmentio/ksuid"
+)
+
+// SEIRSSimulation creates and runs an SEIRS epidemiological simulation.
+// Within this simulation, hosts may or may not run
+// independent genetic evolution simulations.
+// Infective hosts recover once the infective duration has elapsed
+// and return to the susceptible status after the recovered duration.
+type SEIRSSimulation struct {
+	EpidemicSimulation
+}
+
+// NewSEIRSSimulation creates a new SEIRS simulation.
+func NewSEIRSSimulation(config Config, logger DataLogger) (*SEIRSSimulation, error) {
+	sim := new(SEIRSSimulation)
+	var err error
+	sim.EpidemicSimulation, err = NewSEISimulation(config, logger)
+	if err != nil {
+		return nil, err
+	}
+	return sim, nil
+}
+
+// Run instantiates, runs, and records the a new simulation.
+func (sim *SEIRSSimulation) Run(i int) {
+	runEpidemic(sim, i)
+}
+
+// Update looks at the timer or internal state to decide if
+// the status of the host remains the same of will change.
+// After the status updates, each host's status is recorded to file.
+func (sim *SEIRSSimulation) Update(t int) {
+	// Update status first
+	c := make(chan StatusPackage)
+	d := make(chan GenotypeFreqPackage)
+	var wg sync.WaitGroup
+	// Read all hosts and process hosts concurrently
+	// These succeeding steps connects the simulation's record of
+	// each host's status and timer with the host's internal state.
+	for hostID, host := range sim.HostMap() {
+		// Simulation-level record of status and timer of particular host
+		timer := sim.HostTimer(hostID)
+		pack := StatusPackage{
+			instanceID: sim.InstanceID(),
+			genID:      t,
+			hostID:     hostID,
+			status:     sim.HostStatus(hostID), // current host status before checking
+		}
+		wg.Add(1)
+		go func(i, t int, host Host, timer int, pack StatusPackage, c chan<- StatusPackage, d chan<- GenotypeFreqPackage, wg *sync.WaitGroup) {
+			defer wg.Done()
+			r := sim.Rand(t, updateStream, host.ID())
+			// Add cases depending on the compartmental model being used
+			// In this case, SEIRS uses susceptible, exposed, infective and
+			// recovered statuses
+			switch pack.status {
+			case SusceptibleStatusCode:
+				// Use timer or number of pathogens
+				if timer == 0 || host.PathogenPopSize() > 0 {
+					// Set new host status
+					newStatus := ExposedStatusCode
+					newDuration := host.GetIntrahostModel().StatusDuration(r, newStatus)
+					sim.SetHostStatus(host.ID(), newStatus)
+					sim.SetHostTimer(host.ID(), newDuration)
+					// Update status in pack and send
+					pack.status = newStatus
+				}
+			case ExposedStatusCode:
+				if host.PathogenPopSize() == 0 || ClearanceThresholdReached(host) {
+					// Infection was cleared before the host became infective.
+					// Host goes back to being susceptible
+					newStatus := SusceptibleStatusCode
+					newDuration := -1
+					sim.SetHostStatus(host.ID(), newStatus)
+					sim.SetHostTimer(host.ID(), newDuration)
+					// Update status in pack and send
+					pack.status = newStatus
+				} else if timer == 0 || InfectiveThresholdReached(host) {
+					// Set new host status
+					newStatus := InfectiveStatusCode
+					newDuration := host.GetIntrahostModel().StatusDuration(r, newStatus)
+					sim.SetHostStatus(host.ID(), newStatus)
+					sim.SetHostTimer(host.ID(), newDuration)
+					// Update status in pack and send
+					pack.status = newStatus
+				}
+			case InfectiveStatusCode:
+				if timer == 0 || host.PathogenPopSize() == 0 || ClearanceThresholdReached(host) {
+					// Set new host status
+					newStatus := RecoveredStatusCode
+					newDuration := host.GetIntrahostModel().StatusDuration(r, newStatus)
+					sim.SetHostStatus(host.ID(), newStatus)
+					sim.SetHostTimer(host.ID(), newDuration)
+					// Update status in pack and send
+					pack.status = newStatus
+					host.RemoveAllPathogens()
+				}
+			case RecoveredStatusCode:
+				// Reinfected hosts become exposed again
+				if host.PathogenPopSize() > 0 {
+					newStatus := ExposedStatusCode
+					newDuration := host.GetIntrahostModel().StatusDuration(r, newStatus)
+					sim.SetHostStatus(host.ID(), newStatus)
+					sim.SetHostTimer(host.ID(), newDuration)
+					// Update status in pack and send
+					pack.status = newStatus
+				} else if timer == 0 {
+					// Set new host status
+					newStatus := SusceptibleStatusCode
+					newDuration := -1 // Immunity wanes and host becomes susceptible again
+					sim.SetHostStatus(host.ID(), newStatus)
+					sim.SetHostTimer(host.ID(), newDuration)
+					// Update status in pack and send
+					pack.status = newStatus
+				}
+			case VaccinatedStatusCode:
+				if host.PathogenPopSize() > 0 {
+					// Vaccinated hosts that were infected become exposed
+					newStatus := ExposedStatusCode
+					newDuration := host.GetIntrahostModel().StatusDuration(r, newStatus)
+					sim.SetHostStatus(host.ID(), newStatus)
+					sim.SetHostTimer(host.ID(), newDuration)
+					// Update status in pack and send
+					pack.status = newStatus
+				} else if timer == 0 {
+					// Set new host status
+					newStatus := SusceptibleStatusCode
+					newDuration := -1 // Vaccine-induced immunity wanes
+					sim.SetHostStatus(host.ID(), newStatus)
+					sim.SetHostTimer(host.ID(), newDuration)
+					// Update status in pack and send
+					pack.status = newStatus
+				}
+			}
+			// Send pack after all changes
+			c <- pack
+			// Record pathogen frequencies
+			counts := make(map[ksuid.KSUID]int)
+			for _, p := range host.Pathogens() {
+				counts[p.GenotypeUID()]++
+			}
+			for uid, freq := range counts {
+				d <- GenotypeFreqPackage{
+					instanceID: i,
+					genID:      t,
+					hostID:     host.ID(),
+					genotypeID: uid,
+					freq:       freq,
+				}
+			}
+		}(sim.InstanceID(), t, host, timer, pack, c, d, &wg)
+	}
+	go func() {
+		wg.Wait()
+		close(c)
+		close(d)
+	}()
+	// Write status  and genotype frequencies using DataLogger
+	var wg2 sync.WaitGroup
+	wg2.Add(2)
+	go func() {
+		if sim.Time() == 0 || sim.Time()%sim.LogFrequency() == 0 || sim.Stopped() {
+			sim.WriteStatus(c)
+		} else {
+			for range c {
+			}
+		}
+		wg2.Done()
+	}()
+	go func() {
+		if sim.Time() == 0 || sim.Time()%sim.LogFrequency() == 0 || sim.Stopped() {
+			sim.WriteGenotypeFreq(d)
+		} else {
+			for range d {
+			}
+		}
+		wg2.Done()
+	}()
+	wg2.Wait()
+}
+
+// Process runs the internal evolution simulation in each host.
+// During intrahost evolution, if new mutations appear, the new sequence
+// and ancestry is recorded to file.
+func (sim *SEIRSSimulation) Process(t int) {
+	c := make(chan MutationPackage)
+	var wg sync.WaitGroup
+	// Read all hosts and process based on the current status of the host
+	for hostID, host := range sim.HostMap() {
+		// Run the intrahost process asynchronously depending on the
+		// current status of the host.
+		wg.Add(1)
+		switch sim.HostStatus(hostID) {
+		case SusceptibleStatusCode:
+			go sim.SusceptibleProcess(sim.InstanceID(), t, host, &wg)
+		case ExposedStatusCode:
+			go sim.ExposedProcess(sim.InstanceID(), t, host, c, &wg)
+		case InfectiveStatusCode:
+			go sim.InfectiveProcess(sim.InstanceID(), t, host, c, &wg)
+		case RecoveredStatusCode:
+			go sim.RecoveredProcess(sim.InstanceID(), t, host, &wg)
+		case VaccinatedStatusCode:
+			go sim.VaccinatedProcess(sim.InstanceID(), t, host, &wg)
+		}
+		// Decrement host timer.
+		// If status depends on timer, then timer will go positive integer
+		// to 0.
+		// If status is not dependent on timer, then will just decrement
+		// from -1 to more negative values
+		sim.SetHostTimer(hostID, sim.HostTimer(hostID)-1)
+	}
+	go func() {
+		wg.Wait()
+		close(c)
+	}()
+	// Write mutations to DataLogger
+	sim.WriteMutations(c)
+}
@@ -1,11 +1,8 @@
 package contagiongo
 
 import (
-	"fmt"
 	"log"
-	"strings"
 	"sync"
-	"time"
 
 	"github.com/segmentio/ksuid"
 )
@@ -23,6 +20,9 @@ type SISimulation struct {
 	logFreq         int
 	stopped         bool
 	logTransmission bool
+	checkpointFreq  int
+	logPath         string
+	configPath      string
 }
 
 // NewSISimulation creates a new SI simulation.
@@ -37,6 +37,9 @@ func NewSISimulation(config Config, logger DataLogger) (*SISimulation, error) {
 	sim.numGenerations = config.NumGenerations()
 	sim.logFreq = config.LogFreq()
 	sim.logTransmission = config.LogTransmission()
+	sim.checkpointFreq = config.CheckpointFreq()
+	sim.logPath = config.LogPath()
+	sim.configPath = config.ConfigPath()
 	return sim, nil
 }
 
@@ -107,75 +110,27 @@ func (sim *SISimulation) Stopped() bool {
 	return sim.stopped
 }
 
+// CheckpointFreq returns the number of pathogen generations between
+// checkpoints. Returns 0 if checkpointing is disabled.
+func (sim *SISimulation) CheckpointFreq() int {
+	return sim.checkpointFreq
+}
+
+// CheckpointPath returns the path where the checkpoint of the current
+// realized simulation is saved.
+func (sim *SISimulation) CheckpointPath() string {
+	return CheckpointPath(sim.logPath, sim.instanceID)
+}
+
+// ConfigPath returns the path of the configuration file used to create
+// the simulation.
+func (sim *SISimulation) ConfigPath() string {
+	return sim.configPath
+}
+
 // Run instantiates, runs, and records the a new simulation.
 func (sim *SISimulation) Run(i int) {
-	sim.Initialize()
-	sim.SetInstanceID(i)
-	// Initial state
-	sim.Update(0)
-
-	sim.SetTime(0)
-	var maxElapsed int64
-	// First five generations generation initializes time
-	for sim.Time() < 6 {
-		sim.SetTime(sim.Time() + 1)
-		fmt.Printf(" instance %04d\tgeneration %05d\n", i, sim.Time())
-		start := time.Now()
-		sim.Process(sim.Time())
-		sim.Transmit(sim.Time())
-		// Check conditions before update
-		stop := sim.StopSimulation()
-		if stop {
-			sim.SetStopped(true)
-		}
-		// Update after condition. If stop, will override logging setting
-		// and log last generation
-		sim.Update(sim.Time())
-		// Check time elapsed
-		if elapsed := time.Since(start).Nanoseconds(); elapsed > maxElapsed {
-			maxElapsed = elapsed
-		}
-		// Feedback that simulation is stopping
-		if stop {
-			fmt.Printf(" [stop]       \tgeneration %05d\tstop condition triggered\n", sim.Time())
-			break
-		}
-	}
-	if !sim.Stopped() {
-		fmt.Printf(" \t\texpected time: %fms per generation\n", float64(maxElapsed)/1e6)
-	}
-	for sim.Time() < sim.NumGenerations() && !sim.Stopped() {
-		sim.SetTime(sim.Time() + 1)
-		// Print only every ten steps is time is short
-		if maxElapsed < 0.02e9 {
-			if sim.Time()%100 == 0 {
-				fmt.Printf(" instance %04d\tgeneration %05d\n", i, sim.Time())
-			}
-		} else if maxElapsed < 0.2e9 {
-			if sim.Time()%10 == 0 {
-				fmt.Printf(" instance %04d\tgeneration %05d\n", i, sim.Time())
-			}
-		} else {
-			fmt.Printf(" instance %04d\tgeneration %05d\n", i, sim.Time())
-		}
-		sim.Process(sim.Time())
-		sim.Transmit(sim.Time())
-		// Check conditions before update
-		stop := sim.StopSimulation()
-		if stop {
-			sim.SetStopped(true)
-		}
-		// Update after condition. If stop, will override logging setting
-		// and log last generation
-		sim.Update(sim.Time())
-		// Feedback that simulation is stopping
-		if stop {
-			fmt.Printf(" [stop]       \tgeneration %05d\tstop condition triggered\n", sim.Time())
-			break
-		}
-	}
-	fmt.Println(strings.Repeat("-", 80))
-	sim.Finalize()
+	runEpidemic(sim, i)
 }
 
 // Initialize initializes the simulation and accepts 0 or more parameters.
@@ -210,6 +165,7 @@ func (sim *SISimulation) Update(t int) {
 		wg.Add(1)
 		go func(i, t int, host Host, timer int, pack StatusPackage, c chan<- StatusPackage, d chan<- GenotypeFreqPackage, wg *sync.WaitGroup) {
 			defer wg.Done()
+			r := sim.Rand(t, updateStream, host.ID())
 			// Add cases depending on the compartmental model being used
 			// In this case, SI only uses susceptible and infected statuses
 			switch pack.status {
@@ -218,7 +174,38 @@ func (sim *SISimulation) Update(t int) {
 				if timer == 0 || host.PathogenPopSize() > 0 {
 					// Set new host status
 					newStatus := InfectedStatusCode
-					newDuration := host.GetIntrahostModel().StatusDuration(newStatus)
+					newDuration := host.GetIntrahostModel().StatusDuration(r, newStatus)
+					sim.SetHostStatus(host.ID(), newStatus)
+					sim.SetHostTimer(host.ID(), newDuration)
+					// Update status in pack and send
+					pack.status = newStatus
+				}
+			case InfectedStatusCode:
+				// Infection only ends if the pathogen load falls below the
+				// clearance threshold
+				if ClearanceThresholdReached(host) {
+					// Set new host status
+					newStatus := SusceptibleStatusCode
+					newDuration := -1 // Host goes back to being susceptible
+					sim.SetHostStatus(host.ID(), newStatus)
+					sim.SetHostTimer(host.ID(), newDuration)
+					// Update status in pack and send
+					pack.status = newStatus
+					host.RemoveAllPathogens()
+				}
+			case VaccinatedStatusCode:
+				if host.PathogenPopSize() > 0 {
+					// Vaccinated hosts that were infected become infected
+					newStatus := InfectedStatusCode
+					newDuration := host.GetIntrahostModel().StatusDuration(r, newStatus)
+					sim.SetHostStatus(host.ID(), newStatus)
+					sim.SetHostTimer(host.ID(), newDuration)
+					// Update status in pack and send
+					pack.status = newStatus
+				} else if timer == 0 {
+					// Set new host status
+					newStatus := SusceptibleStatusCode
+					newDuration := -1 // Vaccine-induced immunity wanes
 					sim.SetHostStatus(host.ID(), newStatus)
 					sim.SetHostTimer(host.ID(), newDuration)
 					// Update status in pack and send
@@ -288,6 +275,8 @@ func (sim *SISimulation) Process(t int) {
 			go sim.SusceptibleProcess(sim.InstanceID(), t, host, &wg)
 		case InfectedStatusCode:
 			go sim.InfectedProcess(sim.InstanceID(), t, host, c, &wg)
+		case VaccinatedStatusCode:
+			go sim.VaccinatedProcess(sim.InstanceID(), t, host, &wg)
 		}
 		// Decrement host timer.
 		// If status depends on timer, then timer will go positive integer
@@ -322,22 +311,26 @@ func (sim *SISimulation) Transmit(t int) {
 	}
 	// Iterate using pre-assembled list of infected hosts
 	for i, host := range infectedHosts {
-		// Iterate over host's neighbors and create a new goroutine
+		// Iterate over host's contacts and create a new goroutine
 		// that determines whether pathogens transmit or not
 		hostID := host.ID()
 		count := pathogenPopSizes[i]
-		numMigrants := host.GetTransmissionModel().TransmissionSize()
-		transmissionProb := host.GetTransmissionModel().TransmissionProb()
-		for _, neighbor := range sim.HostNeighbors(hostID) {
+		numMigrants := host.GetTransmissionModel().TransmissionSize(sim.Rand(t, transmitStream, hostID))
+		age := t - sim.InfectionTime(hostID)
+		transmissionProb := host.GetTransmissionModel().TransmissionProb(count, age)
+		weights := transmissionWeights(host.GetTransmissionModel(), host.Pathogens())
+		for _, neighbor := range sim.HostContacts(t, hostID) {
 			status := sim.HostStatus(neighbor.ID())
 			// Overrides default transmission prob set in the config file
-			if t := sim.HostConnection(hostID, neighbor.ID()); t > 0 {
-				transmissionProb = t
+			if w := sim.HostConnection(hostID, neighbor.ID()); w > 0 {
+				transmissionProb = connectionTransmissionProb(host.GetTransmissionModel(), w, count, age)
 			}
 			for _, infectableStatus := range sim.InfectableStatuses() {
 				if status == infectableStatus {
 					wg.Add(1)
-					go TransmitPathogens(sim.InstanceID(), t, host, neighbor, numMigrants, transmissionProb, count, c, d, &wg)
+					// Recovered and vaccinated hosts may be partially protected
+					prob := transmissionProb * infectionProb(neighbor, status)
+					go TransmitPathogens(sim.Rand(t, transmitStream, hostID, neighbor.ID()), sim.InstanceID(), t, host, neighbor, numMigrants, prob, count, weights, c, d, &wg)
 				}
 			}
 		}
@@ -351,9 +344,12 @@ func (sim *SISimulation) Transmit(t int) {
 	// and record
 	var wg2 sync.WaitGroup
 	wg2.Add(2)
+	// Pathogens are added only after all transmissions are decided so that
+	// pathogens picked from a host do not depend on goroutine scheduling
+	var events []TransmissionEvent
 	go func() {
 		for t := range c {
-			t.destination.AddPathogens(t.pathogen)
+			events = append(events, t)
 		}
 		wg2.Done()
 	}()
@@ -367,6 +363,7 @@ func (sim *SISimulation) Transmit(t int) {
 		wg2.Done()
 	}()
 	wg2.Wait()
+	infectHosts(sim, t, events)
 }
 
 // Finalize performs processes to finish and close the simulation.
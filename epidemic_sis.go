@@ -1,10 +1,7 @@
 package contagiongo
 
 import (
-	"fmt"
-	"strings"
 	"sync"
-	"time"
 
 	"github.com/segmentio/ksuid"
 )
@@ -29,73 +26,7 @@ func NewSISSimulation(config Config, logger DataLogger) (*SISSimulation, error)
 
 // Run instantiates, runs, and records the a new simulation.
 func (sim *SISSimulation) Run(i int) {
-	sim.Initialize()
-	sim.SetInstanceID(i)
-	// Initial state
-	sim.Update(0)
-
-	sim.SetTime(0)
-	var maxElapsed int64
-	// First five generations generation initializes time
-	for sim.Time() < 6 {
-		sim.SetTime(sim.Time() + 1)
-		fmt.Printf(" instance %04d\tgeneration %05d\n", i, sim.Time())
-		start := time.Now()
-		sim.Process(sim.Time())
-		sim.Transmit(sim.Time())
-		// Check conditions before update
-		stop := sim.StopSimulation()
-		if stop {
-			sim.SetStopped(true)
-		}
-		// Update after condition. If stop, will override logging setting
-		// and log last generation
-		sim.Update(sim.Time())
-		// Check time elapsed
-		if elapsed := time.Since(start).Nanoseconds(); elapsed > maxElapsed {
-			maxElapsed = elapsed
-		}
-		// Feedback that simulation is stopping
-		if stop {
-			fmt.Printf(" [stop]       \tgeneration %05d\tstop condition triggered\n", sim.Time())
-			break
-		}
-	}
-	if !sim.Stopped() {
-		fmt.Printf(" \t\texpected time: %fms per generation\n", float64(maxElapsed)/1e6)
-	}
-	for sim.Time() < sim.NumGenerations() && !sim.Stopped() {
-		sim.SetTime(sim.Time() + 1)
-		// Print only every ten steps is time is short
-		if maxElapsed < 0.02e9 {
-			if sim.Time()%100 == 0 {
-				fmt.Printf(" instance %04d\tgeneration %05d\n", i, sim.Time())
-			}
-		} else if maxElapsed < 0.2e9 {
-			if sim.Time()%10 == 0 {
-				fmt.Printf(" instance %04d\tgeneration %05d\n", i, sim.Time())
-			}
-		} else {
-			fmt.Printf(" instance %04d\tgeneration %05d\n", i, sim.Time())
-		}
-		sim.Process(sim.Time())
-		sim.Transmit(sim.Time())
-		// Check conditions before update
-		stop := sim.StopSimulation()
-		if stop {
-			sim.SetStopped(true)
-		}
-		// Update after condition. If stop, will override logging setting
-		// and log last generation
-		sim.Update(sim.Time())
-		// Feedback that simulation is stopping
-		if stop {
-			fmt.Printf(" [stop]       \tgeneration %05d\tstop condition triggered\n", sim.Time())
-			break
-		}
-	}
-	fmt.Println(strings.Repeat("-", 80))
-	sim.Finalize()
+	runEpidemic(sim, i)
 }
 
 // Update looks at the timer or internal state to decide if
@@ -121,6 +52,7 @@ func (sim *SISSimulation) Update(t int) {
 		wg.Add(1)
 		go func(i, t int, host Host, timer int, pack StatusPackage, c chan<- StatusPackage, d chan<- GenotypeFreqPackage, wg *sync.WaitGroup) {
 			defer wg.Done()
+			r := sim.Rand(t, updateStream, host.ID())
 			// Add cases depending on the compartmental model being used
 			// In this case, SI only uses susceptible and infected statuses
 			switch pack.status {
@@ -129,7 +61,7 @@ func (sim *SISSimulation) Update(t int) {
 				if timer == 0 || host.PathogenPopSize() > 0 {
 					// Set new host status
 					newStatus := InfectedStatusCode
-					newDuration := host.GetIntrahostModel().StatusDuration(newStatus)
+					newDuration := host.GetIntrahostModel().StatusDuration(r, newStatus)
 					sim.SetHostStatus(host.ID(), newStatus)
 					sim.SetHostTimer(host.ID(), newDuration)
 					// sim.SetHostTimer(host.ID(), newDuration)
@@ -137,7 +69,7 @@ func (sim *SISSimulation) Update(t int) {
 					pack.status = newStatus
 				}
 			case InfectedStatusCode:
-				if timer == 0 || host.PathogenPopSize() == 0 {
+				if timer == 0 || host.PathogenPopSize() == 0 || ClearanceThresholdReached(host) {
 					// Set new host status
 					newStatus := SusceptibleStatusCode
 					newDuration := -1 // Host goes back to being susceptible
@@ -147,6 +79,24 @@ func (sim *SISSimulation) Update(t int) {
 					pack.status = newStatus
 					host.RemoveAllPathogens()
 				}
+			case VaccinatedStatusCode:
+				if host.PathogenPopSize() > 0 {
+					// Vaccinated hosts that were infected become infected
+					newStatus := InfectedStatusCode
+					newDuration := host.GetIntrahostModel().StatusDuration(r, newStatus)
+					sim.SetHostStatus(host.ID(), newStatus)
+					sim.SetHostTimer(host.ID(), newDuration)
+					// Update status in pack and send
+					pack.status = newStatus
+				} else if timer == 0 {
+					// Set new host status
+					newStatus := SusceptibleStatusCode
+					newDuration := -1 // Vaccine-induced immunity wanes
+					sim.SetHostStatus(host.ID(), newStatus)
+					sim.SetHostTimer(host.ID(), newDuration)
+					// Update status in pack and send
+					pack.status = newStatus
+				}
 			}
 			// Send pack after all changes
 			c <- pack
@@ -211,6 +161,8 @@ func (sim *SISSimulation) Process(t int) {
 			go sim.SusceptibleProcess(sim.InstanceID(), t, host, &wg)
 		case InfectedStatusCode:
 			go sim.InfectedProcess(sim.InstanceID(), t, host, c, &wg)
+		case VaccinatedStatusCode:
+			go sim.VaccinatedProcess(sim.InstanceID(), t, host, &wg)
 		}
 		// Decrement host timer.
 		// If status depends on timer, then timer will go positive integer
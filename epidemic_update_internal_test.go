@@ -0,0 +1,134 @@
+package contagiongo
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+type updateTest struct {
+	desc               string
+	status             int
+	timer              int
+	pathogens          int
+	infectiveThreshold int
+	clearanceThreshold int
+	output             int
+	outputTimer        int
+}
+
+var sirsUpdateTests = []updateTest{
+	{"susceptible receives pathogens", SusceptibleStatusCode, -1, 3, 0, 0, InfectedStatusCode, 6},
+	{"infected timer runs out", InfectedStatusCode, 0, 5, 0, 0, RecoveredStatusCode, 5},
+	{"infected clears pathogens", InfectedStatusCode, 2, 0, 0, 0, RecoveredStatusCode, 5},
+	{"infected below clearance threshold", InfectedStatusCode, 2, 2, 0, 3, RecoveredStatusCode, 5},
+	{"infected above clearance threshold", InfectedStatusCode, 2, 5, 0, 3, InfectedStatusCode, 2},
+	{"recovered immunity wanes", RecoveredStatusCode, 0, 0, 0, 0, SusceptibleStatusCode, -1},
+	{"recovered immunity remains", RecoveredStatusCode, 2, 0, 0, 0, RecoveredStatusCode, 2},
+	{"recovered is reinfected", RecoveredStatusCode, 2, 3, 0, 0, InfectedStatusCode, 6},
+}
+
+var seiUpdateTests = []updateTest{
+	{"susceptible receives pathogens", SusceptibleStatusCode, -1, 3, 0, 0, ExposedStatusCode, 4},
+	{"exposed clears pathogens", ExposedStatusCode, 2, 0, 0, 0, SusceptibleStatusCode, -1},
+	{"exposed below clearance threshold", ExposedStatusCode, 2, 2, 0, 3, SusceptibleStatusCode, -1},
+	{"exposed timer runs out", ExposedStatusCode, 0, 5, 0, 0, InfectiveStatusCode, 6},
+	{"exposed reaches infective threshold", ExposedStatusCode, 2, 5, 5, 0, InfectiveStatusCode, 6},
+	{"exposed below infective threshold", ExposedStatusCode, 2, 4, 5, 0, ExposedStatusCode, 2},
+	{"infective below clearance threshold", InfectiveStatusCode, 2, 2, 0, 3, SusceptibleStatusCode, -1},
+	{"infective without clearance threshold", InfectiveStatusCode, 0, 5, 0, 0, InfectiveStatusCode, 0},
+}
+
+var seirUpdateTests = []updateTest{
+	{"susceptible receives pathogens", SusceptibleStatusCode, -1, 3, 0, 0, ExposedStatusCode, 4},
+	{"exposed clears pathogens", ExposedStatusCode, 2, 0, 0, 0, SusceptibleStatusCode, -1},
+	{"exposed below clearance threshold", ExposedStatusCode, 2, 2, 0, 3, SusceptibleStatusCode, -1},
+	{"exposed timer runs out", ExposedStatusCode, 0, 5, 0, 0, InfectiveStatusCode, 6},
+	{"exposed reaches infective threshold", ExposedStatusCode, 2, 5, 5, 0, InfectiveStatusCode, 6},
+	{"exposed below infective threshold", ExposedStatusCode, 2, 4, 5, 0, ExposedStatusCode, 2},
+	{"infective timer runs out", InfectiveStatusCode, 0, 5, 0, 0, RemovedStatusCode, -1},
+	{"infective below clearance threshold", InfectiveStatusCode, 2, 2, 0, 3, RemovedStatusCode, -1},
+	{"removed has no transitions", RemovedStatusCode, 0, 3, 0, 0, RemovedStatusCode, 0},
+}
+
+var seirsUpdateTests = []updateTest{
+	{"susceptible receives pathogens", SusceptibleStatusCode, -1, 3, 0, 0, ExposedStatusCode, 4},
+	{"exposed clears pathogens", ExposedStatusCode, 2, 0, 0, 0, SusceptibleStatusCode, -1},
+	{"exposed below clearance threshold", ExposedStatusCode, 2, 2, 0, 3, SusceptibleStatusCode, -1},
+	{"exposed timer runs out", ExposedStatusCode, 0, 5, 0, 0, InfectiveStatusCode, 6},
+	{"exposed reaches infective threshold", ExposedStatusCode, 2, 5, 5, 0, InfectiveStatusCode, 6},
+	{"infective timer runs out", InfectiveStatusCode, 0, 5, 0, 0, RecoveredStatusCode, 5},
+	{"infective below clearance threshold", InfectiveStatusCode, 2, 2, 0, 3, RecoveredStatusCode, 5},
+	{"recovered immunity wanes", RecoveredStatusCode, 0, 0, 0, 0, SusceptibleStatusCode, -1},
+	{"recovered is reinfected", RecoveredStatusCode, 2, 3, 0, 0, ExposedStatusCode, 4},
+}
+
+// testUpdate sets the status, timer and pathogens of a new host for every
+// test case and checks its status and timer after Update.
+func testUpdate(t *testing.T, newSimulation func(Config, DataLogger) (EpidemicSimulation, error), tests []updateTest) {
+	dir, err := ioutil.TempDir("", "contagion")
+	if err != nil {
+		t.Fatalf(UnexpectedErrorWhileError, "creating temporary directory", err)
+	}
+	defer os.RemoveAll(dir)
+	conf := loadTestConfig(t, dir, "")
+	sim, err := newSimulation(conf, new(NullLogger))
+	if err != nil {
+		t.Fatalf(UnexpectedErrorWhileError, "creating simulation", err)
+	}
+	tree := EmptyGenotypeTree()
+	r := NewRand(0)
+	hostID := len(sim.HostMap())
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			model := new(ConstantPopModel)
+			model.statusDuration = map[int]int{
+				ExposedStatusCode:   4,
+				InfectedStatusCode:  6,
+				InfectiveStatusCode: 6,
+				RecoveredStatusCode: 5,
+			}
+			model.infectiveThreshold = tt.infectiveThreshold
+			model.clearanceThreshold = tt.clearanceThreshold
+			host := EmptySequenceHost(hostID)
+			host.SetIntrahostModel(model)
+			for i := 0; i < tt.pathogens; i++ {
+				host.AddPathogens(tree.NewNode(newNodeUID(r), []uint8{0, 1, 0}, 0))
+			}
+			sim.AddHost(host)
+			defer sim.RemoveHost(hostID)
+			sim.SetHostStatus(hostID, tt.status)
+			sim.SetHostTimer(hostID, tt.timer)
+
+			sim.Update(1)
+			status, timer := sim.HostStatus(hostID), sim.HostTimer(hostID)
+			if status != tt.output || timer != tt.outputTimer {
+				t.Errorf("expected status %d and timer %d, got %d and %d instead", tt.output, tt.outputTimer, status, timer)
+			}
+		})
+	}
+}
+
+func TestSIRSSimulation_Update(t *testing.T) {
+	testUpdate(t, func(conf Config, logger DataLogger) (EpidemicSimulation, error) {
+		return NewSIRSSimulation(conf, logger)
+	}, sirsUpdateTests)
+}
+
+func TestSEISimulation_Update(t *testing.T) {
+	testUpdate(t, func(conf Config, logger DataLogger) (EpidemicSimulation, error) {
+		return NewSEISimulation(conf, logger)
+	}, seiUpdateTests)
+}
+
+func TestSEIRSimulation_Update(t *testing.T) {
+	testUpdate(t, func(conf Config, logger DataLogger) (EpidemicSimulation, error) {
+		return NewSEIRSimulation(conf, logger)
+	}, seirUpdateTests)
+}
+
+func TestSEIRSSimulation_Update(t *testing.T) {
+	testUpdate(t, func(conf Config, logger DataLogger) (EpidemicSimulation, error) {
+		return NewSEIRSSimulation(conf, logger)
+	}, seirsUpdateTests)
+}
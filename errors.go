@@ -101,6 +101,18 @@ func RemovedDurationTooLongError(intervalDuration int, conditionValue int) error
 	return DurationTooLongError("removed_duration", intervalDuration, "number of generations", conditionValue)
 }
 
+// RecoveredDurationTooLongError indicates that the duration in the
+// recovered state is too long.
+func RecoveredDurationTooLongError(intervalDuration int, conditionValue int) error {
+	return DurationTooLongError("recovered_duration", intervalDuration, "number of generations", conditionValue)
+}
+
+// DurationNotSetError indicates that the duration of a particular interval
+// must be at least 1 generation long.
+func DurationNotSetError(interval string, intervalDuration int) error {
+	return fmt.Errorf("%s (%d) is less than 1", interval, intervalDuration)
+}
+
 // Errors related to model assignment
 
 // ModelExistsError indicates that an existing model already exists
@@ -312,6 +324,24 @@ func IntKeyExists(key int) error {
 	return fmt.Errorf("key %d already exists", key)
 }
 
+// HostIDsOutOfRangeError indicates that the listed host IDs used by
+// the source are not between 0 and popSize-1.
+func HostIDsOutOfRangeError(source string, ids []int, popSize int) error {
+	return fmt.Errorf("%s uses %d host IDs outside of host_popsize (0 to %d): %v", source, len(ids), popSize-1, ids)
+}
+
+// DuplicateHostIDsError indicates that the listed host IDs were
+// assigned to more than one model of the same kind.
+func DuplicateHostIDsError(kind string, ids []int) error {
+	return fmt.Errorf("%d host IDs are assigned to more than one %s: %v", len(ids), kind, ids)
+}
+
+// UnassignedHostIDsError indicates that the listed host IDs were
+// not assigned to any model of the given kind.
+func UnassignedHostIDsError(kind string, ids []int) error {
+	return fmt.Errorf("%d host IDs are not assigned a %s: %v", len(ids), kind, ids)
+}
+
 // IntKeyNotFoundError indicates that the given integer key does not exist.
 func IntKeyNotFoundError(key int) error {
 	return fmt.Errorf("key %d not found", key)
@@ -2,7 +2,7 @@ package contagiongo
 
 import (
 	"fmt"
-	"math/rand"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -18,6 +18,8 @@ type Config interface {
 	LogFreq() int
 	LogPath() string
 	LogTransmission() bool
+	CheckpointFreq() int
+	ConfigPath() string
 }
 
 // EvoEpiConfig contains parameters to create a simulated infection
@@ -29,29 +31,142 @@ type EvoEpiConfig struct {
 	FitnessModels      []*fitnessModelConfig   `toml:"fitness_model"`
 	TransmissionModels []*transModelConfig     `toml:"transmission_model"`
 	StopConditions     []*stopConditionConfig  `toml:"stop_condition"`
+	Compartments       []*compartmentConfig    `toml:"compartment"`
+	Transitions        []*transitionConfig     `toml:"transition"`
+	Sweep              *sweepConfig            `toml:"sweep"`
+	ABC                *abcConfig              `toml:"abc"`
+	Network            *networkConfig          `toml:"network"`
+	Interventions      []*interventionConfig   `toml:"intervention"`
+	Demography         *demographyConfig       `toml:"demography"`
+	Metapopulation     *metapopulationConfig   `toml:"metapopulation"`
 
-	validated bool
+	hostAttributes *HostAttributes
+	path           string
+	validated      bool
 }
 
 // Validate checks the validity of the configuration.
 func (c *EvoEpiConfig) Validate() error {
 	// Validate sections
+	// A generated network replaces the network file
+	c.SimParams.generatedNetwork = c.Network != nil
+	// Patches replace the network file
+	c.SimParams.metapopulation = c.Metapopulation != nil
 	err := c.SimParams.Validate()
 	if err != nil {
 		return err
 	}
+	// Load host attributes used to assign types and select hosts
+	c.hostAttributes = nil
+	if len(c.SimParams.HostAttributesPath) > 0 {
+		c.hostAttributes, err = LoadHostAttributes(c.SimParams.HostAttributesPath)
+		if err != nil {
+			return err
+		}
+		if ids := outOfRangeHostIDs(c.hostAttributes.HostIDs(), c.SimParams.HostPopSize); len(ids) > 0 {
+			return HostIDsOutOfRangeError(c.SimParams.HostAttributesPath, ids, c.SimParams.HostPopSize)
+		}
+	}
+	if c.Network != nil {
+		// Assign default value
+		if c.Network.NumNodes == 0 {
+			c.Network.NumNodes = c.SimParams.HostPopSize
+		}
+		err = c.Network.Validate()
+		if err != nil {
+			return err
+		}
+		if c.Network.NumNodes != c.SimParams.HostPopSize {
+			return fmt.Errorf(UnequalIntParameterError, "number of nodes in the generated network", c.SimParams.HostPopSize, c.Network.NumNodes)
+		}
+	}
+	if c.Metapopulation != nil {
+		if c.Network != nil {
+			return fmt.Errorf("a metapopulation cannot be used with a generated network")
+		}
+		err = c.Metapopulation.Validate()
+		if err != nil {
+			return errors.Wrap(err, "invalid metapopulation")
+		}
+		patches, err := LoadPatches(c.Metapopulation.PatchPath)
+		if err != nil {
+			return err
+		}
+		var hostIDs []int
+		for id := range patches {
+			hostIDs = append(hostIDs, id)
+		}
+		if ids := outOfRangeHostIDs(hostIDs, c.SimParams.HostPopSize); len(ids) > 0 {
+			return HostIDsOutOfRangeError(c.Metapopulation.PatchPath, ids, c.SimParams.HostPopSize)
+		}
+		var unassigned []int
+		for i := 0; i < c.SimParams.HostPopSize; i++ {
+			if _, exists := patches[i]; !exists {
+				unassigned = append(unassigned, i)
+			}
+		}
+		if len(unassigned) > 0 {
+			return UnassignedHostIDsError("patch", unassigned)
+		}
+		// Check mobility between patches
+		_, err = c.Metapopulation.CreateMetapopulation()
+		if err != nil {
+			return errors.Wrap(err, "invalid metapopulation")
+		}
+	}
 	err = c.LogParams.Validate()
 	if err != nil {
 		return err
 	}
+	if c.Sweep != nil {
+		err = c.Sweep.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if c.ABC != nil {
+		err = c.ABC.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	// Validate user-defined compartments and transitions
+	if strings.ToLower(c.SimParams.EpidemicModel) == "compartmental" {
+		err = c.validateCompartmentalModel()
+		if err != nil {
+			return errors.Wrapf(err, "cannot create %s model", c.SimParams.EpidemicModel)
+		}
+	}
 	// Validate each intrahost model
-	// Check if host_ids are unique
-	hostIDSet := make(map[int]bool)
+	var hostIDs [][]int
 	for _, model := range c.IntrahostModels {
 		err := model.Validate()
 		if err != nil {
 			return err
 		}
+		// Check if infective motif is within the expected sequence
+		for i, seqRune := range model.InfectiveMotif {
+			if pos := model.InfectiveMotifPos[i]; pos >= c.SimParams.NumSites {
+				return fmt.Errorf("position %d is greater than the last position in the expected sequence (%d)", pos, c.SimParams.NumSites-1)
+			}
+			seqChar := string(seqRune)
+			match := false
+			for _, expChar := range c.SimParams.ExpectedChars {
+				if strings.ToLower(seqChar) == strings.ToLower(expChar) {
+					match = true
+					break
+				}
+			}
+			if !match {
+				return InvalidStateCharError(seqChar, i)
+			}
+		}
+		// Check if epitope is within the expected sequence
+		for _, pos := range model.EpitopePositions {
+			if pos >= c.SimParams.NumSites {
+				return fmt.Errorf("position %d is greater than the last position in the expected sequence (%d)", pos, c.SimParams.NumSites-1)
+			}
+		}
 		// Check if durations match EpidemicModel
 		switch strings.ToLower(c.SimParams.EpidemicModel) {
 		case "si":
@@ -101,9 +216,15 @@ func (c *EvoEpiConfig) Validate() error {
 				)
 				return errors.Wrapf(err, "cannot create %s model", c.SimParams.EpidemicModel)
 			}
-			if model.RemovedDuration > c.SimParams.NumGenerations {
-				err := RemovedDurationTooLongError(
-					model.RemovedDuration,
+			// recovered duration must be set for hosts to become
+			// susceptible again
+			if model.RecoveredDuration < 1 {
+				err := DurationNotSetError("recovered_duration", model.RecoveredDuration)
+				return errors.Wrapf(err, "cannot create %s model", c.SimParams.EpidemicModel)
+			}
+			if model.RecoveredDuration > c.SimParams.NumGenerations {
+				err := RecoveredDurationTooLongError(
+					model.RecoveredDuration,
 					c.SimParams.NumGenerations,
 				)
 				return errors.Wrapf(err, "cannot create %s model", c.SimParams.EpidemicModel)
@@ -116,6 +237,11 @@ func (c *EvoEpiConfig) Validate() error {
 				)
 				return errors.Wrapf(err, "cannot create %s model", c.SimParams.EpidemicModel)
 			}
+			// exposed duration must be set for hosts to become infective
+			if model.ExposedDuration < 1 {
+				err := DurationNotSetError("exposed_duration", model.ExposedDuration)
+				return errors.Wrapf(err, "cannot create %s model", c.SimParams.EpidemicModel)
+			}
 			if model.ExposedDuration > c.SimParams.NumGenerations {
 				err := ExposedDurationTooLongError(
 					model.ExposedDuration,
@@ -135,6 +261,11 @@ func (c *EvoEpiConfig) Validate() error {
 				)
 				return errors.Wrapf(err, "cannot create %s model", c.SimParams.EpidemicModel)
 			}
+			// exposed duration must be set for hosts to become infective
+			if model.ExposedDuration < 1 {
+				err := DurationNotSetError("exposed_duration", model.ExposedDuration)
+				return errors.Wrapf(err, "cannot create %s model", c.SimParams.EpidemicModel)
+			}
 			if model.ExposedDuration > c.SimParams.NumGenerations {
 				err := ExposedDurationTooLongError(
 					model.ExposedDuration,
@@ -154,6 +285,11 @@ func (c *EvoEpiConfig) Validate() error {
 				model.RemovedDuration = c.SimParams.NumGenerations + 1
 			}
 		case "seirs":
+			// exposed duration must be set for hosts to become infective
+			if model.ExposedDuration < 1 {
+				err := DurationNotSetError("exposed_duration", model.ExposedDuration)
+				return errors.Wrapf(err, "cannot create %s model", c.SimParams.EpidemicModel)
+			}
 			if model.ExposedDuration > c.SimParams.NumGenerations {
 				err := ExposedDurationTooLongError(
 					model.ExposedDuration,
@@ -168,9 +304,15 @@ func (c *EvoEpiConfig) Validate() error {
 				)
 				return errors.Wrapf(err, "cannot create %s model", c.SimParams.EpidemicModel)
 			}
-			if model.RemovedDuration > c.SimParams.NumGenerations {
-				err := RemovedDurationTooLongError(
-					model.RemovedDuration,
+			// recovered duration must be set for hosts to become
+			// susceptible again
+			if model.RecoveredDuration < 1 {
+				err := DurationNotSetError("recovered_duration", model.RecoveredDuration)
+				return errors.Wrapf(err, "cannot create %s model", c.SimParams.EpidemicModel)
+			}
+			if model.RecoveredDuration > c.SimParams.NumGenerations {
+				err := RecoveredDurationTooLongError(
+					model.RecoveredDuration,
 					c.SimParams.NumGenerations,
 				)
 				return errors.Wrapf(err, "cannot create %s model", c.SimParams.EpidemicModel)
@@ -217,53 +359,96 @@ func (c *EvoEpiConfig) Validate() error {
 				model.RemovedDuration = c.SimParams.NumGenerations + 1
 			}
 		}
-		//
-		for _, i := range model.HostIDs {
-			if _, exists := hostIDSet[i]; exists {
-				err := IntKeyExists(i)
-				return errors.Wrap(err, "host ID exists")
-			}
-			hostIDSet[i] = true
+		// Assign default value
+		// Vaccinated hosts stay vaccinated unless a duration is set
+		if model.VaccinatedDuration == 0 {
+			model.VaccinatedDuration = c.SimParams.NumGenerations + 1
 		}
-	}
-	// Check if all hosts have been assigned a model
-	for i := 0; i < c.SimParams.HostPopSize; i++ {
-		if !hostIDSet[i] {
-			return errors.Wrapf(EmptyModelError(), "host %d was not assigned a intrahost model", i)
+		model.hostIDs, err = selectHosts(model.HostIDs, model.HostTypes, model.HostAttributes, c.hostAttributes)
+		if err != nil {
+			return errors.Wrapf(err, "cannot select hosts for intrahost model %s", model.ModelName)
 		}
+		hostIDs = append(hostIDs, model.hostIDs)
+	}
+	// Check if every host has been assigned exactly one model
+	err = checkModelHostIDs("intrahost model", c.SimParams.HostPopSize, hostIDs)
+	if err != nil {
+		return err
 	}
 
 	// Validate each fitness model
-	// Check if host_ids are unique
-	hostIDSet = make(map[int]bool)
+	hostIDs = nil
+	// Matrices of time-varying models get negative IDs so that their
+	// cached fitness values are never mixed up with those of other models
+	nextMatrixID := -1
 	for _, model := range c.FitnessModels {
 		err := model.Validate()
 		if err != nil {
 			return err
 		}
-		for _, i := range model.HostIDs {
-			if _, exists := hostIDSet[i]; exists {
-				err := IntKeyExists(i)
-				return errors.Wrap(err, "host ID exists")
+		model.matrixIDs = nil
+		for range model.FitnessModelPaths {
+			model.matrixIDs = append(model.matrixIDs, nextMatrixID)
+			nextMatrixID--
+		}
+		if strings.ToLower(model.FitnessModel) == "frequency_dependent" {
+			if model.CooperatorSite >= c.SimParams.NumSites {
+				return fmt.Errorf(InvalidIntParameterError, "cooperator_site", model.CooperatorSite, fmt.Sprintf("must be less than the number of sites (%d)", c.SimParams.NumSites))
+			}
+			if model.CooperatorState >= len(c.SimParams.ExpectedChars) {
+				return fmt.Errorf(InvalidIntParameterError, "cooperator_state", model.CooperatorState, fmt.Sprintf("must be less than the number of expected characters (%d)", len(c.SimParams.ExpectedChars)))
+			}
+		}
+		switch model.matrixModel() {
+		case "additive_motif":
+			err = c.validateMotifs(model.FitnessModelPath)
+			if err != nil {
+				return errors.Wrapf(err, "invalid motifs for fitness model %s", model.ModelName)
+			}
+		case "epistasis":
+			err = c.validateEpistasis(model.FitnessModelPath)
+			if err != nil {
+				return errors.Wrapf(err, "invalid epistasis matrix for fitness model %s", model.ModelName)
 			}
-			hostIDSet[i] = true
 		}
+		model.hostIDs, err = selectHosts(model.HostIDs, model.HostTypes, model.HostAttributes, c.hostAttributes)
+		if err != nil {
+			return errors.Wrapf(err, "cannot select hosts for fitness model %s", model.ModelName)
+		}
+		hostIDs = append(hostIDs, model.hostIDs)
+	}
+	err = checkModelHostIDs("fitness model", c.SimParams.HostPopSize, hostIDs)
+	if err != nil {
+		return err
 	}
 	// Validate each transmission model
-	// Check if host_ids are unique
-	hostIDSet = make(map[int]bool)
+	hostIDs = nil
 	for _, model := range c.TransmissionModels {
 		err := model.Validate()
 		if err != nil {
 			return err
 		}
-		for _, i := range model.HostIDs {
-			if _, exists := hostIDSet[i]; exists {
-				err := IntKeyExists(i)
-				return errors.Wrap(err, "host ID exists")
+		switch strings.ToLower(model.TransmissionFitnessModel) {
+		case "additive_motif":
+			err = c.validateMotifs(model.TransmissionFitnessPath)
+			if err != nil {
+				return errors.Wrapf(err, "invalid motifs for transmission model %s", model.ModelName)
+			}
+		case "epistasis":
+			err = c.validateEpistasis(model.TransmissionFitnessPath)
+			if err != nil {
+				return errors.Wrapf(err, "invalid epistasis matrix for transmission model %s", model.ModelName)
 			}
-			hostIDSet[i] = true
 		}
+		model.hostIDs, err = selectHosts(model.HostIDs, model.HostTypes, model.HostAttributes, c.hostAttributes)
+		if err != nil {
+			return errors.Wrapf(err, "cannot select hosts for transmission model %s", model.ModelName)
+		}
+		hostIDs = append(hostIDs, model.hostIDs)
+	}
+	err = checkModelHostIDs("transmission model", c.SimParams.HostPopSize, hostIDs)
+	if err != nil {
+		return err
 	}
 	// Validate each stop condition
 	for _, cond := range c.StopConditions {
@@ -309,11 +494,116 @@ func (c *EvoEpiConfig) Validate() error {
 		}
 
 	}
-	// Check if all hosts have been assigned a model
-	for i := 0; i < c.SimParams.HostPopSize; i++ {
-		if !hostIDSet[i] {
-			return errors.Wrapf(EmptyModelError(), "host %d was not assigned a fitness model", i)
+	// Validate each intervention
+	transModelNames := make(map[string]bool)
+	for _, model := range c.TransmissionModels {
+		transModelNames[model.ModelName] = true
+	}
+	fitnessModelIDs := make(map[string]int)
+	for i, model := range c.FitnessModels {
+		fitnessModelIDs[model.ModelName] = i
+	}
+	for i, iv := range c.Interventions {
+		err := iv.Validate()
+		if err != nil {
+			return errors.Wrapf(err, "invalid intervention %d", i)
+		}
+		switch strings.ToLower(iv.Action) {
+		case TransmissionProbAction:
+			if !transModelNames[iv.ModelName] {
+				return fmt.Errorf("intervention %d changes transmission model %s that does not exist", i, iv.ModelName)
+			}
+		case TreatAction:
+			if len(iv.FitnessModel) > 0 {
+				id, exists := fitnessModelIDs[iv.FitnessModel]
+				if !exists {
+					return fmt.Errorf("intervention %d treats hosts with fitness model %s that does not exist", i, iv.FitnessModel)
+				}
+				iv.fitnessModelID = id
+			}
+			for _, pos := range iv.DrugSites {
+				if pos >= c.SimParams.NumSites {
+					return fmt.Errorf("position %d is greater than the last position in the expected sequence (%d)", pos, c.SimParams.NumSites-1)
+				}
+			}
+			for j, state := range iv.DrugSensitiveStates {
+				match := false
+				for _, expChar := range c.SimParams.ExpectedChars {
+					if strings.ToLower(state) == strings.ToLower(expChar) {
+						match = true
+						break
+					}
+				}
+				if !match {
+					return InvalidStateCharError(state, j)
+				}
+			}
+		case VaccinateAction:
+			if strings.ToLower(c.SimParams.EpidemicModel) == "compartmental" && !c.hasCompartment(VaccinatedStatusCode) {
+				return fmt.Errorf("intervention %d requires a compartment with status code %d (vaccinated)", i, VaccinatedStatusCode)
+			}
+		}
+		if ids := outOfRangeHostIDs(iv.HostIDs, c.SimParams.HostPopSize); len(ids) > 0 {
+			return HostIDsOutOfRangeError(fmt.Sprintf("intervention %d", i), ids, c.SimParams.HostPopSize)
+		}
+		iv.hostIDs, err = selectHosts(iv.HostIDs, iv.HostTypes, iv.HostAttributes, c.hostAttributes)
+		if err != nil {
+			return errors.Wrapf(err, "cannot select hosts for intervention %d", i)
+		}
+	}
+	// Validate demography
+	if c.Demography != nil {
+		err := c.Demography.Validate()
+		if err != nil {
+			return errors.Wrap(err, "invalid demography")
 		}
+		if c.SimParams.TemporalNetwork || len(c.SimParams.NetworkSnapshots) > 0 {
+			return fmt.Errorf("demography cannot be used with a host network that changes over time")
+		}
+		if c.Metapopulation != nil {
+			return fmt.Errorf("demography cannot be used with a metapopulation")
+		}
+		var names []string
+		for _, model := range c.IntrahostModels {
+			names = append(names, model.ModelName)
+		}
+		c.Demography.intrahostModelID, err = demographyModelID("intrahost", c.Demography.IntrahostModel, names)
+		if err != nil {
+			return err
+		}
+		names = nil
+		for _, model := range c.FitnessModels {
+			names = append(names, model.ModelName)
+		}
+		c.Demography.fitnessModelID, err = demographyModelID("fitness", c.Demography.FitnessModel, names)
+		if err != nil {
+			return err
+		}
+		names = nil
+		for _, model := range c.TransmissionModels {
+			names = append(names, model.ModelName)
+		}
+		c.Demography.transModelID, err = demographyModelID("transmission", c.Demography.TransmissionModel, names)
+		if err != nil {
+			return err
+		}
+	}
+	// Check if seeded pathogens are assigned to existing hosts
+	hostPathogenMap, err := LoadSequences(c.SimParams.PathogenSequencePath)
+	if err != nil {
+		return err
+	}
+	var seedHostIDs []int
+	for i := range hostPathogenMap {
+		seedHostIDs = append(seedHostIDs, i)
+	}
+	if ids := outOfRangeHostIDs(seedHostIDs, c.SimParams.HostPopSize); len(ids) > 0 {
+		return HostIDsOutOfRangeError(c.SimParams.PathogenSequencePath, ids, c.SimParams.HostPopSize)
+	}
+	// Check host IDs and the structure of the host network
+	err = c.validateHostNetwork()
+	if err != nil {
+		return err
 	}
 	// TODO: Validate files
 	c.validated = true
@@ -327,25 +617,33 @@ func (c *EvoEpiConfig) NewSimulation() (Epidemic, error) {
 	sim.hosts = make(map[int]Host)
 	sim.statuses = make(map[int]int)
 	sim.timers = make(map[int]int)
+	sim.infectionTimes = make(map[int]int)
 	sim.intrahostModels = make(map[int]IntrahostModel)
 	sim.fitnessModels = make(map[int]FitnessModel)
 	sim.transModels = make(map[int]TransmissionModel)
 	sim.hostNeighborhoods = make(map[int][]Host)
 	// Create empty hosts
 	for i := 0; i < c.SimParams.HostPopSize; i++ {
-		sim.hosts[i] = EmptySequenceHost(i)
+		if c.hostAttributes == nil {
+			sim.hosts[i] = EmptySequenceHost(i)
+			continue
+		}
+		sim.hosts[i] = EmptySequenceHost(i, c.hostAttributes.TypeID(i))
+		for name, value := range c.hostAttributes.Values(i) {
+			sim.hosts[i].SetAttribute(name, value)
+		}
 	}
 
 	// Create IntrahostModels
 	for i, conf := range c.IntrahostModels {
-		model, err := conf.CreateModel(i)
+		model, err := conf.CreateModel(i, c.SimParams.ExpectedChars)
 		if err != nil {
 			return nil, err
 		}
 		model.SetModelID(i)
 		sim.intrahostModels[i] = model
 		// assign to hosts
-		for _, id := range conf.HostIDs {
+		for _, id := range conf.hostIDs {
 			err := sim.hosts[id].SetIntrahostModel(model)
 			if err != nil {
 				return nil, err
@@ -361,7 +659,7 @@ func (c *EvoEpiConfig) NewSimulation() (Epidemic, error) {
 		model.SetModelID(i)
 		sim.fitnessModels[i] = model
 		// assign to hosts
-		for _, id := range conf.HostIDs {
+		for _, id := range conf.hostIDs {
 			err := sim.hosts[id].SetFitnessModel(model)
 			if err != nil {
 				return nil, err
@@ -377,26 +675,57 @@ func (c *EvoEpiConfig) NewSimulation() (Epidemic, error) {
 		model.SetModelID(i)
 		sim.transModels[i] = model
 		// assign to hosts
-		for _, id := range conf.HostIDs {
+		for _, id := range conf.hostIDs {
 			err := sim.hosts[id].SetTransmissionModel(model)
 			if err != nil {
 				return nil, err
 			}
 		}
 	}
-	// Load host connections
+	// Load host connections and construct neighborhoods
 	var err error
-	sim.hostNetwork, err = LoadAdjacencyMatrix(c.SimParams.HostNetworkPath)
-	if err != nil {
-		return nil, err
-	}
-	// Construct neighborhoods
-	for id := range sim.hosts {
-		neighborIDs := sim.hostNetwork.GetNeighbors(id)
-		sim.hostNeighborhoods[id] = make([]Host, len(neighborIDs))
-		for i, neighborID := range neighborIDs {
-			sim.hostNeighborhoods[id][i] = sim.hosts[neighborID]
+	switch {
+	case c.Metapopulation != nil:
+		// Hosts have no fixed connections
+		sim.metapopulation, err = c.Metapopulation.CreateMetapopulation()
+		if err != nil {
+			return nil, err
+		}
+		sim.setHostNetwork(EmptyAdjacencyMatrix())
+	case c.SimParams.TemporalNetwork:
+		sim.temporalNetwork, err = LoadTemporalEdgeList(c.SimParams.HostNetworkPath)
+		if err != nil {
+			return nil, err
+		}
+	case len(c.SimParams.NetworkSnapshots) > 0:
+		snapshots := make(map[int]HostNetwork)
+		snapshots[0], err = LoadHostNetwork(c.SimParams.HostNetworkPath, c.SimParams.HostNetworkFormat)
+		if err != nil {
+			return nil, err
+		}
+		for _, snapshot := range c.SimParams.NetworkSnapshots {
+			snapshots[snapshot.Generation], err = LoadHostNetwork(snapshot.Path, c.SimParams.HostNetworkFormat)
+			if err != nil {
+				return nil, err
+			}
+		}
+		sim.temporalNetwork = NewNetworkSnapshots(snapshots)
+	case c.Network != nil:
+		network, err := c.Network.Generate()
+		if err != nil {
+			return nil, err
+		}
+		sim.setHostNetwork(network)
+	default:
+		network, err := LoadHostNetwork(c.SimParams.HostNetworkPath, c.SimParams.HostNetworkFormat)
+		if err != nil {
+			return nil, err
 		}
+		sim.setHostNetwork(network)
+	}
+	if sim.temporalNetwork != nil {
+		sim.networkEpoch = -1
+		sim.UpdateNetwork(0)
 	}
 	// Initialize empty GenotypeTree
 	sim.tree = EmptyGenotypeTree()
@@ -406,12 +735,15 @@ func (c *EvoEpiConfig) NewSimulation() (Epidemic, error) {
 		return nil, err
 	}
 	// Seed pathogens into host/s
+	// Node IDs of seeded pathogens only depend on the host ID and are
+	// the same in every simulation instance
 	for i, sequences := range hostPathogenMap {
-		sequenceIDs := rand.Perm(len(sequences))
-		for _, j := range sequenceIDs {
+		r := NewRand(DeriveSeed(0, i))
+		for _, sequence := range sequences {
 			// Seeded pathogens are all roots
-			genotype := sim.tree.NewNode(sequences[j], 0)
+			genotype := sim.tree.NewNode(newNodeUID(r), sequence, 0)
 			sim.hosts[i].AddPathogens(genotype)
+			RememberInfection(sim.hosts[i], sequence, 0)
 		}
 	}
 	// Add config to simulation
@@ -463,6 +795,22 @@ func (c *EvoEpiConfig) NewSimulation() (Epidemic, error) {
 
 		}
 	}
+	if c.SimParams.Reinfection {
+		switch strings.ToLower(c.SimParams.EpidemicModel) {
+		case "sirs", "seirs":
+			sim.infectableStatuses = append(sim.infectableStatuses, RecoveredStatusCode)
+		}
+		sim.infectableStatuses = append(sim.infectableStatuses, VaccinatedStatusCode)
+	}
+	// User-defined compartmental models explicitly declare which
+	// statuses are infectable
+	if strings.ToLower(c.SimParams.EpidemicModel) == "compartmental" {
+		model, err := c.CompartmentalModel()
+		if err != nil {
+			return nil, err
+		}
+		sim.infectableStatuses = model.InfectableStatuses()
+	}
 	// Initialize host statuses to 1
 	for i := range sim.hosts {
 		sim.statuses[i] = 1
@@ -480,9 +828,172 @@ func (c *EvoEpiConfig) NewSimulation() (Epidemic, error) {
 		sim.stopConditions = append(sim.stopConditions, newCondition)
 	}
 
+	// Add interventions
+	for i, conf := range c.Interventions {
+		iv, err := conf.CreateIntervention(i, sim.fitnessModels, c.SimParams.ExpectedChars)
+		if err != nil {
+			return nil, err
+		}
+		sim.interventions = append(sim.interventions, iv)
+	}
+
+	// Add demography
+	if c.Demography != nil {
+		// Infected immigrants carry the sequences seeded in a host,
+		// ordered by host ID
+		var seedHostIDs []int
+		for i := range hostPathogenMap {
+			seedHostIDs = append(seedHostIDs, i)
+		}
+		sort.Ints(seedHostIDs)
+		seeds := make([][][]uint8, len(seedHostIDs))
+		for i, id := range seedHostIDs {
+			seeds[i] = hostPathogenMap[id]
+		}
+		sim.demography, err = c.Demography.CreateDemography(sim.intrahostModels, sim.fitnessModels, sim.transModels, seeds, c.SimParams.HostPopSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return sim, nil
 }
 
+// hasCompartment returns true if a user-defined compartment has the
+// given status code.
+func (c *EvoEpiConfig) hasCompartment(code int) bool {
+	for _, assigned := range c.statusCodes() {
+		if assigned == code {
+			return true
+		}
+	}
+	return false
+}
+
+// statusCodes assigns a status code to each user-defined compartment.
+// Compartments named after a preset status use the preset status code
+// unless a code is given explicitly. The remaining compartments are
+// numbered consecutively after the preset status codes.
+func (c *EvoEpiConfig) statusCodes() map[string]int {
+	codes := make(map[string]int)
+	used := make(map[int]bool)
+	for _, conf := range c.Compartments {
+		if conf.Code > 0 {
+			used[conf.Code] = true
+		} else if code, isPreset := presetStatusCodes[strings.ToLower(conf.Name)]; isPreset {
+			used[code] = true
+		}
+	}
+	nextCode := VaccinatedStatusCode + 1
+	for _, conf := range c.Compartments {
+		switch code, isPreset := presetStatusCodes[strings.ToLower(conf.Name)]; {
+		case conf.Code > 0:
+			codes[conf.Name] = conf.Code
+		case isPreset:
+			codes[conf.Name] = code
+		default:
+			for used[nextCode] {
+				nextCode++
+			}
+			codes[conf.Name] = nextCode
+			used[nextCode] = true
+		}
+	}
+	return codes
+}
+
+// validateCompartmentalModel checks that the user-defined compartments
+// and transitions form a valid compartmental model.
+func (c *EvoEpiConfig) validateCompartmentalModel() error {
+	if len(c.Compartments) == 0 {
+		return fmt.Errorf("at least one compartment must be declared")
+	}
+	names := make(map[string]bool)
+	for _, conf := range c.Compartments {
+		err := conf.Validate()
+		if err != nil {
+			return err
+		}
+		if names[conf.Name] {
+			return fmt.Errorf("compartment %s is declared more than once", conf.Name)
+		}
+		names[conf.Name] = true
+	}
+	// Check that status codes are unique
+	codeNames := make(map[int]string)
+	hasSusceptible := false
+	hasTransmitter := false
+	codes := c.statusCodes()
+	for _, conf := range c.Compartments {
+		code := codes[conf.Name]
+		if name, exists := codeNames[code]; exists {
+			return fmt.Errorf("compartments %s and %s have the same status code (%d)", name, conf.Name, code)
+		}
+		codeNames[code] = conf.Name
+		if code == SusceptibleStatusCode {
+			hasSusceptible = true
+		}
+		if conf.Transmits {
+			hasTransmitter = true
+		}
+	}
+	// All hosts start in the susceptible status
+	if !hasSusceptible {
+		return fmt.Errorf("a compartment with status code %d (susceptible) is required", SusceptibleStatusCode)
+	}
+	if !hasTransmitter {
+		return fmt.Errorf("at least one compartment must be able to transmit")
+	}
+	for _, conf := range c.Transitions {
+		err := conf.Validate()
+		if err != nil {
+			return err
+		}
+		if !names[conf.From] {
+			return fmt.Errorf("transition source %s is not a declared compartment", conf.From)
+		}
+		if !names[conf.To] {
+			return fmt.Errorf("transition destination %s is not a declared compartment", conf.To)
+		}
+	}
+	return nil
+}
+
+// CompartmentalModel creates the user-defined compartmental model
+// described in the compartment and transition sections.
+func (c *EvoEpiConfig) CompartmentalModel() (*CompartmentalModel, error) {
+	if !c.validated {
+		return nil, fmt.Errorf("validate model parameters first")
+	}
+	codes := c.statusCodes()
+	compartments := make([]*Compartment, len(c.Compartments))
+	for i, conf := range c.Compartments {
+		compartments[i] = &Compartment{
+			Name:       conf.Name,
+			Code:       codes[conf.Name],
+			Duration:   conf.Duration,
+			Infected:   conf.Infected,
+			Infectable: conf.Infectable,
+			Transmits:  conf.Transmits,
+		}
+	}
+	transitions := make([]*Transition, len(c.Transitions))
+	for i, conf := range c.Transitions {
+		prob := conf.Prob
+		if prob == 0 {
+			prob = 1.0
+		}
+		transitions[i] = &Transition{
+			From:      codes[conf.From],
+			To:        codes[conf.To],
+			Trigger:   strings.ToLower(conf.Trigger),
+			Threshold: conf.Threshold,
+			Prob:      prob,
+		}
+	}
+	return NewCompartmentalModel(compartments, transitions), nil
+}
+
 // NumInstances returns the number of independent realizations to run.
 func (c *EvoEpiConfig) NumInstances() int { return c.SimParams.NumIntances }
 
@@ -501,39 +1012,318 @@ func (c *EvoEpiConfig) LogPath() string { return c.LogParams.LogPath }
 // LogTransmission indicates whether transmissions are logged or discarded.
 func (c *EvoEpiConfig) LogTransmission() bool { return c.LogParams.LogTransmission }
 
-type epidemicSimConfig struct {
-	NumGenerations int      `toml:"num_generations"`
-	NumIntances    int      `toml:"num_instances"`
-	NumSites       int      `toml:"num_sites"`
-	HostPopSize    int      `toml:"host_popsize"`
-	EpidemicModel  string   `toml:"epidemic_model"` // si, sir, sirs, sei, seis, seirs, endtrans, exchange
-	Coinfection    bool     `toml:"coinfection"`
-	ExpectedChars  []string `toml:"expected_characters"`
-
-	PathogenSequencePath string `toml:"pathogen_path"` // fasta file for seeding infections
-	HostNetworkPath      string `toml:"host_network_path"`
-	validated            bool
-}
+// CheckpointFreq returns the number of pathogen generations in the simulation
+// until the state of the simulation is saved. Returns 0 if disabled.
+func (c *EvoEpiConfig) CheckpointFreq() int { return c.LogParams.CheckpointFreq }
 
-func (c *epidemicSimConfig) Validate() error {
-	// Check PathogenSequencePath
-	exists, err := Exists(c.PathogenSequencePath)
-	if err != nil {
-		return FileExistsCheckError(err, c.PathogenSequencePath)
+// GenerateNetwork creates a new random host network using the parameters
+// in the network section. If num_nodes is not set, the network has as many
+// hosts as host_popsize.
+func (c *EvoEpiConfig) GenerateNetwork() (HostNetwork, error) {
+	if c.Network == nil {
+		return nil, fmt.Errorf("configuration has no network section")
 	}
-	if !exists {
-		return FileDoesNotExistError(c.PathogenSequencePath)
+	// Assign default value
+	if c.Network.NumNodes == 0 && c.SimParams != nil {
+		c.Network.NumNodes = c.SimParams.HostPopSize
 	}
+	return c.Network.Generate()
+}
 
-	// Check HostNetworkPath
-	exists, err = Exists(c.HostNetworkPath)
-	if err != nil {
-		return FileExistsCheckError(err, c.HostNetworkPath)
+// validateHostNetwork checks that every network file used during the
+// simulation only has hosts between 0 and host_popsize-1. If check_network
+// is set, it also checks that every host in the starting network has
+// at least one connection.
+func (c *EvoEpiConfig) validateHostNetwork() error {
+	popSize := c.SimParams.HostPopSize
+	if c.Metapopulation != nil {
+		// Patches are checked when validating the metapopulation
+		return nil
 	}
-	if !exists {
-		return FileDoesNotExistError(c.HostNetworkPath)
+	switch {
+	case c.Network != nil:
+		// Generated networks always have host_popsize hosts
+	case c.SimParams.TemporalNetwork:
+		network, err := LoadTemporalEdgeList(c.SimParams.HostNetworkPath)
+		if err != nil {
+			return err
+		}
+		var hostIDs []int
+		for _, t := range network.ChangeTimes() {
+			hostIDs = append(hostIDs, networkHostIDs(network.Network(t))...)
+		}
+		if ids := outOfRangeHostIDs(hostIDs, popSize); len(ids) > 0 {
+			return HostIDsOutOfRangeError(c.SimParams.HostNetworkPath, ids, popSize)
+		}
+	default:
+		paths := []string{c.SimParams.HostNetworkPath}
+		for _, snapshot := range c.SimParams.NetworkSnapshots {
+			paths = append(paths, snapshot.Path)
+		}
+		for _, path := range paths {
+			network, err := LoadHostNetwork(path, c.SimParams.HostNetworkFormat)
+			if err != nil {
+				return err
+			}
+			if ids := outOfRangeHostIDs(networkHostIDs(network), popSize); len(ids) > 0 {
+				return HostIDsOutOfRangeError(path, ids, popSize)
+			}
+		}
 	}
-
+	if c.SimParams.CheckNetwork {
+		network, err := c.HostNetwork()
+		if err != nil {
+			return err
+		}
+		return ComputeNetworkStats(network, popSize).Check()
+	}
+	return nil
+}
+
+// validateMotifs checks that every motif in the motif file at the given
+// path is within the expected sequence and only uses expected characters.
+func (c *EvoEpiConfig) validateMotifs(path string) error {
+	m, err := LoadMotifModel(0, "", path)
+	if err != nil {
+		return err
+	}
+	for _, mt := range m.(*motifModel).motifs {
+		for i, pos := range mt.pos {
+			if pos >= c.SimParams.NumSites {
+				return fmt.Errorf("position %d is greater than the last position in the expected sequence (%d)", pos, c.SimParams.NumSites-1)
+			}
+			if int(mt.motif[i]) >= len(c.SimParams.ExpectedChars) {
+				return fmt.Errorf("state %d at position %d is not one of the %d expected characters", mt.motif[i], pos, len(c.SimParams.ExpectedChars))
+			}
+		}
+	}
+	return nil
+}
+
+// validateEpistasis checks that the sites and states in the epistasis
+// matrix are within the expected sequence.
+func (c *EvoEpiConfig) validateEpistasis(path string) error {
+	fields, couplings, err := LoadEpistasisMatrix(path)
+	if err != nil {
+		return err
+	}
+	checkSite := func(pos int, state uint8) error {
+		if pos >= c.SimParams.NumSites {
+			return fmt.Errorf("position %d is greater than the last position in the expected sequence (%d)", pos, c.SimParams.NumSites-1)
+		}
+		if int(state) >= len(c.SimParams.ExpectedChars) {
+			return fmt.Errorf("state %d at position %d is not one of the %d expected characters", state, pos, len(c.SimParams.ExpectedChars))
+		}
+		return nil
+	}
+	for pos, row := range fields {
+		for state := range row {
+			if err := checkSite(pos, state); err != nil {
+				return err
+			}
+		}
+	}
+	for pair, values := range couplings {
+		for states := range values {
+			if err := checkSite(pair[0], states[0]); err != nil {
+				return err
+			}
+			if err := checkSite(pair[1], states[1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkModelHostIDs checks that every host from 0 to popSize-1 is assigned
+// to exactly one model. Each item in hostIDs is the list of hosts assigned
+// to a model.
+func checkModelHostIDs(kind string, popSize int, hostIDs [][]int) error {
+	var allIDs []int
+	for _, ids := range hostIDs {
+		allIDs = append(allIDs, ids...)
+	}
+	if ids := outOfRangeHostIDs(allIDs, popSize); len(ids) > 0 {
+		return HostIDsOutOfRangeError(kind+" host_ids", ids, popSize)
+	}
+	counts := make(map[int]int)
+	for _, i := range allIDs {
+		counts[i]++
+	}
+	var duplicates, unassigned []int
+	for i := 0; i < popSize; i++ {
+		if counts[i] > 1 {
+			duplicates = append(duplicates, i)
+		} else if counts[i] == 0 {
+			unassigned = append(unassigned, i)
+		}
+	}
+	if len(duplicates) > 0 {
+		return DuplicateHostIDsError(kind, duplicates)
+	}
+	if len(unassigned) > 0 {
+		return UnassignedHostIDsError(kind, unassigned)
+	}
+	return nil
+}
+
+// outOfRangeHostIDs returns the sorted unique IDs
+// that are not between 0 and popSize-1.
+func outOfRangeHostIDs(hostIDs []int, popSize int) []int {
+	set := make(map[int]bool)
+	for _, i := range hostIDs {
+		if i < 0 || i >= popSize {
+			set[i] = true
+		}
+	}
+	return sortedKeys(set)
+}
+
+// networkHostIDs returns the IDs of hosts with incoming
+// or outgoing connections in the network.
+func networkHostIDs(m HostNetwork) []int {
+	var ids []int
+	for _, a := range m.HostIDs() {
+		ids = append(ids, a)
+		ids = append(ids, m.GetNeighbors(a)...)
+	}
+	return ids
+}
+
+// HostNetwork returns the host network at the start of the simulation.
+func (c *EvoEpiConfig) HostNetwork() (HostNetwork, error) {
+	switch {
+	case c.Metapopulation != nil:
+		return nil, fmt.Errorf("a metapopulation has no host network")
+	case c.SimParams.TemporalNetwork:
+		network, err := LoadTemporalEdgeList(c.SimParams.HostNetworkPath)
+		if err != nil {
+			return nil, err
+		}
+		return network.Network(0), nil
+	case c.Network != nil:
+		return c.GenerateNetwork()
+	}
+	return LoadHostNetwork(c.SimParams.HostNetworkPath, c.SimParams.HostNetworkFormat)
+}
+
+// ConfigPath returns the path of the file where the configuration was loaded.
+func (c *EvoEpiConfig) ConfigPath() string { return c.path }
+
+type epidemicSimConfig struct {
+	NumGenerations int      `toml:"num_generations"`
+	NumIntances    int      `toml:"num_instances"`
+	NumSites       int      `toml:"num_sites"`
+	HostPopSize    int      `toml:"host_popsize"`
+	EpidemicModel  string   `toml:"epidemic_model"` // si, sis, sir, sirs, sei, seir, seirs, endtrans, exchange, compartmental
+	Coinfection    bool     `toml:"coinfection"`
+	ExpectedChars  []string `toml:"expected_characters"`
+	// Reinfection allows recovered hosts in the sirs and seirs models and
+	// vaccinated hosts to be infected. Protection is set in the intrahost
+	// model.
+	Reinfection bool `toml:"reinfection"`
+
+	PathogenSequencePath string `toml:"pathogen_path"` // fasta file for seeding infections
+	HostNetworkPath      string `toml:"host_network_path"`
+	// HostAttributesPath is a CSV file of host types and attributes
+	// used to select hosts in model sections.
+	HostAttributesPath string `toml:"host_attributes_path"`
+	// HostNetworkFormat is the file format of host_network_path and
+	// network snapshots: adjacency, csv, graphml, gml or pajek. If empty,
+	// the format is inferred from the file extension.
+	HostNetworkFormat string `toml:"host_network_format"`
+	// TemporalNetwork indicates that host_network_path is an edge list
+	// where each connection has a start and end generation.
+	TemporalNetwork bool `toml:"temporal_network"`
+	// NetworkSnapshots replace the network in host_network_path starting
+	// from the given generations.
+	NetworkSnapshots []*networkSnapshotConfig `toml:"network_snapshot"`
+	// CheckNetwork checks that every host has at least one connection
+	// when validating the configuration.
+	CheckNetwork bool `toml:"check_network"`
+	// generatedNetwork indicates that the network is generated from the
+	// network section instead of being loaded from host_network_path.
+	generatedNetwork bool
+	// metapopulation indicates that hosts are grouped into patches
+	// instead of being connected by a host network.
+	metapopulation bool
+	validated      bool
+}
+
+func (c *epidemicSimConfig) Validate() error {
+	// Check PathogenSequencePath
+	exists, err := Exists(c.PathogenSequencePath)
+	if err != nil {
+		return FileExistsCheckError(err, c.PathogenSequencePath)
+	}
+	if !exists {
+		return FileDoesNotExistError(c.PathogenSequencePath)
+	}
+
+	// Check HostNetworkPath
+	if c.metapopulation {
+		if len(c.HostNetworkPath) > 0 {
+			return fmt.Errorf("host_network_path cannot be used with a metapopulation")
+		}
+		if c.TemporalNetwork || len(c.NetworkSnapshots) > 0 {
+			return fmt.Errorf("a metapopulation cannot have a host network that changes over time")
+		}
+	} else if c.generatedNetwork {
+		if len(c.HostNetworkPath) > 0 {
+			return fmt.Errorf("host_network_path cannot be used with a generated network")
+		}
+		if c.TemporalNetwork || len(c.NetworkSnapshots) > 0 {
+			return fmt.Errorf("a generated network cannot change over time")
+		}
+	} else {
+		exists, err = Exists(c.HostNetworkPath)
+		if err != nil {
+			return FileExistsCheckError(err, c.HostNetworkPath)
+		}
+		if !exists {
+			return FileDoesNotExistError(c.HostNetworkPath)
+		}
+	}
+	// Check HostAttributesPath
+	if len(c.HostAttributesPath) > 0 {
+		exists, err = Exists(c.HostAttributesPath)
+		if err != nil {
+			return FileExistsCheckError(err, c.HostAttributesPath)
+		}
+		if !exists {
+			return FileDoesNotExistError(c.HostAttributesPath)
+		}
+	}
+	// Check keyword of host_network_format
+	if len(c.HostNetworkFormat) > 0 {
+		err = checkKeyword(c.HostNetworkFormat, "host_network_format",
+			AdjacencyNetworkFormat, CSVNetworkFormat,
+			GraphMLNetworkFormat, GMLNetworkFormat, PajekNetworkFormat,
+		)
+		if err != nil {
+			return err
+		}
+		if c.TemporalNetwork && strings.ToLower(c.HostNetworkFormat) != AdjacencyNetworkFormat {
+			return fmt.Errorf(InvalidStringParameterError, "host_network_format", c.HostNetworkFormat, "temporal networks must be adjacency lists")
+		}
+	}
+	// Check network snapshots
+	if c.TemporalNetwork && len(c.NetworkSnapshots) > 0 {
+		return fmt.Errorf("network snapshots cannot be used with a temporal network")
+	}
+	snapshotGens := make(map[int]bool)
+	for _, snapshot := range c.NetworkSnapshots {
+		err := snapshot.Validate()
+		if err != nil {
+			return err
+		}
+		if snapshotGens[snapshot.Generation] {
+			return fmt.Errorf("duplicate network snapshot for generation %d", snapshot.Generation)
+		}
+		snapshotGens[snapshot.Generation] = true
+	}
+
 	// Check parameter values
 	if c.NumGenerations < 1 {
 		return fmt.Errorf(InvalidIntParameterError, "num_generations", c.NumGenerations, "must be greater than or equal to 1")
@@ -550,6 +1340,7 @@ func (c *epidemicSimConfig) Validate() error {
 		"sir", "sirs",
 		"sei", "seir", "seirs",
 		"endtrans", "exchange",
+		"compartmental",
 	)
 	if err != nil {
 		return err
@@ -567,10 +1358,32 @@ func (c *epidemicSimConfig) Validate() error {
 	return nil
 }
 
+type networkSnapshotConfig struct {
+	Generation int    `toml:"generation"`
+	Path       string `toml:"path"`
+	validated  bool
+}
+
+func (c *networkSnapshotConfig) Validate() error {
+	if c.Generation < 1 {
+		return fmt.Errorf(InvalidIntParameterError, "generation", c.Generation, "must be greater than or equal to 1")
+	}
+	exists, err := Exists(c.Path)
+	if err != nil {
+		return FileExistsCheckError(err, c.Path)
+	}
+	if !exists {
+		return FileDoesNotExistError(c.Path)
+	}
+	c.validated = true
+	return nil
+}
+
 type logConfig struct {
 	LogFreq         int    `toml:"log_freq"`
 	LogTransmission bool   `toml:"log_transmission"`
 	LogPath         string `toml:"log_path"`
+	CheckpointFreq  int    `toml:"checkpoint_freq"`
 	validated       bool
 }
 
@@ -579,6 +1392,9 @@ func (c *logConfig) Validate() error {
 	if c.LogFreq < 1 {
 		return fmt.Errorf(InvalidIntParameterError, "log_freq", c.LogFreq, "must be greater than or equal to 1")
 	}
+	if c.CheckpointFreq < 0 {
+		return fmt.Errorf(InvalidIntParameterError, "checkpoint_freq", c.CheckpointFreq, "must be greater than or equal to 0")
+	}
 	c.validated = true
 	return nil
 }
@@ -609,6 +1425,36 @@ type intrahostModelConfig struct {
 	// If ProbDuration is false, will not use rv.Poisson to pick the duration
 	ProbDuration bool `toml:"probabilistic_duration"`
 
+	// Thresholds change the status of the host based on its
+	// pathogen population instead of a timer. If 0 or empty, the
+	// threshold is not used.
+	InfectiveThreshold int    `toml:"infective_threshold"`
+	InfectiveMotif     string `toml:"infective_motif"`
+	InfectiveMotifPos  []int  `toml:"infective_motif_positions"`
+	ClearanceThreshold int    `toml:"clearance_threshold"`
+
+	// Hosts remember the epitopes of the pathogens they were infected
+	// with. Protection against an identical epitope is equal to
+	// cross_immunity and decreases linearly until it disappears at
+	// cross_immunity_distance differences. If epitope_positions is empty,
+	// the whole sequence is the epitope. If immune_memory_size is 0, all
+	// epitopes are remembered.
+	CrossImmunity         float64 `toml:"cross_immunity"`
+	CrossImmunityDistance int     `toml:"cross_immunity_distance"`
+	EpitopePositions      []int   `toml:"epitope_positions"`
+	ImmuneMemorySize      int     `toml:"immune_memory_size"`
+	// Protection against infection by any genotype while the host is
+	// recovered or vaccinated. If 0, hosts in these statuses are fully
+	// susceptible whenever their status is infectable.
+	RecoveredProtection  float64 `toml:"recovered_protection"`
+	VaccinatedProtection float64 `toml:"vaccinated_protection"`
+
+	// HostTypes and HostAttributes select hosts from the host attribute
+	// file in addition to the hosts listed in host_ids.
+	HostTypes      []int                  `toml:"host_types"`
+	HostAttributes map[string]interface{} `toml:"host_attributes"`
+	hostIDs        []int
+
 	validated bool
 }
 
@@ -674,17 +1520,70 @@ func (c *intrahostModelConfig) Validate() error {
 	if c.VaccinatedDuration < 0 {
 		return fmt.Errorf(InvalidIntParameterError, "vaccinated_duration", c.VaccinatedDuration, "cannot be negative")
 	}
-	// TODO: make sure host_ids are unique across models
-
+	// Check thresholds
+	if c.InfectiveThreshold < 0 {
+		return fmt.Errorf(InvalidIntParameterError, "infective_threshold", c.InfectiveThreshold, "cannot be negative")
+	}
+	if c.ClearanceThreshold < 0 {
+		return fmt.Errorf(InvalidIntParameterError, "clearance_threshold", c.ClearanceThreshold, "cannot be negative")
+	}
+	if len(c.InfectiveMotif) != len(c.InfectiveMotifPos) {
+		return fmt.Errorf("length of infective_motif (%d) and infective_motif_positions (%d) are not equal", len(c.InfectiveMotif), len(c.InfectiveMotifPos))
+	}
+	for _, pos := range c.InfectiveMotifPos {
+		if pos < 0 {
+			return fmt.Errorf(InvalidIntParameterError, "infective_motif_positions", pos, "cannot be negative")
+		}
+	}
+	// Check immunity
+	if c.CrossImmunity < 0 || c.CrossImmunity > 1 {
+		return fmt.Errorf(InvalidFloatParameterError, "cross_immunity", c.CrossImmunity, "must be between 0 and 1")
+	}
+	if c.CrossImmunityDistance < 0 {
+		return fmt.Errorf(InvalidIntParameterError, "cross_immunity_distance", c.CrossImmunityDistance, "cannot be negative")
+	}
+	for _, pos := range c.EpitopePositions {
+		if pos < 0 {
+			return fmt.Errorf(InvalidIntParameterError, "epitope_positions", pos, "cannot be negative")
+		}
+	}
+	if c.ImmuneMemorySize < 0 {
+		return fmt.Errorf(InvalidIntParameterError, "immune_memory_size", c.ImmuneMemorySize, "cannot be negative")
+	}
+	if c.RecoveredProtection < 0 || c.RecoveredProtection > 1 {
+		return fmt.Errorf(InvalidFloatParameterError, "recovered_protection", c.RecoveredProtection, "must be between 0 and 1")
+	}
+	if c.VaccinatedProtection < 0 || c.VaccinatedProtection > 1 {
+		return fmt.Errorf(InvalidFloatParameterError, "vaccinated_protection", c.VaccinatedProtection, "must be between 0 and 1")
+	}
 	c.validated = true
 	return nil
 }
 
 // CreateModel creates an IntrahostModel based on the configuration.
-func (c *intrahostModelConfig) CreateModel(id int) (IntrahostModel, error) {
+// The list of characters is used to encode the infective motif.
+func (c *intrahostModelConfig) CreateModel(id int, charList []string) (IntrahostModel, error) {
 	if !c.validated {
 		return nil, fmt.Errorf("validate model parameters first")
 	}
+	thresholds := thresholdParams{
+		infectiveThreshold: c.InfectiveThreshold,
+		clearanceThreshold: c.ClearanceThreshold,
+	}
+	if len(c.InfectiveMotif) > 0 {
+		thresholds.infectiveMotif = make([]uint8, len(c.InfectiveMotif))
+		for i, seqRune := range c.InfectiveMotif {
+			seqChar := string(seqRune)
+			for j, char := range charList {
+				if strings.ToLower(seqChar) == strings.ToLower(char) {
+					thresholds.infectiveMotif[i] = uint8(j)
+					break
+				}
+			}
+		}
+		thresholds.infectiveMotifPos = make([]int, len(c.InfectiveMotifPos))
+		copy(thresholds.infectiveMotifPos, c.InfectiveMotifPos)
+	}
 	statusDuration := make(map[int]int)
 	statusDuration[ExposedStatusCode] = c.ExposedDuration
 	statusDuration[InfectedStatusCode] = c.InfectedDuration
@@ -693,6 +1592,16 @@ func (c *intrahostModelConfig) CreateModel(id int) (IntrahostModel, error) {
 	statusDuration[RecoveredStatusCode] = c.RecoveredDuration
 	statusDuration[DeadStatusCode] = c.DeadDuration
 	statusDuration[VaccinatedStatusCode] = c.VaccinatedDuration
+	immunity := immunityParams{
+		crossImmunity:         c.CrossImmunity,
+		crossImmunityDistance: c.CrossImmunityDistance,
+		epitopePositions:      append([]int{}, c.EpitopePositions...),
+		immuneMemorySize:      c.ImmuneMemorySize,
+		statusProtection: map[int]float64{
+			RecoveredStatusCode:  c.RecoveredProtection,
+			VaccinatedStatusCode: c.VaccinatedProtection,
+		},
+	}
 
 	switch c.ReplicationModel {
 	case "constant":
@@ -709,6 +1618,8 @@ func (c *intrahostModelConfig) CreateModel(id int) (IntrahostModel, error) {
 		}
 		model.statusDuration = statusDuration
 		model.probDuration = c.ProbDuration
+		model.thresholdParams = thresholds
+		model.immunityParams = immunity
 		return model, nil
 	case "bht":
 		model := new(BevertonHoltThresholdPopModel)
@@ -725,6 +1636,8 @@ func (c *intrahostModelConfig) CreateModel(id int) (IntrahostModel, error) {
 		}
 		model.statusDuration = statusDuration
 		model.probDuration = c.ProbDuration
+		model.thresholdParams = thresholds
+		model.immunityParams = immunity
 		return model, nil
 	case "fitness":
 		// fitness
@@ -741,6 +1654,8 @@ func (c *intrahostModelConfig) CreateModel(id int) (IntrahostModel, error) {
 		}
 		model.statusDuration = statusDuration
 		model.probDuration = false // ConstantDuration does not matter because status is not time-dependent
+		model.thresholdParams = thresholds
+		model.immunityParams = immunity
 		return model, nil
 	}
 	return nil, fmt.Errorf(UnrecognizedKeywordError, c.ReplicationModel, "replication_model")
@@ -750,9 +1665,35 @@ func (c *intrahostModelConfig) CreateModel(id int) (IntrahostModel, error) {
 type fitnessModelConfig struct {
 	ModelName        string `toml:"model_name"`
 	HostIDs          []int  `toml:"host_ids"`
-	FitnessModel     string `toml:"fitness_model"` // multiplicative, additive, additive_motif
+	FitnessModel     string `toml:"fitness_model"` // multiplicative, additive, additive_motif, epistasis, frequency_dependent, immune_escape, time_varying
 	FitnessModelPath string `toml:"fitness_model_path"`
-	validated        bool
+	// FitnessModelPaths are the fitness matrices of a time_varying model
+	// in the order they take effect.
+	FitnessModelPaths []string `toml:"fitness_model_paths"`
+	// HostTypes and HostAttributes select hosts from the host attribute
+	// file in addition to the hosts listed in host_ids.
+	HostTypes      []int                  `toml:"host_types"`
+	HostAttributes map[string]interface{} `toml:"host_attributes"`
+	// BaseFitnessModel is the model of fitness_model_path used by
+	// frequency_dependent and immune_escape models, or of the matrices in
+	// fitness_model_paths used by time_varying models.
+	BaseFitnessModel   string  `toml:"base_fitness_model"`  // multiplicative, additive, additive_motif, epistasis
+	FrequencySelection float64 `toml:"frequency_selection"` // only for frequency_dependent
+	CooperatorSite     int     `toml:"cooperator_site"`     // only for frequency_dependent
+	CooperatorState    int     `toml:"cooperator_state"`    // only for frequency_dependent
+	CooperationBenefit float64 `toml:"cooperation_benefit"` // only for frequency_dependent
+	CooperationCost    float64 `toml:"cooperation_cost"`    // only for frequency_dependent
+	ImmuneDelay        int     `toml:"immune_delay"`        // only for immune_escape
+	// LandscapeTimes are the generations when each matrix in
+	// fitness_model_paths takes effect. The schedule repeats every
+	// landscape_period generations if the period is positive.
+	LandscapeTimes  []int  `toml:"landscape_times"`
+	LandscapePeriod int    `toml:"landscape_period"`
+	LandscapeMode   string `toml:"landscape_mode"` // switch, interpolate
+	hostIDs         []int
+	// matrixIDs are the model IDs of the matrices of a time_varying model.
+	matrixIDs []int
+	validated bool
 }
 
 // Validate checks the validity of the FitnessModelConfig configuration.
@@ -760,11 +1701,68 @@ func (c *fitnessModelConfig) Validate() error {
 	// check keywords
 	// fitness_model
 	err := checkKeyword(strings.ToLower(c.FitnessModel), "fitness_model",
-		"multiplicative", "additive", "additive_motif",
+		"multiplicative", "additive", "additive_motif", "epistasis",
+		"frequency_dependent", "immune_escape", "time_varying",
 	)
 	if err != nil {
 		return err
 	}
+	switch strings.ToLower(c.FitnessModel) {
+	case "time_varying":
+		// Assign default value
+		if c.BaseFitnessModel == "" {
+			c.BaseFitnessModel = "multiplicative"
+		}
+		if c.LandscapeMode == "" {
+			c.LandscapeMode = "switch"
+		}
+		// Matrices are loaded using LoadFitnessMatrix
+		err := checkKeyword(strings.ToLower(c.BaseFitnessModel), "base_fitness_model",
+			"multiplicative", "additive",
+		)
+		if err != nil {
+			return err
+		}
+		err = checkKeyword(strings.ToLower(c.LandscapeMode), "landscape_mode",
+			"switch", "interpolate",
+		)
+		if err != nil {
+			return err
+		}
+		err = c.validateLandscape()
+		if err != nil {
+			return err
+		}
+		c.validated = true
+		return nil
+	case "frequency_dependent", "immune_escape":
+		// Assign default value
+		if c.BaseFitnessModel == "" {
+			c.BaseFitnessModel = "multiplicative"
+		}
+		err := checkKeyword(strings.ToLower(c.BaseFitnessModel), "base_fitness_model",
+			"multiplicative", "additive", "additive_motif", "epistasis",
+		)
+		if err != nil {
+			return err
+		}
+	default:
+		if len(c.BaseFitnessModel) > 0 {
+			return fmt.Errorf("base_fitness_model is only used by frequency_dependent, immune_escape and time_varying fitness models")
+		}
+	}
+	if len(c.FitnessModelPaths) > 0 {
+		return fmt.Errorf("fitness_model_paths is only used by time_varying fitness models")
+	}
+	if c.CooperatorSite < 0 {
+		return fmt.Errorf(InvalidIntParameterError, "cooperator_site", c.CooperatorSite, "cannot be negative")
+	}
+	if c.CooperatorState < 0 {
+		return fmt.Errorf(InvalidIntParameterError, "cooperator_state", c.CooperatorState, "cannot be negative")
+	}
+	if c.ImmuneDelay < 0 {
+		return fmt.Errorf(InvalidIntParameterError, "immune_delay", c.ImmuneDelay, "cannot be negative")
+	}
 
 	// Check FitnessModelPath
 	exists, err := Exists(c.FitnessModelPath)
@@ -775,18 +1773,111 @@ func (c *fitnessModelConfig) Validate() error {
 		return fmt.Errorf("file in %s does not exist", c.FitnessModelPath)
 	}
 
-	// TODO: make sure host_ids are unique across models
 	c.validated = true
 	return nil
 }
 
+// validateLandscape checks the matrices and the schedule of
+// a time_varying model.
+func (c *fitnessModelConfig) validateLandscape() error {
+	if len(c.FitnessModelPath) > 0 {
+		return fmt.Errorf("time_varying fitness models use fitness_model_paths instead of fitness_model_path")
+	}
+	if len(c.FitnessModelPaths) < 1 {
+		return fmt.Errorf("time_varying fitness model requires at least one fitness matrix in fitness_model_paths")
+	}
+	for _, path := range c.FitnessModelPaths {
+		exists, err := Exists(path)
+		if err != nil {
+			return FileExistsCheckError(err, path)
+		}
+		if !exists {
+			return FileDoesNotExistError(path)
+		}
+	}
+	if len(c.LandscapeTimes) != len(c.FitnessModelPaths) {
+		return fmt.Errorf(UnequalIntParameterError, "number of landscape_times", len(c.FitnessModelPaths), len(c.LandscapeTimes))
+	}
+	for i, t := range c.LandscapeTimes {
+		if t < 0 {
+			return fmt.Errorf(InvalidIntParameterError, "landscape_times", t, "cannot be negative")
+		}
+		if i > 0 && t <= c.LandscapeTimes[i-1] {
+			return fmt.Errorf(InvalidIntParameterError, "landscape_times", t, "must be greater than the previous time")
+		}
+	}
+	if c.LandscapePeriod < 0 {
+		return fmt.Errorf(InvalidIntParameterError, "landscape_period", c.LandscapePeriod, "cannot be negative")
+	} else if last := c.LandscapeTimes[len(c.LandscapeTimes)-1]; c.LandscapePeriod > 0 && c.LandscapePeriod <= last {
+		return fmt.Errorf(InvalidIntParameterError, "landscape_period", c.LandscapePeriod, fmt.Sprintf("must be greater than the last landscape time (%d)", last))
+	}
+	return nil
+}
+
+// matrixModel returns the model of the file in fitness_model_path.
+func (c *fitnessModelConfig) matrixModel() string {
+	if len(c.BaseFitnessModel) > 0 {
+		return strings.ToLower(c.BaseFitnessModel)
+	}
+	return strings.ToLower(c.FitnessModel)
+}
+
 // CreateModel creates an FitnessModel based on the configuration.
 func (c *fitnessModelConfig) CreateModel(id int) (FitnessModel, error) {
 	if !c.validated {
 		return nil, fmt.Errorf("validate model parameters first")
 	}
-	// Create FitnessModel
-	switch c.FitnessModel {
+	if strings.ToLower(c.FitnessModel) == "time_varying" {
+		return c.createTimeVaryingModel(id)
+	}
+	model, err := c.createMatrixModel(id)
+	if err != nil {
+		return nil, err
+	}
+	// Context-dependent models share the ID of their base model. Only
+	// values of the base model are cached.
+	switch strings.ToLower(c.FitnessModel) {
+	case "frequency_dependent":
+		return NewFrequencyDependentFM(id, "frequency_dependent", model, c.FrequencySelection, c.CooperatorSite, uint8(c.CooperatorState), c.CooperationBenefit, c.CooperationCost)
+	case "immune_escape":
+		return NewImmuneEscapeFM(id, "immune_escape", model, c.ImmuneDelay)
+	}
+	return model, nil
+}
+
+// createTimeVaryingModel loads the matrices in fitness_model_paths and
+// creates a time-varying FitnessModel.
+func (c *fitnessModelConfig) createTimeVaryingModel(id int) (FitnessModel, error) {
+	if len(c.matrixIDs) != len(c.FitnessModelPaths) {
+		return nil, fmt.Errorf("model IDs of the matrices in fitness_model_paths were not assigned")
+	}
+	models := make([]FitnessModel, len(c.FitnessModelPaths))
+	for i, path := range c.FitnessModelPaths {
+		valueType := "log"
+		if strings.ToLower(c.BaseFitnessModel) == "additive" {
+			valueType = "dec"
+		}
+		matrix, err := LoadFitnessMatrix(path, valueType)
+		if err != nil {
+			return nil, err
+		}
+		if valueType == "log" {
+			models[i], err = NewMultiplicativeFM(c.matrixIDs[i], "multiplicative", matrix)
+		} else {
+			models[i], err = NewAdditiveFM(c.matrixIDs[i], "additive", matrix)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	interpolate := strings.ToLower(c.LandscapeMode) == "interpolate"
+	return NewTimeVaryingFM(id, "time_varying", models, c.LandscapeTimes, c.LandscapePeriod, interpolate)
+}
+
+// createMatrixModel creates the FitnessModel of the file in
+// fitness_model_path.
+func (c *fitnessModelConfig) createMatrixModel(id int) (FitnessModel, error) {
+	switch c.matrixModel() {
 	case "multiplicative":
 		matrix, err := LoadFitnessMatrix(c.FitnessModelPath, "log")
 		if err != nil {
@@ -799,27 +1890,129 @@ func (c *fitnessModelConfig) CreateModel(id int) (FitnessModel, error) {
 			return nil, err
 		}
 		return NewAdditiveFM(id, "additive", matrix)
+	case "epistasis":
+		fields, couplings, err := LoadEpistasisMatrix(c.FitnessModelPath)
+		if err != nil {
+			return nil, err
+		}
+		return NewEpistasisFM(id, "epistasis", fields, couplings)
 	}
 	// additive_motif
-	return nil, fmt.Errorf("additive_motif not yet implemented")
+	return LoadMotifModel(id, "additive_motif", c.FitnessModelPath)
 }
 
 type transModelConfig struct {
 	ModelName        string  `toml:"model_name"`
 	HostIDs          []int   `toml:"host_ids"`
-	Mode             string  `toml:"mode"` // poisson, constant
+	Mode             string  `toml:"mode"` // poisson, constant, negative_binomial, geometric, beta_binomial, load, infection_age
 	TransmissionProb float64 `toml:"transmission_prob"`
 	TransmissionSize float64 `toml:"transmission_size"`
-	validated        bool
+	SizeDistribution string  `toml:"size_distribution"` // only for load and infection_age
+	SizeDispersion   float64 `toml:"size_dispersion"`   // only for negative_binomial
+	SizeTrials       int     `toml:"size_trials"`       // only for beta_binomial
+	SizeAlpha        float64 `toml:"size_alpha"`        // only for beta_binomial
+	SizeBeta         float64 `toml:"size_beta"`         // only for beta_binomial
+	// HalfLoad is the number of pathogens in the source host where the
+	// transmission probability is half of transmission_prob.
+	HalfLoad float64 `toml:"half_load"` // only for load
+	// AgeProfile multiplies transmission_prob depending on the number of
+	// generations since the source host was infected.
+	AgeProfile []float64 `toml:"age_profile"` // only for infection_age
+	// TransmissionFitnessPath is a fitness matrix or motif file in the
+	// format of fitness_model_path that sets the relative transmissibility
+	// of pathogens in the transmission bottleneck.
+	TransmissionFitnessModel string `toml:"transmission_fitness_model"` // multiplicative, additive, additive_motif
+	TransmissionFitnessPath  string `toml:"transmission_fitness_path"`
+	// HostTypes and HostAttributes select hosts from the host attribute
+	// file in addition to the hosts listed in host_ids.
+	HostTypes      []int                  `toml:"host_types"`
+	HostAttributes map[string]interface{} `toml:"host_attributes"`
+	hostIDs        []int
+	validated      bool
 }
 
 // Validate checks the validity of the transModelConfig configuration.
 func (c *transModelConfig) Validate() error {
 	// check keywords
-	err := checkKeyword(strings.ToLower(c.Mode), "mode", "poisson", "constant")
+	err := checkKeyword(strings.ToLower(c.Mode), "mode",
+		"poisson", "constant",
+		"negative_binomial", "geometric", "beta_binomial",
+		"load", "infection_age",
+	)
 	if err != nil {
 		return err
 	}
+	sizeMode := strings.ToLower(c.Mode)
+	switch sizeMode {
+	case "load", "infection_age":
+		// Assign default value
+		if c.SizeDistribution == "" {
+			c.SizeDistribution = "poisson"
+		}
+		err = checkKeyword(strings.ToLower(c.SizeDistribution), "size_distribution",
+			"poisson", "constant",
+			"negative_binomial", "geometric", "beta_binomial",
+		)
+		if err != nil {
+			return err
+		}
+		sizeMode = strings.ToLower(c.SizeDistribution)
+	}
+	// Check parameters of the transmission size distribution
+	switch sizeMode {
+	case "negative_binomial":
+		if c.SizeDispersion <= 0 {
+			return fmt.Errorf(InvalidFloatParameterError, "size_dispersion", c.SizeDispersion, "must be greater than 0")
+		}
+	case "beta_binomial":
+		if c.SizeTrials < 1 {
+			return fmt.Errorf(InvalidIntParameterError, "size_trials", c.SizeTrials, "must be greater than or equal to 1")
+		}
+		if c.SizeAlpha <= 0 {
+			return fmt.Errorf(InvalidFloatParameterError, "size_alpha", c.SizeAlpha, "must be greater than 0")
+		}
+		if c.SizeBeta <= 0 {
+			return fmt.Errorf(InvalidFloatParameterError, "size_beta", c.SizeBeta, "must be greater than 0")
+		}
+	}
+	// Check parameters of the transmission probability
+	switch strings.ToLower(c.Mode) {
+	case "load":
+		if c.HalfLoad <= 0 {
+			return fmt.Errorf(InvalidFloatParameterError, "half_load", c.HalfLoad, "must be greater than 0")
+		}
+	case "infection_age":
+		if len(c.AgeProfile) == 0 {
+			return errors.Wrap(ZeroItemsError(), "age_profile cannot be empty")
+		}
+		for _, v := range c.AgeProfile {
+			if v < 0 {
+				return fmt.Errorf(InvalidFloatParameterError, "age_profile value", v, "cannot be negative")
+			}
+		}
+	}
+	// Check transmission fitness
+	if len(c.TransmissionFitnessPath) > 0 {
+		// Assign default value
+		if c.TransmissionFitnessModel == "" {
+			c.TransmissionFitnessModel = "multiplicative"
+		}
+		err = checkKeyword(strings.ToLower(c.TransmissionFitnessModel), "transmission_fitness_model",
+			"multiplicative", "additive", "additive_motif", "epistasis",
+		)
+		if err != nil {
+			return err
+		}
+		exists, err := Exists(c.TransmissionFitnessPath)
+		if err != nil {
+			return FileExistsCheckError(err, c.TransmissionFitnessPath)
+		}
+		if !exists {
+			return FileDoesNotExistError(c.TransmissionFitnessPath)
+		}
+	} else if len(c.TransmissionFitnessModel) > 0 {
+		return fmt.Errorf("transmission_fitness_model requires a fitness matrix in transmission_fitness_path")
+	}
 	c.validated = true
 	return nil
 }
@@ -828,21 +2021,177 @@ func (c *transModelConfig) CreateModel(id int) (TransmissionModel, error) {
 	if !c.validated {
 		return nil, fmt.Errorf("validate model parameters first")
 	}
-	switch c.Mode {
+	model, err := c.createProbModel()
+	if err != nil {
+		return nil, err
+	}
+	if len(c.TransmissionFitnessPath) == 0 {
+		return model, nil
+	}
+	// Weight pathogens by their transmission fitness
+	var fitness FitnessMatrix
+	switch strings.ToLower(c.TransmissionFitnessModel) {
+	case "multiplicative":
+		matrix, err := LoadFitnessMatrix(c.TransmissionFitnessPath, "log")
+		if err != nil {
+			return nil, err
+		}
+		fitness, err = NewMultiplicativeFM(id, "multiplicative", matrix)
+		if err != nil {
+			return nil, err
+		}
+	case "additive":
+		matrix, err := LoadFitnessMatrix(c.TransmissionFitnessPath, "dec")
+		if err != nil {
+			return nil, err
+		}
+		fitness, err = NewAdditiveFM(id, "additive", matrix)
+		if err != nil {
+			return nil, err
+		}
+	case "additive_motif":
+		fitness, err = LoadMotifModel(id, "additive_motif", c.TransmissionFitnessPath)
+		if err != nil {
+			return nil, err
+		}
+	case "epistasis":
+		fields, couplings, err := LoadEpistasisMatrix(c.TransmissionFitnessPath)
+		if err != nil {
+			return nil, err
+		}
+		fitness, err = NewEpistasisFM(id, "epistasis", fields, couplings)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &fitnessTransmitter{model, fitness}, nil
+}
+
+// createProbModel creates a TransmissionModel based on the mode.
+func (c *transModelConfig) createProbModel() (TransmissionModel, error) {
+	switch strings.ToLower(c.Mode) {
+	case "load":
+		model := new(loadTransmitter)
+		model.TransmissionModel = c.createSizeModel(c.SizeDistribution)
+		model.SetModelName(c.ModelName)
+		model.prob = c.TransmissionProb
+		model.halfLoad = c.HalfLoad
+		return model, nil
+	case "infection_age":
+		model := new(ageTransmitter)
+		model.TransmissionModel = c.createSizeModel(c.SizeDistribution)
+		model.SetModelName(c.ModelName)
+		model.prob = c.TransmissionProb
+		model.profile = c.AgeProfile
+		return model, nil
+	}
+	if model := c.createSizeModel(c.Mode); model != nil {
+		return model, nil
+	}
+	return nil, fmt.Errorf(UnrecognizedKeywordError, c.Mode, "mode")
+}
+
+// createSizeModel creates a TransmissionModel with a constant transmission
+// probability whose transmission sizes follow the given distribution.
+// Returns nil if the distribution is not recognized.
+func (c *transModelConfig) createSizeModel(distribution string) TransmissionModel {
+	switch strings.ToLower(distribution) {
 	case "poisson":
 		model := new(poissonTransmitter)
 		model.name = c.ModelName
 		model.prob = c.TransmissionProb
 		model.size = c.TransmissionSize
-		return model, nil
+		return model
 	case "constant":
 		model := new(constantTransmitter)
 		model.name = c.ModelName
 		model.prob = c.TransmissionProb
 		model.size = int(c.TransmissionSize)
-		return model, nil
+		return model
+	case "negative_binomial":
+		model := new(negBinomialTransmitter)
+		model.name = c.ModelName
+		model.prob = c.TransmissionProb
+		model.size = c.TransmissionSize
+		model.dispersion = c.SizeDispersion
+		return model
+	case "geometric":
+		model := new(geometricTransmitter)
+		model.name = c.ModelName
+		model.prob = c.TransmissionProb
+		model.size = c.TransmissionSize
+		return model
+	case "beta_binomial":
+		model := new(betaBinomialTransmitter)
+		model.name = c.ModelName
+		model.prob = c.TransmissionProb
+		model.trials = c.SizeTrials
+		model.alpha = c.SizeAlpha
+		model.beta = c.SizeBeta
+		return model
 	}
-	return nil, fmt.Errorf(UnrecognizedKeywordError, c.Mode, "mode")
+	return nil
+}
+
+type compartmentConfig struct {
+	Name       string `toml:"name"`
+	Code       int    `toml:"code"` // optional, preset names use preset codes
+	Duration   int    `toml:"duration"`
+	Infected   bool   `toml:"infected"`
+	Infectable bool   `toml:"infectable"`
+	Transmits  bool   `toml:"transmits"`
+	validated  bool
+}
+
+// Validate checks the validity of the compartmentConfig configuration.
+func (c *compartmentConfig) Validate() error {
+	if len(c.Name) == 0 {
+		return fmt.Errorf("compartment name cannot be empty")
+	}
+	if c.Code < 0 {
+		return fmt.Errorf(InvalidIntParameterError, "code", c.Code, "cannot be negative")
+	}
+	if c.Duration < 0 {
+		return fmt.Errorf(InvalidIntParameterError, "duration", c.Duration, "cannot be negative")
+	}
+	c.validated = true
+	return nil
+}
+
+type transitionConfig struct {
+	From      string  `toml:"from"`
+	To        string  `toml:"to"`
+	Trigger   string  `toml:"trigger"` // timer, infection, clearance, load_above, load_below, infective_threshold, clearance_threshold
+	Threshold int     `toml:"threshold"`
+	Prob      float64 `toml:"probability"`
+	validated bool
+}
+
+// Validate checks the validity of the transitionConfig configuration.
+func (c *transitionConfig) Validate() error {
+	// check keywords
+	err := checkKeyword(strings.ToLower(c.Trigger), "trigger",
+		TimerTrigger, InfectionTrigger, ClearanceTrigger,
+		LoadAboveTrigger, LoadBelowTrigger,
+		InfectiveThresholdTrigger, ClearanceThresholdTrigger,
+	)
+	if err != nil {
+		return err
+	}
+	if c.From == c.To {
+		return fmt.Errorf("transition from %s to itself is not allowed", c.From)
+	}
+	switch strings.ToLower(c.Trigger) {
+	case LoadAboveTrigger, LoadBelowTrigger:
+		if c.Threshold < 1 {
+			return fmt.Errorf(InvalidIntParameterError, "threshold", c.Threshold, "must be greater than or equal to 1")
+		}
+	}
+	if c.Prob < 0 || c.Prob > 1 {
+		return fmt.Errorf(InvalidFloatParameterError, "probability", c.Prob, "must be between 0 and 1")
+	}
+	c.validated = true
+	return nil
 }
 
 type stopConditionConfig struct {
@@ -904,3 +2253,298 @@ func (c *stopConditionConfig) CreateCondition(charList []string) (StopCondition,
 	}
 	return nil, fmt.Errorf(UnrecognizedKeywordError, c.Condition, "condition")
 }
+
+type interventionConfig struct {
+	Action     string  `toml:"action"`  // vaccinate, isolate, treat, set_transmission_prob
+	Trigger    string  `toml:"trigger"` // generation, prevalence
+	Generation int     `toml:"generation"`
+	Interval   int     `toml:"interval"`
+	Threshold  float64 `toml:"threshold"` // only for prevalence
+	// NumHosts is the number of eligible hosts acted on every time the
+	// intervention is applied. If 0, all eligible hosts are acted on.
+	NumHosts  int    `toml:"num_hosts"` // only for vaccinate, isolate and treat
+	Selection string `toml:"selection"` // random, degree
+	// Duration is the number of generations hosts stay isolated or treated.
+	// If 0, hosts are never released.
+	Duration int `toml:"duration"` // only for isolate and treat
+	// Treated hosts either switch to the fitness model named in
+	// fitness_model, or keep their fitness model and have their fitness
+	// multiplied by the drug sensitivity of every drug site where
+	// pathogens carry the drug-sensitive state.
+	FitnessModel        string    `toml:"fitness_model"`         // only for treat
+	DrugSites           []int     `toml:"drug_sites"`            // only for treat
+	DrugSensitiveStates []string  `toml:"drug_sensitive_states"` // only for treat
+	DrugSensitivity     []float64 `toml:"drug_sensitivity"`      // only for treat
+	ModelName           string    `toml:"model_name"`            // only for set_transmission_prob
+	TransmissionProb    float64   `toml:"transmission_prob"`     // only for set_transmission_prob
+	// HostIDs, HostTypes and HostAttributes restrict the hosts that are
+	// eligible. If none are given, all hosts are eligible.
+	HostIDs        []int                  `toml:"host_ids"`
+	HostTypes      []int                  `toml:"host_types"`
+	HostAttributes map[string]interface{} `toml:"host_attributes"`
+	hostIDs        []int
+	fitnessModelID int
+	validated      bool
+}
+
+// Validate checks the validity of the interventionConfig configuration.
+func (c *interventionConfig) Validate() error {
+	// check keywords
+	err := checkKeyword(strings.ToLower(c.Action), "action",
+		VaccinateAction, IsolateAction, TreatAction, TransmissionProbAction,
+	)
+	if err != nil {
+		return err
+	}
+	// Assign default value
+	if c.Trigger == "" {
+		c.Trigger = ScheduleTrigger
+	}
+	err = checkKeyword(strings.ToLower(c.Trigger), "trigger",
+		ScheduleTrigger, PrevalenceTrigger,
+	)
+	if err != nil {
+		return err
+	}
+	// Assign default value
+	if c.Selection == "" {
+		c.Selection = RandomSelection
+	}
+	err = checkKeyword(strings.ToLower(c.Selection), "selection",
+		RandomSelection, DegreeSelection,
+	)
+	if err != nil {
+		return err
+	}
+	if c.Generation < 0 {
+		return fmt.Errorf(InvalidIntParameterError, "generation", c.Generation, "cannot be negative")
+	}
+	if c.Interval < 0 {
+		return fmt.Errorf(InvalidIntParameterError, "interval", c.Interval, "cannot be negative")
+	}
+	if c.NumHosts < 0 {
+		return fmt.Errorf(InvalidIntParameterError, "num_hosts", c.NumHosts, "cannot be negative")
+	}
+	if c.Duration < 0 {
+		return fmt.Errorf(InvalidIntParameterError, "duration", c.Duration, "cannot be negative")
+	}
+	if strings.ToLower(c.Trigger) == PrevalenceTrigger {
+		if c.Threshold <= 0 || c.Threshold > 1 {
+			return fmt.Errorf(InvalidFloatParameterError, "threshold", c.Threshold, "must be greater than 0 and less than or equal to 1")
+		}
+	}
+	if strings.ToLower(c.Action) == TreatAction {
+		if (len(c.FitnessModel) > 0) == (len(c.DrugSites) > 0) {
+			return fmt.Errorf("%s requires either the name of a fitness model in fitness_model or drug sites in drug_sites", TreatAction)
+		}
+		if len(c.DrugSensitiveStates) != len(c.DrugSites) {
+			return fmt.Errorf(UnequalIntParameterError, "number of drug_sensitive_states", len(c.DrugSites), len(c.DrugSensitiveStates))
+		}
+		if len(c.DrugSensitivity) != len(c.DrugSites) {
+			return fmt.Errorf(UnequalIntParameterError, "number of drug_sensitivity values", len(c.DrugSites), len(c.DrugSensitivity))
+		}
+		for _, pos := range c.DrugSites {
+			if pos < 0 {
+				return fmt.Errorf(InvalidIntParameterError, "drug site", pos, "cannot be negative")
+			}
+		}
+		for _, v := range c.DrugSensitivity {
+			if v < 0 || v > 1 {
+				return fmt.Errorf(InvalidFloatParameterError, "drug_sensitivity", v, "must be between 0 and 1")
+			}
+		}
+	}
+	if strings.ToLower(c.Action) == TransmissionProbAction {
+		if len(c.ModelName) == 0 {
+			return fmt.Errorf("%s requires the name of a transmission model in model_name", TransmissionProbAction)
+		}
+		if c.TransmissionProb < 0 || c.TransmissionProb > 1 {
+			return fmt.Errorf(InvalidFloatParameterError, "transmission_prob", c.TransmissionProb, "must be between 0 and 1")
+		}
+	}
+	c.validated = true
+	return nil
+}
+
+// CreateIntervention creates the intervention described by the
+// configuration. Treatments use the fitness models of the simulation,
+// and drug sensitivity models created for intervention id are numbered
+// after the IDs of the fitness models used by other interventions.
+func (c *interventionConfig) CreateIntervention(id int, fitnessModels map[int]FitnessModel, charList []string) (Intervention, error) {
+	if !c.validated {
+		return nil, fmt.Errorf("validate model parameters first")
+	}
+	trigger := strings.ToLower(c.Trigger)
+	selection := strings.ToLower(c.Selection)
+	switch strings.ToLower(c.Action) {
+	case VaccinateAction:
+		return NewVaccination(id, trigger, c.Generation, c.Interval, c.Threshold, c.hostIDs, c.NumHosts, selection), nil
+	case IsolateAction:
+		return NewIsolation(id, trigger, c.Generation, c.Interval, c.Threshold, c.hostIDs, c.NumHosts, selection, c.Duration), nil
+	case TreatAction:
+		models, err := c.treatmentModels(id, fitnessModels, charList)
+		if err != nil {
+			return nil, err
+		}
+		return NewTreatment(id, trigger, c.Generation, c.Interval, c.Threshold, c.hostIDs, c.NumHosts, selection, c.Duration, models), nil
+	case TransmissionProbAction:
+		return NewTransmissionProbChange(id, trigger, c.Generation, c.Interval, c.Threshold, c.ModelName, c.TransmissionProb), nil
+	}
+	return nil, fmt.Errorf(UnrecognizedKeywordError, c.Action, "action")
+}
+
+// treatmentModels maps the ID of each fitness model to the fitness model
+// its hosts use during treatment.
+func (c *interventionConfig) treatmentModels(id int, fitnessModels map[int]FitnessModel, charList []string) (map[int]FitnessModel, error) {
+	models := make(map[int]FitnessModel)
+	if len(c.FitnessModel) > 0 {
+		treated, exists := fitnessModels[c.fitnessModelID]
+		if !exists {
+			return nil, fmt.Errorf("fitness model %s does not exist", c.FitnessModel)
+		}
+		for modelID := range fitnessModels {
+			models[modelID] = treated
+		}
+		return models, nil
+	}
+	states := make([]uint8, len(c.DrugSensitiveStates))
+	for i, state := range c.DrugSensitiveStates {
+		found := false
+		for j, char := range charList {
+			if strings.ToLower(state) == strings.ToLower(char) {
+				states[i] = uint8(j)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, InvalidStateCharError(state, i)
+		}
+	}
+	// Each intervention gets its own range of model IDs so that
+	// fitness values cached by genotypes are not mixed up
+	n := len(fitnessModels)
+	for modelID, model := range fitnessModels {
+		name := model.ModelName() + "_treated"
+		treated, err := NewDrugSensitivityFM(n*(id+1)+modelID, name, model, c.DrugSites, states, c.DrugSensitivity)
+		if err != nil {
+			return nil, err
+		}
+		models[modelID] = treated
+	}
+	return models, nil
+}
+
+type demographyConfig struct {
+	BirthRate        float64 `toml:"birth_rate"`         // expected births per host per generation
+	DeathRate        float64 `toml:"death_rate"`         // probability per host per generation
+	DiseaseDeathRate float64 `toml:"disease_death_rate"` // probability per infected host per generation
+	ImmigrationRate  float64 `toml:"immigration_rate"`   // expected immigrants per generation
+	EmigrationRate   float64 `toml:"emigration_rate"`    // probability per host per generation
+	// ImmigrantInfectionProb is the probability that an immigrant carries
+	// the pathogens seeded in one of the hosts at the start of the
+	// simulation.
+	ImmigrantInfectionProb float64 `toml:"immigrant_infection_prob"`
+	Attachment             string  `toml:"attachment"` // random, preferential
+	NumConnections         int     `toml:"num_connections"`
+	ConnectionWeight       float64 `toml:"connection_weight"`
+	// Names of the models assigned to new hosts. May be omitted if only
+	// one model of that kind exists.
+	IntrahostModel    string `toml:"intrahost_model"`
+	FitnessModel      string `toml:"fitness_model"`
+	TransmissionModel string `toml:"transmission_model"`
+	intrahostModelID  int
+	fitnessModelID    int
+	transModelID      int
+	validated         bool
+}
+
+// Validate checks the validity of the demographyConfig configuration.
+func (c *demographyConfig) Validate() error {
+	if c.BirthRate < 0 {
+		return fmt.Errorf(InvalidFloatParameterError, "birth_rate", c.BirthRate, "cannot be negative")
+	}
+	if c.ImmigrationRate < 0 {
+		return fmt.Errorf(InvalidFloatParameterError, "immigration_rate", c.ImmigrationRate, "cannot be negative")
+	}
+	probs := []struct {
+		name  string
+		value float64
+	}{
+		{"death_rate", c.DeathRate},
+		{"disease_death_rate", c.DiseaseDeathRate},
+		{"emigration_rate", c.EmigrationRate},
+		{"immigrant_infection_prob", c.ImmigrantInfectionProb},
+	}
+	for _, p := range probs {
+		if p.value < 0 || p.value > 1 {
+			return fmt.Errorf(InvalidFloatParameterError, p.name, p.value, "must be between 0 and 1")
+		}
+	}
+	// Assign default value
+	if c.Attachment == "" {
+		c.Attachment = RandomAttachment
+	}
+	err := checkKeyword(strings.ToLower(c.Attachment), "attachment",
+		RandomAttachment, PreferentialAttachment,
+	)
+	if err != nil {
+		return err
+	}
+	if c.NumConnections < 0 {
+		return fmt.Errorf(InvalidIntParameterError, "num_connections", c.NumConnections, "cannot be negative")
+	}
+	// Assign default value
+	if c.ConnectionWeight == 0 {
+		c.ConnectionWeight = 1
+	}
+	if c.ConnectionWeight < 0 || c.ConnectionWeight > 1 {
+		return fmt.Errorf(InvalidFloatParameterError, "connection_weight", c.ConnectionWeight, "must be greater than 0 and less than or equal to 1")
+	}
+	c.validated = true
+	return nil
+}
+
+// CreateDemography creates the demographic processes described by the
+// configuration. New hosts use the models with the IDs resolved during
+// validation. Infected immigrants carry one of the sets of seeded
+// sequences, and new hosts are numbered from firstHostID.
+func (c *demographyConfig) CreateDemography(intrahostModels map[int]IntrahostModel, fitnessModels map[int]FitnessModel, transModels map[int]TransmissionModel, seeds [][][]uint8, firstHostID int) (*Demography, error) {
+	if !c.validated {
+		return nil, fmt.Errorf("validate model parameters first")
+	}
+	d := &Demography{
+		BirthRate:              c.BirthRate,
+		DeathRate:              c.DeathRate,
+		DiseaseDeathRate:       c.DiseaseDeathRate,
+		ImmigrationRate:        c.ImmigrationRate,
+		EmigrationRate:         c.EmigrationRate,
+		ImmigrantInfectionProb: c.ImmigrantInfectionProb,
+		Attachment:             strings.ToLower(c.Attachment),
+		NumConnections:         c.NumConnections,
+		ConnectionWeight:       c.ConnectionWeight,
+		IntrahostModel:         intrahostModels[c.intrahostModelID],
+		FitnessModel:           fitnessModels[c.fitnessModelID],
+		TransmissionModel:      transModels[c.transModelID],
+		Seeds:                  seeds,
+		NextHostID:             firstHostID,
+	}
+	return d, nil
+}
+
+// demographyModelID returns the index of the model with the given name.
+// If the name is empty, the only model is used.
+func demographyModelID(kind, name string, names []string) (int, error) {
+	if name == "" {
+		if len(names) != 1 {
+			return 0, fmt.Errorf("demography requires the name of the %s model assigned to new hosts", kind)
+		}
+		return 0, nil
+	}
+	for i, n := range names {
+		if n == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("demography assigns %s model %s that does not exist", kind, name)
+}
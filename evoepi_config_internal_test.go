@@ -0,0 +1,32 @@
+package contagiongo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckModelHostIDs(t *testing.T) {
+	var tests = []struct {
+		hostIDs  [][]int
+		expected string
+	}{
+		{[][]int{{0, 1}, {2, 3}}, ""},
+		{[][]int{{0, 1, 5}, {2, 3, -1}}, "[-1 5]"},
+		{[][]int{{0, 1, 2}, {1, 2, 3}}, "[1 2]"},
+		{[][]int{{0}, {3}}, "[1 2]"},
+	}
+	for _, tt := range tests {
+		err := checkModelHostIDs("intrahost model", 4, tt.hostIDs)
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf(UnexpectedErrorWhileError, "checking host IDs", err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf(ExpectedErrorWhileError, "checking host IDs")
+		} else if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected error listing %s, got %q instead", tt.expected, err)
+		}
+	}
+}
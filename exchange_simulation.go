@@ -1,8 +1,6 @@
 package contagiongo
 
 import (
-	"fmt"
-	"strings"
 	"sync"
 
 	"github.com/segmentio/ksuid"
@@ -13,10 +11,6 @@ import (
 // In ExchangeSimulation, all hosts are initially infected.
 type ExchangeSimulation struct {
 	SISimulation
-
-	instanceID     int
-	numGenerations int
-	logFreq        int
 }
 
 // NewExchangeSimulation creates a new migration simulation.
@@ -30,26 +24,19 @@ func NewExchangeSimulation(config Config, logger DataLogger) (*ExchangeSimulatio
 	sim.DataLogger = logger
 	sim.numGenerations = config.NumGenerations()
 	sim.logFreq = config.LogFreq()
+	sim.logTransmission = config.LogTransmission()
+	sim.checkpointFreq = config.CheckpointFreq()
+	sim.logPath = config.LogPath()
+	sim.configPath = config.ConfigPath()
 	return sim, nil
 }
 
 // Run instantiates, runs, and records the a new simulation.
+// Each generation runs the same steps as the other epidemic models,
+// including interventions, changes to the host population and
+// checkpoints.
 func (sim *ExchangeSimulation) Run(i int) {
-	sim.Init()
-	sim.instanceID = i
-	// Initial state
-	sim.Update(0)
-	t := 0
-	for t < sim.numGenerations {
-		t++
-		fmt.Printf("instance %04d\tgeneration %05d\n", i, t)
-		sim.Process(t)
-		sim.Transmit(t)
-		// State after t generation
-		sim.Update(t)
-	}
-	fmt.Println(strings.Repeat("-", 80))
-	sim.Finalize()
+	runEpidemic(sim, i)
 }
 
 // Update looks at the timer or internal state to decide if
@@ -67,7 +54,7 @@ func (sim *ExchangeSimulation) Update(t int) {
 		// Simulation-level record of status and timer of particular host
 		timer := sim.HostTimer(hostID)
 		pack := StatusPackage{
-			instanceID: sim.instanceID,
+			instanceID: sim.InstanceID(),
 			genID:      t,
 			hostID:     hostID,
 			status:     sim.HostStatus(hostID), // current host status before checking
@@ -75,6 +62,7 @@ func (sim *ExchangeSimulation) Update(t int) {
 		wg.Add(1)
 		go func(i, t int, host Host, timer int, pack StatusPackage, c chan<- StatusPackage, d chan<- GenotypeFreqPackage, wg *sync.WaitGroup) {
 			defer wg.Done()
+			r := sim.Rand(t, updateStream, host.ID())
 			// Add cases depending on the compartmental model being used
 			// In this case, SI only uses susceptible and infected statuses
 			switch pack.status {
@@ -83,14 +71,14 @@ func (sim *ExchangeSimulation) Update(t int) {
 				if timer == 0 || host.PathogenPopSize() > 0 {
 					// Set new host status
 					newStatus := InfectedStatusCode
-					newDuration := host.GetIntrahostModel().StatusDuration(newStatus)
+					newDuration := host.GetIntrahostModel().StatusDuration(r, newStatus)
 					sim.SetHostStatus(host.ID(), newStatus)
 					sim.SetHostTimer(host.ID(), newDuration)
 					// Update status in pack and send
 					pack.status = newStatus
 				}
 			case InfectedStatusCode:
-				if timer == 0 || host.PathogenPopSize() == 0 {
+				if timer == 0 || host.PathogenPopSize() == 0 || ClearanceThresholdReached(host) {
 					// Set new host status
 					newStatus := RemovedStatusCode
 					newDuration := -1 // Host is permanently removed from the population of infectables
@@ -99,6 +87,24 @@ func (sim *ExchangeSimulation) Update(t int) {
 					// Update status in pack and send
 					pack.status = newStatus
 				}
+			case VaccinatedStatusCode:
+				if host.PathogenPopSize() > 0 {
+					// Vaccinated hosts that were infected become infected
+					newStatus := InfectedStatusCode
+					newDuration := host.GetIntrahostModel().StatusDuration(r, newStatus)
+					sim.SetHostStatus(host.ID(), newStatus)
+					sim.SetHostTimer(host.ID(), newDuration)
+					// Update status in pack and send
+					pack.status = newStatus
+				} else if timer == 0 {
+					// Set new host status
+					newStatus := SusceptibleStatusCode
+					newDuration := -1 // Vaccine-induced immunity wanes
+					sim.SetHostStatus(host.ID(), newStatus)
+					sim.SetHostTimer(host.ID(), newDuration)
+					// Update status in pack and send
+					pack.status = newStatus
+				}
 			}
 			// Send pack after all changes
 			c <- pack
@@ -116,7 +122,7 @@ func (sim *ExchangeSimulation) Update(t int) {
 					freq:       freq,
 				}
 			}
-		}(sim.instanceID, t, host, timer, pack, c, d, &wg)
+		}(sim.InstanceID(), t, host, timer, pack, c, d, &wg)
 	}
 	go func() {
 		wg.Wait()
@@ -150,11 +156,13 @@ func (sim *ExchangeSimulation) Process(t int) {
 		wg.Add(1)
 		switch sim.HostStatus(hostID) {
 		case SusceptibleStatusCode:
-			go sim.SusceptibleProcess(sim.instanceID, t, host, &wg)
+			go sim.SusceptibleProcess(sim.InstanceID(), t, host, &wg)
 		case InfectedStatusCode:
-			go sim.InfectedProcess(sim.instanceID, t, host, c, &wg)
+			go sim.InfectedProcess(sim.InstanceID(), t, host, c, &wg)
 		case RemovedStatusCode:
-			go sim.RemovedProcess(sim.instanceID, t, host, &wg)
+			go sim.RemovedProcess(sim.InstanceID(), t, host, &wg)
+		case VaccinatedStatusCode:
+			go sim.VaccinatedProcess(sim.InstanceID(), t, host, &wg)
 		}
 		// Decrement host timer.
 		// If status depends on timer, then timer will go positive integer
@@ -189,16 +197,16 @@ func (sim *ExchangeSimulation) Transmit(t int) {
 	}
 	// Iterate using pre-assembled list of infected hosts
 	for i, host := range infectedHosts {
-		// Iterate over host's neighbors and create a new goroutine
+		// Iterate over host's contacts and create a new goroutine
 		// that determines whether pathogens transmit or not
 		hostID := host.ID()
 		h1Count := pathogenPopSizes[i]
-		for _, neighbor := range sim.HostNeighbors(hostID) {
+		for _, neighbor := range sim.HostContacts(t, hostID) {
 			status := sim.HostStatus(neighbor.ID())
 			h2Count := neighbor.PathogenPopSize()
 			if status == InfectedStatusCode {
 				wg.Add(1)
-				go ExchangePathogens(sim.instanceID, t, host, neighbor, h1Count, h2Count, c, d, &wg)
+				go ExchangePathogens(sim.Rand(t, transmitStream, hostID, neighbor.ID()), sim.InstanceID(), t, host, neighbor, h1Count, h2Count, t-sim.InfectionTime(hostID), c, d, &wg)
 			}
 		}
 	}
@@ -212,9 +220,12 @@ func (sim *ExchangeSimulation) Transmit(t int) {
 	var wg2 sync.WaitGroup
 	wg2.Add(2)
 	// removePathogens := make(map[int][]int)
+	// Pathogens are added only after all exchanges are decided so that
+	// pathogens picked from a host do not depend on goroutine scheduling
+	var events []ExchangeEvent
 	go func() {
 		for t := range c {
-			t.destination.AddPathogens(t.pathogen)
+			events = append(events, t)
 			// removePathogens[t.source.ID()] = append(removePathogens[t.source.ID()], t.pathogenIndex)
 		}
 		wg2.Done()
@@ -224,6 +235,9 @@ func (sim *ExchangeSimulation) Transmit(t int) {
 		wg2.Done()
 	}()
 	wg2.Wait()
+	for _, t := range events {
+		t.destination.AddPathogens(t.pathogen)
+	}
 	// Remove pathogens
 	// for i, indices := range removePathogens {
 	// 	sim.Host(i).RemovePathogens(indices...)
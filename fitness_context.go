@@ -0,0 +1,388 @@
+package contagiongo
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/ksuid"
+)
+
+// FitnessContext is the state of a host and of its pathogen population at
+// the time the fitness of its pathogens is evaluated.
+// A FitnessContext is not safe for concurrent use.
+type FitnessContext struct {
+	// Time is the current generation.
+	Time int
+	// InfectionTime is the generation when the host was infected.
+	InfectionTime int
+	Host          Host
+	// Pathogens are the pathogens in the host before replication.
+	Pathogens []GenotypeNode
+
+	counts map[ksuid.KSUID]int
+	// modelValues holds values that fitness models compute once
+	// per context. Key is the fitness model ID.
+	modelValues map[int]float64
+}
+
+// NewFitnessContext creates the context of the pathogens of the host
+// at generation t.
+func NewFitnessContext(t, infectionTime int, host Host, pathogens []GenotypeNode) *FitnessContext {
+	return &FitnessContext{Time: t, InfectionTime: infectionTime, Host: host, Pathogens: pathogens}
+}
+
+// Frequency returns the fraction of pathogens in the host that have
+// the given genotype.
+func (ctx *FitnessContext) Frequency(g Genotype) float64 {
+	if len(ctx.Pathogens) == 0 {
+		return 0
+	}
+	// Count genotypes once and reuse the counts for other genotypes
+	if ctx.counts == nil {
+		ctx.counts = make(map[ksuid.KSUID]int)
+		for _, p := range ctx.Pathogens {
+			ctx.counts[p.GenotypeUID()]++
+		}
+	}
+	return float64(ctx.counts[g.GenotypeUID()]) / float64(len(ctx.Pathogens))
+}
+
+// ContextFitnessModel is a type of FitnessModel where the fitness of a
+// genotype can also depend on the host and on the other pathogens in the
+// host. Fitness that depends on the context is never stored in the
+// fitness cache of the genotype. ComputeFitness returns the fitness of
+// the sequence without the effect of the context.
+type ContextFitnessModel interface {
+	FitnessModel
+	// ContextDependent tells whether fitness depends on the context.
+	// If false, fitness only depends on the sequence and is cached.
+	ContextDependent() bool
+	// ContextFitness returns the fitness of the genotype given the
+	// context.
+	ContextFitness(ctx *FitnessContext, g Genotype) (fitness float64, err error)
+}
+
+// FitnessInContext returns the fitness of the genotype given the fitness
+// model and the context. Fitness is returned from the cache of the
+// genotype if the fitness model does not depend on the context.
+func FitnessInContext(f FitnessModel, ctx *FitnessContext, g Genotype) float64 {
+	if cf, ok := f.(ContextFitnessModel); ok && cf.ContextDependent() {
+		fitness, _ := cf.ContextFitness(ctx, g)
+		return fitness
+	}
+	return g.Fitness(f)
+}
+
+// logFitnessModel tells whether the fitness model returns log fitness.
+func logFitnessModel(f FitnessModel) bool {
+	if m, ok := f.(interface{ Log() bool }); ok {
+		return m.Log()
+	}
+	return false
+}
+
+// frequencyDependentFM is a fitness model where the fitness computed by
+// a base fitness model changes with the composition of the pathogen
+// population in the host. In log form,
+//
+//	log w(g) = log w0(g) - selection * p(g) + benefit * p(c) - cost * c(g)
+//
+// where p(g) is the frequency of the genotype, c(g) is 1 if the genotype
+// is a cooperator and 0 otherwise, and p(c) is the frequency of
+// cooperators. A positive selection coefficient favors rare genotypes
+// while a negative coefficient favors common genotypes. Cooperators carry
+// the cooperator state at the cooperator site and pay a cost to produce
+// a benefit shared by every pathogen in the host.
+type frequencyDependentFM struct {
+	modelMetadata
+	base      FitnessModel
+	selection float64
+	coopSite  int
+	coopState uint8
+	benefit   float64
+	cost      float64
+}
+
+// NewFrequencyDependentFM creates a frequency-dependent fitness model on
+// top of the base fitness model. Set the benefit and the cost to 0 to
+// disable cooperation.
+func NewFrequencyDependentFM(id int, name string, base FitnessModel, selection float64, coopSite int, coopState uint8, benefit, cost float64) (FitnessModel, error) {
+	if base == nil {
+		return nil, fmt.Errorf("frequency-dependent fitness model requires a base fitness model")
+	}
+	if coopSite < 0 {
+		return nil, fmt.Errorf(InvalidIntParameterError, "cooperator site", coopSite, "cannot be negative")
+	}
+	fm := new(frequencyDependentFM)
+	fm.id = id
+	fm.name = name
+	fm.base = base
+	fm.selection = selection
+	fm.coopSite = coopSite
+	fm.coopState = coopState
+	fm.benefit = benefit
+	fm.cost = cost
+	return fm, nil
+}
+
+// ComputeFitness returns the fitness of the sequence under the base
+// fitness model.
+func (fm *frequencyDependentFM) ComputeFitness(chars ...uint8) (fitness float64, err error) {
+	return fm.base.ComputeFitness(chars...)
+}
+
+func (fm *frequencyDependentFM) ContextDependent() bool {
+	return true
+}
+
+// ContextFitness returns the fitness of the genotype given the frequency
+// of the genotype and of cooperators in the host.
+func (fm *frequencyDependentFM) ContextFitness(ctx *FitnessContext, g Genotype) (fitness float64, err error) {
+	fitness = FitnessInContext(fm.base, ctx, g)
+	effect := -fm.selection * ctx.Frequency(g)
+	if fm.benefit != 0 || fm.cost != 0 {
+		effect += fm.benefit * fm.cooperatorFrequency(ctx)
+		if fm.cooperator(g.Sequence()) {
+			effect -= fm.cost
+		}
+	}
+	if fm.Log() {
+		return fitness + effect, nil
+	}
+	return fitness * math.Exp(effect), nil
+}
+
+// cooperatorFrequency returns the fraction of pathogens in the host that
+// are cooperators.
+func (fm *frequencyDependentFM) cooperatorFrequency(ctx *FitnessContext) float64 {
+	if freq, ok := ctx.modelValues[fm.id]; ok {
+		return freq
+	}
+	if len(ctx.Pathogens) == 0 {
+		return 0
+	}
+	var cooperators int
+	for _, p := range ctx.Pathogens {
+		if fm.cooperator(p.Sequence()) {
+			cooperators++
+		}
+	}
+	if ctx.modelValues == nil {
+		ctx.modelValues = make(map[int]float64)
+	}
+	ctx.modelValues[fm.id] = float64(cooperators) / float64(len(ctx.Pathogens))
+	return ctx.modelValues[fm.id]
+}
+
+func (fm *frequencyDependentFM) cooperator(sequence []uint8) bool {
+	return fm.coopSite < len(sequence) && sequence[fm.coopSite] == fm.coopState
+}
+
+// Log tells whether the base fitness model returns log fitness.
+func (fm *frequencyDependentFM) Log() bool {
+	return logFitnessModel(fm.base)
+}
+
+// immuneEscapeFM is a fitness model where the host mounts an immune
+// response against the pathogens that started the current infection.
+// After a delay, the fitness computed by a base fitness model is reduced
+// by the protection conferred by the epitopes remembered at the start of
+// the infection, such that variants with different epitopes escape the
+// response. Protection uses the cross-immunity parameters of the host's
+// intrahost model. Protection from earlier infections is already applied
+// during replication and is not included.
+type immuneEscapeFM struct {
+	modelMetadata
+	base  FitnessModel
+	delay int
+}
+
+// NewImmuneEscapeFM creates an immune escape fitness model on top of the
+// base fitness model. The immune response starts delay generations
+// after infection.
+func NewImmuneEscapeFM(id int, name string, base FitnessModel, delay int) (FitnessModel, error) {
+	if base == nil {
+		return nil, fmt.Errorf("immune escape fitness model requires a base fitness model")
+	}
+	if delay < 0 {
+		return nil, fmt.Errorf(InvalidIntParameterError, "immune delay", delay, "cannot be negative")
+	}
+	fm := new(immuneEscapeFM)
+	fm.id = id
+	fm.name = name
+	fm.base = base
+	fm.delay = delay
+	return fm, nil
+}
+
+// ComputeFitness returns the fitness of the sequence under the base
+// fitness model.
+func (fm *immuneEscapeFM) ComputeFitness(chars ...uint8) (fitness float64, err error) {
+	return fm.base.ComputeFitness(chars...)
+}
+
+func (fm *immuneEscapeFM) ContextDependent() bool {
+	return true
+}
+
+// ContextFitness returns the fitness of the genotype after applying the
+// protection of the host's response to the current infection.
+func (fm *immuneEscapeFM) ContextFitness(ctx *FitnessContext, g Genotype) (fitness float64, err error) {
+	fitness = FitnessInContext(fm.base, ctx, g)
+	if ctx.Host == nil || ctx.Time-ctx.InfectionTime < fm.delay {
+		return fitness, nil
+	}
+	model := ctx.Host.GetIntrahostModel()
+	if model == nil {
+		return fitness, nil
+	}
+	strength, distance := model.CrossImmunity()
+	if strength <= 0 {
+		return fitness, nil
+	}
+	var epitopes [][]uint8
+	for _, m := range ctx.Host.ImmuneHistory() {
+		if m.Generation >= ctx.InfectionTime {
+			epitopes = append(epitopes, m.Epitope)
+		}
+	}
+	if len(epitopes) == 0 {
+		return fitness, nil
+	}
+	s := &memoryImmuneSystem{epitopes, strength, distance, model.EpitopePositions()}
+	protection := s.Protection(g.Sequence())
+	if fm.Log() {
+		return fitness + math.Log(1-protection), nil
+	}
+	return fitness * (1 - protection), nil
+}
+
+// Log tells whether the base fitness model returns log fitness.
+func (fm *immuneEscapeFM) Log() bool {
+	return logFitnessModel(fm.base)
+}
+
+// timeVaryingFM is a fitness model where the fitness landscape changes
+// during the simulation. Each fitness model in the schedule takes effect
+// at a particular generation. Fitness either switches to the next model
+// at that generation, or changes gradually from one model to the next.
+// Fitness of each model is cached by the genotype under the ID of that
+// model, so changes in the landscape never invalidate cached values.
+type timeVaryingFM struct {
+	modelMetadata
+	models      []FitnessModel
+	times       []int
+	period      int
+	interpolate bool
+}
+
+// NewTimeVaryingFM creates a fitness model that uses models[i] from
+// generation times[i]. Times must be increasing. If period is positive,
+// the schedule repeats every period generations. If interpolate is true,
+// fitness changes linearly between the fitness of successive models
+// instead of switching at once. Interpolation is done in log space if
+// the models return log fitness. The models must have distinct IDs.
+func NewTimeVaryingFM(id int, name string, models []FitnessModel, times []int, period int, interpolate bool) (FitnessModel, error) {
+	if len(models) < 1 {
+		return nil, errors.Wrap(ZeroItemsError(), "creating time-varying fitness model failed")
+	}
+	if len(times) != len(models) {
+		return nil, fmt.Errorf(UnequalIntParameterError, "number of landscape times", len(models), len(times))
+	}
+	for i, t := range times {
+		if t < 0 {
+			return nil, fmt.Errorf(InvalidIntParameterError, "landscape time", t, "cannot be negative")
+		}
+		if i > 0 && t <= times[i-1] {
+			return nil, fmt.Errorf(InvalidIntParameterError, "landscape time", t, "must be greater than the previous time")
+		}
+	}
+	if period < 0 {
+		return nil, fmt.Errorf(InvalidIntParameterError, "landscape period", period, "cannot be negative")
+	} else if period > 0 && period <= times[len(times)-1] {
+		return nil, fmt.Errorf(InvalidIntParameterError, "landscape period", period, "must be greater than the last landscape time")
+	}
+	fm := new(timeVaryingFM)
+	fm.id = id
+	fm.name = name
+	fm.models = append([]FitnessModel{}, models...)
+	fm.times = append([]int{}, times...)
+	fm.period = period
+	fm.interpolate = interpolate
+	return fm, nil
+}
+
+// ComputeFitness returns the fitness of the sequence at generation 0.
+func (fm *timeVaryingFM) ComputeFitness(chars ...uint8) (fitness float64, err error) {
+	a, b, w := fm.weights(0)
+	fitness, err = fm.models[a].ComputeFitness(chars...)
+	if err != nil || w == 0 {
+		return fitness, err
+	}
+	next, err := fm.models[b].ComputeFitness(chars...)
+	if err != nil {
+		return 0, err
+	}
+	return (1-w)*fitness + w*next, nil
+}
+
+// ContextDependent is true if the landscape changes at all.
+func (fm *timeVaryingFM) ContextDependent() bool {
+	return len(fm.models) > 1
+}
+
+// ContextFitness returns the fitness of the genotype at the generation
+// of the context.
+func (fm *timeVaryingFM) ContextFitness(ctx *FitnessContext, g Genotype) (fitness float64, err error) {
+	a, b, w := fm.weights(ctx.Time)
+	fitness = FitnessInContext(fm.models[a], ctx, g)
+	if w == 0 {
+		return fitness, nil
+	}
+	return (1-w)*fitness + w*FitnessInContext(fm.models[b], ctx, g), nil
+}
+
+// weights returns the indexes of the models in effect at generation t,
+// and the weight of the second model.
+func (fm *timeVaryingFM) weights(t int) (a, b int, w float64) {
+	last := len(fm.times) - 1
+	if fm.period > 0 {
+		t = t % fm.period
+	}
+	// Before the first time, the last model of the previous cycle is in
+	// effect if the schedule repeats, otherwise the first model is
+	a = sort.SearchInts(fm.times, t+1) - 1
+	if a < 0 {
+		if fm.period == 0 {
+			return 0, 0, 0
+		}
+		a = last
+	}
+	if !fm.interpolate {
+		return a, a, 0
+	}
+	b = a + 1
+	start, end := fm.times[a], 0
+	switch {
+	case b <= last:
+		end = fm.times[b]
+	case fm.period > 0:
+		b = 0
+		end = fm.times[0] + fm.period
+	default:
+		// Last model stays in effect
+		return a, a, 0
+	}
+	if t < start {
+		// Wrapped around to the next cycle
+		t += fm.period
+	}
+	return a, b, float64(t-start) / float64(end-start)
+}
+
+// Log tells whether the models return log fitness.
+func (fm *timeVaryingFM) Log() bool {
+	return logFitnessModel(fm.models[0])
+}
@@ -0,0 +1,91 @@
+package contagiongo
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFrequencyDependentFM(t *testing.T) {
+	base, _ := NewMultiplicativeFM(0, "base", map[int]map[uint8]float64{
+		0: {0: 0, 1: 0},
+		1: {0: 0, 1: -0.1},
+	})
+	fm, err := NewFrequencyDependentFM(0, "freq", base, 1, 1, 1, 0.5, 0.2)
+	if err != nil {
+		t.Fatalf("error creating model: %v", err)
+	}
+	r := NewRand(1)
+	tree := EmptyGenotypeTree()
+	common := tree.NewNode(newNodeUID(r), []uint8{0, 0}, 0)
+	rare := tree.NewNode(newNodeUID(r), []uint8{1, 1}, 0)
+	pathogens := []GenotypeNode{common, common, common, rare}
+	ctx := NewFitnessContext(0, 0, nil, pathogens)
+
+	var tests = []struct {
+		pathogen GenotypeNode
+		output   float64
+	}{
+		// -1 * 0.75 + 0.5 * 0.25
+		{common, -0.625},
+		// -0.1 - 1 * 0.25 + 0.5 * 0.25 - 0.2
+		{rare, -0.425},
+	}
+	for _, tt := range tests {
+		fitness := FitnessInContext(fm, ctx, tt.pathogen)
+		if fmt.Sprintf("%.6f", fitness) != fmt.Sprintf("%.6f", tt.output) {
+			t.Errorf("expected %f, got %f instead", tt.output, fitness)
+		}
+	}
+	// Fitness changes with the frequency of the genotype
+	ctx = NewFitnessContext(1, 0, nil, []GenotypeNode{common, rare})
+	if fitness := FitnessInContext(fm, ctx, common); fmt.Sprintf("%.6f", fitness) != "-0.250000" {
+		t.Errorf("expected %f, got %f instead", -0.25, fitness)
+	}
+	// Only the context-free fitness of the base model is cached
+	if fitness := common.Fitness(fm); fitness != 0 {
+		t.Errorf(UnequalFloatParameterError, "cached fitness", 0., fitness)
+	}
+}
+
+func TestTimeVaryingFM(t *testing.T) {
+	var models []FitnessModel
+	for i, v := range []float64{0, -1, -2} {
+		fm, _ := NewMultiplicativeFM(-(i + 1), "m", map[int]map[uint8]float64{0: {0: v}})
+		models = append(models, fm)
+	}
+	var tests = []struct {
+		period      int
+		interpolate bool
+		t           int
+		output      float64
+	}{
+		{0, false, 0, 0},
+		{0, false, 25, -1},
+		{0, false, 100, -2},
+		{0, true, 15, -0.5},
+		{0, true, 100, -2},
+		// Repeats every 40 generations
+		{40, false, 65, -1},
+		// Last model stays in effect until the first time of the next cycle
+		{40, false, 45, -2},
+		{40, true, 25, -1.5},
+		// Interpolates from the last model back to the first
+		{40, true, 35, -1.5},
+		{40, true, 45, -0.5},
+	}
+	r := NewRand(1)
+	g := EmptyGenotypeTree().NewNode(newNodeUID(r), []uint8{0}, 0)
+	for _, tt := range tests {
+		fm, err := NewTimeVaryingFM(0, "tv", models, []int{10, 20, 30}, tt.period, tt.interpolate)
+		if err != nil {
+			t.Fatalf("error creating model: %v", err)
+		}
+		ctx := NewFitnessContext(tt.t, 0, nil, []GenotypeNode{g})
+		if fitness := FitnessInContext(fm, ctx, g); fmt.Sprintf("%.6f", fitness) != fmt.Sprintf("%.6f", tt.output) {
+			t.Errorf("expected %f at generation %d with period %d, got %f instead", tt.output, tt.t, tt.period, fitness)
+		}
+	}
+	if _, err := NewTimeVaryingFM(0, "tv", models, []int{10, 20, 30}, 30, false); err == nil {
+		t.Errorf("expected an error for a period that is not greater than the last time")
+	}
+}
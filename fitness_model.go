@@ -2,6 +2,9 @@ package contagiongo
 
 import (
 	"bytes"
+	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"sync"
 
@@ -197,6 +200,86 @@ func NeutralAdditiveFM(id int, name string, sites, alleles, growthRate int) (Fit
 	return fm, nil
 }
 
+// drugSensitivityFM is a fitness model that reduces the fitness computed
+// by another fitness model when pathogens are exposed to a drug.
+// For every drug site where the sequence carries the drug-sensitive state,
+// fitness is multiplied by the sensitivity of the site.
+type drugSensitivityFM struct {
+	modelMetadata
+	base        FitnessModel
+	sites       []int
+	states      []uint8
+	sensitivity []float64
+}
+
+// NewDrugSensitivityFM creates a fitness model that applies the drug
+// sensitivity of each site on top of the base fitness model. Sensitivity
+// values are in decimal form and must be between 0 and 1.
+func NewDrugSensitivityFM(id int, name string, base FitnessModel, sites []int, states []uint8, sensitivity []float64) (FitnessModel, error) {
+	if len(sites) < 1 {
+		return nil, errors.Wrap(ZeroItemsError(), "creating drug sensitivity model failed")
+	}
+	if len(states) != len(sites) || len(sensitivity) != len(sites) {
+		return nil, fmt.Errorf("expected %d drug-sensitive states and sensitivity values, instead got %d and %d", len(sites), len(states), len(sensitivity))
+	}
+	for _, v := range sensitivity {
+		if v < 0 || v > 1 {
+			return nil, fmt.Errorf(InvalidFloatParameterError, "drug sensitivity", v, "must be between 0 and 1")
+		}
+	}
+	fm := new(drugSensitivityFM)
+	fm.id = id
+	fm.name = name
+	fm.base = base
+	fm.sites = append([]int{}, sites...)
+	fm.states = append([]uint8{}, states...)
+	fm.sensitivity = append([]float64{}, sensitivity...)
+	return fm, nil
+}
+
+// ComputeFitness returns the fitness of the sequence under the base
+// fitness model after applying the drug sensitivity of each site.
+func (fm *drugSensitivityFM) ComputeFitness(chars ...uint8) (fitness float64, err error) {
+	fitness, err = fm.base.ComputeFitness(chars...)
+	if err != nil {
+		return 0, err
+	}
+	return fm.applySensitivity(fitness, chars), nil
+}
+
+// applySensitivity applies the drug sensitivity of each site of the
+// sequence to the fitness. Sensitivity is applied in log form if the base
+// model returns log fitness.
+func (fm *drugSensitivityFM) applySensitivity(fitness float64, chars []uint8) float64 {
+	logFitness := logFitnessModel(fm.base)
+	for i, pos := range fm.sites {
+		if pos >= len(chars) || chars[pos] != fm.states[i] {
+			continue
+		}
+		if logFitness {
+			fitness += math.Log(fm.sensitivity[i])
+		} else {
+			fitness *= fm.sensitivity[i]
+		}
+	}
+	return fitness
+}
+
+// ContextDependent tells whether the base fitness model depends on
+// the context.
+func (fm *drugSensitivityFM) ContextDependent() bool {
+	cf, ok := fm.base.(ContextFitnessModel)
+	return ok && cf.ContextDependent()
+}
+
+// ContextFitness returns the fitness of the genotype under the base
+// fitness model given the context after applying the drug sensitivity
+// of each site.
+func (fm *drugSensitivityFM) ContextFitness(ctx *FitnessContext, g Genotype) (fitness float64, err error) {
+	fitness = FitnessInContext(fm.base, ctx, g)
+	return fm.applySensitivity(fitness, g.Sequence()), nil
+}
+
 // MotifModel is a type of FitnessModel where the fitness of a sequence
 // depends on the presence of the particular motifs.
 type MotifModel interface {
@@ -209,8 +292,18 @@ type MotifModel interface {
 	// ComputeFitness returns the corresponding fitness value given
 	// a set of sequences as integers.
 	ComputeFitness(chars ...uint8) (fitness float64, err error)
+	// SiteFitness returns the fitness value associated for a particular
+	// character at the given site.
+	SiteCharFitness(position int, state uint8) (fitness float64, err error)
+	// Log tells whether the fitness values are decimal or log.
+	Log() bool
 
+	// AddMotif adds a new motif that contributes the given value to the
+	// fitness of sequences that carry it.
 	AddMotif(sequence []uint8, pos []int, value float64) error
+	// SetDefaultFitness sets the baseline fitness of every sequence,
+	// which is the fitness of sequences without any motif.
+	SetDefaultFitness(value float64)
 }
 
 // motif is a struct that describes an int-coded sequence motif.
@@ -231,12 +324,16 @@ func newMotif(sequence []uint8, pos []int, value float64) *motif {
 }
 
 // InSequence tells if the motif is present or absent in the given sequence.
+// Motifs with positions beyond the end of the sequence are absent.
 func (m *motif) InSequence(seq []uint8) bool {
 	if len(seq) == 0 || len(m.motif) == 0 {
 		return false
 	}
 	for i, motifChar := range m.motif {
 		pos := m.pos[i]
+		if pos >= len(seq) {
+			return false
+		}
 		seqChar := seq[pos]
 		if motifChar != seqChar {
 			return false
@@ -250,24 +347,42 @@ func (m *motif) UpdateFitness(v float64) {
 	m.fitness = v
 }
 
-// MotifID returns the sequence and its corresponding positions interleaved
-// as a string.
+// MotifID returns the positions and their corresponding states as a
+// string of pos:state pairs sorted by position. Motifs with the same
+// sites and states have the same ID regardless of the order of sites.
 func (m *motif) MotifID() string {
+	order := make([]int, len(m.motif))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return m.pos[order[i]] < m.pos[order[j]]
+	})
 	var b bytes.Buffer
-	for i := 0; i < len(m.motif); i++ {
-		s := int(m.motif[i])
-		pos := m.pos[i]
-		b.WriteString(strconv.Itoa(s))
-		b.WriteString(strconv.Itoa(pos))
+	for k, i := range order {
+		if k > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString(strconv.Itoa(m.pos[i]))
+		b.WriteString(":")
+		b.WriteString(strconv.Itoa(int(m.motif[i])))
 	}
 	return b.String()
 }
 
+// motifModel is an additive fitness model where the fitness of a
+// sequence is the default fitness plus the values of every motif present
+// in the sequence. Values are assumed to be in base 10 form.
+// Motifs may share sites. A motif that combines the sites of other motifs
+// acts as an epistatic term that is only added when all of its sites
+// carry the motif states.
 type motifModel struct {
 	sync.RWMutex
 	modelMetadata
-	motifs         map[string]*motif
-	positions      map[int]bool
+	// motifs are kept in the order they were added so that fitness
+	// values are always summed in the same order
+	motifs         []*motif
+	motifIDs       map[string]bool
 	defaultFitness float64
 }
 
@@ -276,48 +391,246 @@ func EmptyMotifModel(id int, name string) MotifModel {
 	m := new(motifModel)
 	m.id = id
 	m.name = name
-	m.motifs = make(map[string]*motif)
-	m.positions = make(map[int]bool)
+	m.motifIDs = make(map[string]bool)
 	return m
 }
 
-// ComputeFitness returns the corresponding fitness value given
-// a set of sequences as integers.
+// ComputeFitness returns the default fitness plus the sum of the values
+// of motifs present in the sequence. Negative fitness values become 0.
 func (m *motifModel) ComputeFitness(chars ...uint8) (fitness float64, err error) {
+	if len(chars) < 1 {
+		return 0, errors.Wrap(ZeroItemsError(), "computing motif fitness failed")
+	}
 	m.RLock()
 	defer m.RUnlock()
-	var decFitness float64
+	decFitness := m.defaultFitness
 	for _, motif := range m.motifs {
 		if motif.InSequence(chars) {
 			decFitness += motif.fitness
 		}
 	}
+	if decFitness < 0 {
+		decFitness = 0.0
+	}
 	return decFitness, nil
 }
 
+// SiteCharFitness returns the sum of the values of single-site motifs
+// with the given state at the given position.
+func (m *motifModel) SiteCharFitness(position int, state uint8) (fitness float64, err error) {
+	m.RLock()
+	defer m.RUnlock()
+	for _, motif := range m.motifs {
+		if len(motif.pos) == 1 && motif.pos[0] == position && motif.motif[0] == state {
+			fitness += motif.fitness
+		}
+	}
+	return fitness, nil
+}
+
+func (m *motifModel) Log() bool {
+	return false
+}
+
+// SetDefaultFitness sets the baseline fitness of every sequence,
+// which is the fitness of sequences without any motif.
+func (m *motifModel) SetDefaultFitness(value float64) {
+	m.Lock()
+	defer m.Unlock()
+	m.defaultFitness = value
+}
+
 // AddMotif adds a new motif to the motif model. Returns an error if
-// the given positions overlap with existing motifs in the model.
+// a motif with the same positions and states already exists.
 func (m *motifModel) AddMotif(sequence []uint8, pos []int, value float64) error {
-	// Check positions
-	m.RLock()
+	if len(sequence) < 1 {
+		return errors.Wrap(ZeroItemsError(), "adding motif failed")
+	}
+	if len(sequence) != len(pos) {
+		return fmt.Errorf(UnequalIntParameterError, "number of motif positions", len(sequence), len(pos))
+	}
+	seen := make(map[int]bool)
 	for _, i := range pos {
-		if _, exists := m.positions[i]; exists {
-			m.RUnlock()
-			return OverlappingMotifError(i)
+		if i < 0 {
+			return fmt.Errorf(InvalidIntParameterError, "motif position", i, "cannot be negative")
+		}
+		if seen[i] {
+			return fmt.Errorf("position %d appears more than once in the motif", i)
 		}
+		seen[i] = true
 	}
-	m.RUnlock()
 
 	m.Lock()
 	defer m.Unlock()
-	newMotif := newMotif(sequence, pos, value)
+	newMotif := newMotif(append([]uint8{}, sequence...), append([]int{}, pos...), value)
 	newMotifID := newMotif.MotifID()
-	if _, exists := m.motifs[newMotifID]; exists {
+	if m.motifIDs[newMotifID] {
 		return MotifExistsError(newMotifID)
 	}
-	m.motifs[newMotifID] = newMotif
-	for _, i := range pos {
-		m.positions[i] = true
-	}
+	m.motifs = append(m.motifs, newMotif)
+	m.motifIDs[newMotifID] = true
 	return nil
 }
+
+// IncrementalFitnessModel is a type of FitnessModel that can compute the
+// fitness of a sequence from the fitness of a reference sequence. This is
+// faster than computing fitness from scratch when the two sequences only
+// differ at a few sites, such as a mutant and its parent.
+type IncrementalFitnessModel interface {
+	FitnessModel
+	// UpdateFitness returns the fitness of the sequence given as chars
+	// from the fitness of the reference sequence. The result is the same
+	// as the value returned by ComputeFitness.
+	UpdateFitness(ref []uint8, refFitness float64, chars ...uint8) (fitness float64, err error)
+}
+
+// epistasisScale is the number of units per log fitness used to store
+// the parameters of an epistasis model. Parameters are stored as integers
+// so that sums do not depend on the order of terms, and fitness updated
+// from a reference sequence is identical to fitness computed from scratch.
+const epistasisScale = 1e9
+
+// epistasisCoupling holds the interaction terms between a site and one
+// of its coupled sites. The key is the pair of states at the site and at
+// the coupled site.
+type epistasisCoupling struct {
+	site   int
+	values map[[2]uint8]int64
+}
+
+// epistasisFM is a fitness matrix that adds pairwise interactions between
+// sites to the independent contribution of each site, similar to a Potts
+// model. The log fitness of a sequence a is
+//
+//	sum_i h_i(a_i) + sum_{i<j} J_ij(a_i, a_j)
+//
+// Values are in log form. Terms that are not specified are 0.
+type epistasisFM struct {
+	modelMetadata
+	fields map[int]map[uint8]int64
+	// couplings lists the coupled sites of each site. Every pair of sites
+	// is listed twice, once for each site.
+	couplings map[int][]epistasisCoupling
+	lastPos   int
+}
+
+// NewEpistasisFM creates a new epistasis fitness matrix from the site
+// fields h and the pairwise couplings J. The key of each coupling is a
+// pair of sites i < j, and the key of each value is the pair of states
+// at sites i and j respectively. Assumes that the values are in log form.
+func NewEpistasisFM(id int, name string, fields map[int]map[uint8]float64, couplings map[[2]int]map[[2]uint8]float64) (FitnessMatrix, error) {
+	if len(fields) < 1 && len(couplings) < 1 {
+		return nil, EmptyMatrixError()
+	}
+	fm := new(epistasisFM)
+	fm.id = id
+	fm.name = name
+	fm.fields = make(map[int]map[uint8]int64)
+	fm.couplings = make(map[int][]epistasisCoupling)
+	fm.lastPos = -1
+	for pos, row := range fields {
+		if pos < 0 {
+			return nil, fmt.Errorf(InvalidIntParameterError, "site", pos, "cannot be negative")
+		}
+		fm.fields[pos] = make(map[uint8]int64)
+		for state, v := range row {
+			fm.fields[pos][state] = int64(math.Round(v * epistasisScale))
+		}
+		if pos > fm.lastPos {
+			fm.lastPos = pos
+		}
+	}
+	// Sort pairs so that coupled sites are always listed in the same order
+	pairs := make([][2]int, 0, len(couplings))
+	for pair := range couplings {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(a, b int) bool {
+		if pairs[a][0] != pairs[b][0] {
+			return pairs[a][0] < pairs[b][0]
+		}
+		return pairs[a][1] < pairs[b][1]
+	})
+	for _, pair := range pairs {
+		i, j := pair[0], pair[1]
+		if i < 0 || i >= j {
+			return nil, fmt.Errorf("coupled sites must be distinct non-negative sites in increasing order, got %d and %d", i, j)
+		}
+		forward := make(map[[2]uint8]int64)
+		reverse := make(map[[2]uint8]int64)
+		for states, v := range couplings[pair] {
+			value := int64(math.Round(v * epistasisScale))
+			forward[states] = value
+			reverse[[2]uint8{states[1], states[0]}] = value
+		}
+		fm.couplings[i] = append(fm.couplings[i], epistasisCoupling{j, forward})
+		fm.couplings[j] = append(fm.couplings[j], epistasisCoupling{i, reverse})
+		if j > fm.lastPos {
+			fm.lastPos = j
+		}
+	}
+	return fm, nil
+}
+
+// ComputeFitness returns the sum of the site fields and the couplings of
+// every pair of sites given a sequence of characters.
+func (fm *epistasisFM) ComputeFitness(chars ...uint8) (fitness float64, err error) {
+	if len(chars) < 1 {
+		return 0, errors.Wrap(ZeroItemsError(), "computing epistasis fitness failed")
+	}
+	if fm.lastPos >= len(chars) {
+		return 0, fmt.Errorf("site %d is beyond the end of the sequence (%d sites)", fm.lastPos, len(chars))
+	}
+	var total int64
+	for pos, row := range fm.fields {
+		total += row[chars[pos]]
+	}
+	for i, couplings := range fm.couplings {
+		for _, c := range couplings {
+			// Each pair is counted once
+			if i < c.site {
+				total += c.values[[2]uint8{chars[i], chars[c.site]}]
+			}
+		}
+	}
+	return float64(total) / epistasisScale, nil
+}
+
+// UpdateFitness returns the fitness of the sequence from the fitness of
+// the reference sequence by only recomputing the terms of sites that
+// differ between the two sequences.
+func (fm *epistasisFM) UpdateFitness(ref []uint8, refFitness float64, chars ...uint8) (fitness float64, err error) {
+	if len(ref) != len(chars) {
+		return 0, fmt.Errorf(UnequalIntParameterError, "sequence length", len(ref), len(chars))
+	}
+	if fm.lastPos >= len(chars) {
+		return 0, fmt.Errorf("site %d is beyond the end of the sequence (%d sites)", fm.lastPos, len(chars))
+	}
+	total := int64(math.Round(refFitness * epistasisScale))
+	// Apply substitutions one at a time so that pairs where both sites
+	// changed are updated correctly
+	current := append([]uint8{}, ref...)
+	for pos, state := range chars {
+		if current[pos] == state {
+			continue
+		}
+		old := current[pos]
+		total += fm.fields[pos][state] - fm.fields[pos][old]
+		for _, c := range fm.couplings[pos] {
+			other := current[c.site]
+			total += c.values[[2]uint8{state, other}] - c.values[[2]uint8{old, other}]
+		}
+		current[pos] = state
+	}
+	return float64(total) / epistasisScale, nil
+}
+
+// SiteCharFitness returns the field of the character at the given site.
+// Couplings with other sites are not included.
+func (fm *epistasisFM) SiteCharFitness(position int, state uint8) (fitness float64, err error) {
+	return float64(fm.fields[position][state]) / epistasisScale, nil
+}
+
+func (fm *epistasisFM) Log() bool {
+	return true
+}
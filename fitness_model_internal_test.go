@@ -2,6 +2,7 @@ package contagiongo
 
 import (
 	"fmt"
+	"math"
 	"testing"
 )
 
@@ -310,3 +311,135 @@ func TestAdditiveFM(t *testing.T) {
 		})
 	}
 }
+
+func TestDrugSensitivityFM(t *testing.T) {
+	logBase, _ := NeutralMultiplicativeFM(0, "neutral multiplicative", 4, 2)
+	decBase, _ := NeutralAdditiveFM(1, "neutral additive", 4, 2, 1)
+	var tests = []struct {
+		base     FitnessModel
+		sequence []uint8
+		output   float64
+	}{
+		{logBase, []uint8{0, 0, 0, 0}, 2 * math.Log(0.5)},
+		{logBase, []uint8{1, 0, 0, 0}, math.Log(0.5)},
+		{logBase, []uint8{1, 0, 1, 0}, 0},
+		{decBase, []uint8{0, 0, 0, 0}, 0.25},
+		{decBase, []uint8{0, 0, 1, 0}, 0.5},
+	}
+	for _, tt := range tests {
+		fm, err := NewDrugSensitivityFM(2, "drug", tt.base, []int{0, 2}, []uint8{0, 0}, []float64{0.5, 0.5})
+		if err != nil {
+			t.Fatalf("error creating drug sensitivity model: %v", err)
+		}
+		fitness, err := fm.ComputeFitness(tt.sequence...)
+		if err != nil {
+			t.Errorf("error computing fitness: %v", err)
+		}
+		if fmt.Sprintf("%.6f", fitness) != fmt.Sprintf("%.6f", tt.output) {
+			t.Errorf("expected %f, got %f instead", tt.output, fitness)
+		}
+	}
+	if _, err := NewDrugSensitivityFM(2, "drug", logBase, []int{0, 2}, []uint8{0}, []float64{0.5, 0.5}); err == nil {
+		t.Errorf("expected error for unequal number of drug-sensitive states")
+	}
+}
+
+func TestMotifModel(t *testing.T) {
+	fm := EmptyMotifModel(0, "motif")
+	fm.SetDefaultFitness(1)
+	motifs := []struct {
+		sequence []uint8
+		pos      []int
+		value    float64
+	}{
+		{[]uint8{1}, []int{0}, 0.5},
+		{[]uint8{0, 1}, []int{3, 7}, 0.2},
+		// Epistatic term that overlaps with both motifs above
+		{[]uint8{1, 0, 1}, []int{0, 3, 7}, -0.4},
+	}
+	for _, m := range motifs {
+		if err := fm.AddMotif(m.sequence, m.pos, m.value); err != nil {
+			t.Fatalf("error adding motif: %v", err)
+		}
+	}
+	var tests = []struct {
+		sequence []uint8
+		output   float64
+	}{
+		{[]uint8{0, 0, 0, 0, 0, 0, 0, 0}, 1},
+		{[]uint8{1, 0, 0, 0, 0, 0, 0, 0}, 1.5},
+		{[]uint8{0, 0, 0, 0, 0, 0, 0, 1}, 1.2},
+		{[]uint8{1, 0, 0, 0, 0, 0, 0, 1}, 1.3},
+		// Motifs beyond the end of the sequence are absent
+		{[]uint8{1, 0, 0, 0}, 1.5},
+	}
+	for _, tt := range tests {
+		fitness, err := fm.ComputeFitness(tt.sequence...)
+		if err != nil {
+			t.Errorf("error computing fitness: %v", err)
+		}
+		if fmt.Sprintf("%.6f", fitness) != fmt.Sprintf("%.6f", tt.output) {
+			t.Errorf("expected %f, got %f instead", tt.output, fitness)
+		}
+	}
+	if fitness, _ := fm.SiteCharFitness(0, 1); fitness != 0.5 {
+		t.Errorf(UnequalFloatParameterError, "site fitness", 0.5, fitness)
+	}
+	if err := fm.AddMotif([]uint8{1, 0}, []int{7, 3}, 0.1); err == nil {
+		t.Errorf("expected error for a motif that already exists")
+	}
+	if _, err := fm.ComputeFitness(); err == nil {
+		t.Errorf("expected error: zero-length sequence")
+	}
+}
+
+func TestEpistasisFM(t *testing.T) {
+	fields := map[int]map[uint8]float64{
+		0: {1: 0.5},
+		3: {1: -0.2},
+	}
+	couplings := map[[2]int]map[[2]uint8]float64{
+		{0, 3}: {{1, 1}: 0.3, {0, 1}: -0.1},
+		{3, 5}: {{1, 2}: 1.1},
+	}
+	fm, err := NewEpistasisFM(0, "epistasis", fields, couplings)
+	if err != nil {
+		t.Fatalf("error creating model: %v", err)
+	}
+	var tests = []struct {
+		sequence []uint8
+		output   float64
+	}{
+		{[]uint8{0, 0, 0, 0, 0, 0}, 0},
+		{[]uint8{1, 0, 0, 0, 0, 0}, 0.5},
+		{[]uint8{0, 0, 0, 1, 0, 0}, -0.3},
+		// Couplings only apply when both sites are in the given states
+		{[]uint8{1, 0, 0, 1, 0, 0}, 0.6},
+		{[]uint8{1, 0, 0, 1, 0, 2}, 1.7},
+	}
+	ref := tests[0].sequence
+	refFitness, _ := fm.ComputeFitness(ref...)
+	for _, tt := range tests {
+		fitness, err := fm.ComputeFitness(tt.sequence...)
+		if err != nil {
+			t.Errorf("error computing fitness: %v", err)
+		}
+		if fmt.Sprintf("%.6f", fitness) != fmt.Sprintf("%.6f", tt.output) {
+			t.Errorf("expected %f, got %f instead", tt.output, fitness)
+		}
+		// Updating from the reference gives exactly the same value
+		updated, err := fm.(IncrementalFitnessModel).UpdateFitness(ref, refFitness, tt.sequence...)
+		if err != nil {
+			t.Errorf("error updating fitness: %v", err)
+		}
+		if updated != fitness {
+			t.Errorf(UnequalFloatParameterError, "updated fitness", fitness, updated)
+		}
+	}
+	if _, err := fm.ComputeFitness(0, 0, 0); err == nil {
+		t.Errorf("expected an error for a sequence shorter than the coupled sites")
+	}
+	if _, err := NewEpistasisFM(0, "epistasis", nil, map[[2]int]map[[2]uint8]float64{{2, 2}: {{0, 0}: 1}}); err == nil {
+		t.Errorf("expected an error for a site coupled with itself")
+	}
+}
@@ -39,10 +39,12 @@ type genotype struct {
 }
 
 // NewGenotype creates a new genotype from sequence.
+// The ID of the genotype is derived from the sequence such that identical
+// sequences always get the same ID.
 func NewGenotype(s []uint8) Genotype {
 	g := new(genotype)
 	// Generate UID
-	g.uid = ksuid.New()
+	g.uid = newGenotypeUID(s)
 	// Copy sequence
 	g.sequence = make([]uint8, len(s))
 	copy(g.sequence, s)
@@ -77,6 +79,12 @@ func (n *genotype) StringSequence() string {
 }
 
 func (n *genotype) Fitness(f FitnessModel) float64 {
+	// Fitness that depends on the host or on the other pathogens in the
+	// host changes even if the sequence does not, so it is never cached
+	if cf, ok := f.(ContextFitnessModel); ok && cf.ContextDependent() {
+		fitness, _ := f.ComputeFitness(n.sequence...)
+		return fitness
+	}
 	id := f.ModelID()
 	n.RLock()
 	fitness, ok := n.fitness[id]
@@ -93,6 +101,23 @@ func (n *genotype) Fitness(f FitnessModel) float64 {
 	// return fitness
 }
 
+// cachedFitness returns the fitness computed using the fitness model
+// with the given ID and whether it has been computed before.
+func (n *genotype) cachedFitness(id int) (float64, bool) {
+	n.RLock()
+	defer n.RUnlock()
+	fitness, ok := n.fitness[id]
+	return fitness, ok
+}
+
+// setFitness stores the fitness computed using the fitness model
+// with the given ID.
+func (n *genotype) setFitness(id int, fitness float64) {
+	n.Lock()
+	defer n.Unlock()
+	n.fitness[id] = fitness
+}
+
 func (n *genotype) NumSites() int {
 	return len(n.sequence)
 }
@@ -281,6 +306,39 @@ func (n *genotypeNode) CurrentGenotype() Genotype {
 	return n.Genotype
 }
 
+// Fitness returns the fitness of the node's genotype. If the fitness model
+// is incremental and the fitness of the parent is already known, fitness
+// is updated from the parent's fitness instead of being computed from
+// the whole sequence.
+func (n *genotypeNode) Fitness(f FitnessModel) float64 {
+	inc, ok := f.(IncrementalFitnessModel)
+	if !ok || len(n.parents) != 1 {
+		return n.Genotype.Fitness(f)
+	}
+	g, ok := n.Genotype.(*genotype)
+	if !ok {
+		return n.Genotype.Fitness(f)
+	}
+	id := f.ModelID()
+	if fitness, ok := g.cachedFitness(id); ok {
+		return fitness
+	}
+	parent, ok := n.parents[0].CurrentGenotype().(*genotype)
+	if !ok {
+		return n.Genotype.Fitness(f)
+	}
+	refFitness, ok := parent.cachedFitness(id)
+	if !ok {
+		return n.Genotype.Fitness(f)
+	}
+	fitness, err := inc.UpdateFitness(parent.sequence, refFitness, g.sequence...)
+	if err != nil {
+		return n.Genotype.Fitness(f)
+	}
+	g.setFitness(id, fitness)
+	return fitness
+}
+
 func (n *genotypeNode) History(h [][]uint8) [][]uint8 {
 	h = append(h, n.Genotype.Sequence())
 	if len(n.parents) == 0 {
@@ -295,10 +353,11 @@ func (n *genotypeNode) History(h [][]uint8) [][]uint8 {
 type GenotypeTree interface {
 	// Set returns the GenotypeSet associated with this tree.
 	Set() GenotypeSet
-	// NewNode creates a new genotype node from a given sequence.
-	// Automatically adds sequence to the genotypeSet if it is not yet present.
-	NewNode(sequence []uint8, subs int, parents ...GenotypeNode) GenotypeNode
-	NewRecombinantNode(sequence []uint8, recombs int, parents ...GenotypeNode) GenotypeNode
+	// NewNode creates a new genotype node from a given sequence using the
+	// given node ID. Automatically adds sequence to the genotypeSet if it is
+	// not yet present.
+	NewNode(uid ksuid.KSUID, sequence []uint8, subs int, parents ...GenotypeNode) GenotypeNode
+	NewRecombinantNode(uid ksuid.KSUID, sequence []uint8, recombs int, parents ...GenotypeNode) GenotypeNode
 	// Nodes returns the map of genotype node ID found in the tree to its
 	// corresponding genotype.
 	NodeMap() map[ksuid.KSUID]GenotypeNode
@@ -324,43 +383,21 @@ func (t *genotypeTree) Set() GenotypeSet {
 	return t.set
 }
 
-func (t *genotypeTree) NewNode(sequence []uint8, subs int, parents ...GenotypeNode) GenotypeNode {
-	genotype := t.set.AddSequence(sequence)
-
-	// Create new node
-	n := new(genotypeNode)
-	n.uid = ksuid.New()
-	n.subs = subs
-	// Assign its parent
-	if len(parents) > 0 {
-		n.parents = make([]GenotypeNode, len(parents))
-		copy(n.parents, parents)
-	} else {
-		n.parents = []GenotypeNode{}
-	}
-	// Initialize children
-	n.children = []GenotypeNode{}
-	// Assign genotype
-	n.Genotype = genotype
-
-	// Add new sequence as child of its parent
-	for _, parent := range parents {
-		parent.AddChild(n)
-	}
+func (t *genotypeTree) NewNode(uid ksuid.KSUID, sequence []uint8, subs int, parents ...GenotypeNode) GenotypeNode {
+	return t.newNode(uid, sequence, subs, 0, parents...)
+}
 
-	// Add to tree map
-	t.Lock()
-	defer t.Unlock()
-	t.nodes[n.uid] = n
-	return n
+func (t *genotypeTree) NewRecombinantNode(uid ksuid.KSUID, sequence []uint8, recombs int, parents ...GenotypeNode) GenotypeNode {
+	return t.newNode(uid, sequence, 0, recombs, parents...)
 }
 
-func (t *genotypeTree) NewRecombinantNode(sequence []uint8, recombs int, parents ...GenotypeNode) GenotypeNode {
+func (t *genotypeTree) newNode(uid ksuid.KSUID, sequence []uint8, subs, recombs int, parents ...GenotypeNode) GenotypeNode {
 	genotype := t.set.AddSequence(sequence)
 
 	// Create new node
 	n := new(genotypeNode)
-	n.uid = ksuid.New()
+	n.uid = uid
+	n.subs = subs
 	n.recombs = recombs
 	// Assign its parent
 	if len(parents) > 0 {
@@ -1,7 +1,12 @@
 package contagiongo
 
 import (
+	"bytes"
+	"math/rand"
+	"sort"
 	"sync"
+
+	"github.com/segmentio/ksuid"
 )
 
 // Host encapsulates pathogens together and ties its evolution to a particular
@@ -13,11 +18,17 @@ type Host interface {
 	// simulation. Generally, the host type ID is used to identify hosts
 	// belonging to the same group that share the same properties.
 	TypeID() int
+	// Attribute returns the value of a host attribute loaded from the
+	// host attribute file and whether the host has the attribute.
+	Attribute(name string) (string, bool)
+	// SetAttribute assigns a value to a host attribute.
+	SetAttribute(name, value string)
 	// PickPathogens returns a random list of pathogens from the
-	// current host.
+	// current host using the given random number generator.
 	// Returns nil if no pathogen exists.
-	PickPathogens(n int) []GenotypeNode
-	// Pathogens returns a list of all pathogens present in the host.
+	PickPathogens(r *rand.Rand, n int) []GenotypeNode
+	// Pathogens returns a list of all pathogens present in the host
+	// sorted by node ID.
 	// This elements of the list are pointers to GenotypeNodes.
 	Pathogens() []GenotypeNode
 	// PathogenPopSize returns the number of pathogens inside the host.
@@ -28,6 +39,18 @@ type Host interface {
 	// RemoveAllPathogens removes all the pathogens from the host.
 	// Internally, this removes all the pointers that refer to GenotypeNodes.
 	RemoveAllPathogens()
+	// ImmuneHistory returns the epitopes the host has been infected with,
+	// from the least to the most recently encountered.
+	ImmuneHistory() []ImmuneMemory
+	// SetImmuneHistory replaces the immune history of the host.
+	SetImmuneHistory(history []ImmuneMemory)
+	// RememberEpitope adds the epitope encountered at generation t to the
+	// immune history of the host. If the epitope is already remembered,
+	// it becomes the most recently encountered but keeps the generation
+	// it was first remembered. If maxSize is positive, the least recently
+	// encountered epitopes are forgotten so that at most maxSize epitopes
+	// are remembered.
+	RememberEpitope(epitope []uint8, t, maxSize int)
 	// SetIntrahostModel associates the current host to a given intrahost model.
 	// The intrahost model governs intrahost processes by specifying the
 	// mutation, replication, recombination, and infection modes and parameters
@@ -35,6 +58,9 @@ type Host interface {
 	SetIntrahostModel(intrahostModel IntrahostModel) error
 	// SetFitnessModel associates the current host to a given fitness model.
 	SetFitnessModel(fitnessModel FitnessModel) error
+	// ReplaceFitnessModel associates the current host to a given fitness
+	// model even if the host is already associated to another fitness model.
+	ReplaceFitnessModel(fitnessModel FitnessModel)
 	// SetTransmissionModel associates the current host to a given
 	// transmission model. This model sets the transmission probability
 	// (if not set in the adjacency matrix) and the transmission size.
@@ -59,8 +85,10 @@ type sequenceHost struct {
 
 	id             int
 	typeID         int
+	attributes     map[string]string
 	pathogens      map[int]GenotypeNode
 	lastPathogenID int
+	immuneHistory  []ImmuneMemory
 }
 
 // EmptySequenceHost creates a new host without an intrahost model and
@@ -72,6 +100,7 @@ func EmptySequenceHost(ids ...int) Host {
 	if len(ids) > 1 {
 		h.typeID = ids[1]
 	}
+	h.attributes = make(map[string]string)
 	h.pathogens = make(map[int]GenotypeNode)
 	h.IntrahostModel = nil
 	h.FitnessModel = nil
@@ -86,20 +115,30 @@ func (h *sequenceHost) TypeID() int {
 	return h.typeID
 }
 
-func (h *sequenceHost) PickPathogens(n int) []GenotypeNode {
+func (h *sequenceHost) Attribute(name string) (string, bool) {
+	h.RLock()
+	defer h.RUnlock()
+	value, exists := h.attributes[name]
+	return value, exists
+}
+
+func (h *sequenceHost) SetAttribute(name, value string) {
+	h.Lock()
+	defer h.Unlock()
+	h.attributes[name] = value
+}
+
+func (h *sequenceHost) PickPathogens(r *rand.Rand, n int) []GenotypeNode {
 	if n < 1 {
 		return []GenotypeNode{}
 	}
-	h.RLock()
-	defer h.RUnlock()
 	pathogens := make([]GenotypeNode, n)
-	i := 0
-	for _, node := range h.pathogens {
-		pathogens[i] = node
-		i++
+	current := h.Pathogens()
+	for i, idx := range r.Perm(len(current)) {
 		if i >= n {
 			break
 		}
+		pathogens[i] = current[idx]
 	}
 	return pathogens
 }
@@ -113,6 +152,11 @@ func (h *sequenceHost) Pathogens() []GenotypeNode {
 		pathogens[i] = p
 		i++
 	}
+	// Sort so that the order does not depend on the order pathogens
+	// were added
+	sort.Slice(pathogens, func(i, j int) bool {
+		return ksuid.Compare(pathogens[i].UID(), pathogens[j].UID()) < 0
+	})
 	return pathogens
 }
 
@@ -139,6 +183,38 @@ func (h *sequenceHost) RemoveAllPathogens() {
 	h.pathogens = make(map[int]GenotypeNode)
 }
 
+func (h *sequenceHost) ImmuneHistory() []ImmuneMemory {
+	h.RLock()
+	defer h.RUnlock()
+	history := make([]ImmuneMemory, len(h.immuneHistory))
+	copy(history, h.immuneHistory)
+	return history
+}
+
+func (h *sequenceHost) SetImmuneHistory(history []ImmuneMemory) {
+	h.Lock()
+	defer h.Unlock()
+	h.immuneHistory = make([]ImmuneMemory, len(history))
+	copy(h.immuneHistory, history)
+}
+
+func (h *sequenceHost) RememberEpitope(epitope []uint8, t, maxSize int) {
+	h.Lock()
+	defer h.Unlock()
+	memory := ImmuneMemory{Epitope: append([]uint8{}, epitope...), Generation: t}
+	for i, m := range h.immuneHistory {
+		if bytes.Equal(m.Epitope, epitope) {
+			memory.Generation = m.Generation
+			h.immuneHistory = append(h.immuneHistory[:i], h.immuneHistory[i+1:]...)
+			break
+		}
+	}
+	h.immuneHistory = append(h.immuneHistory, memory)
+	if maxSize > 0 && len(h.immuneHistory) > maxSize {
+		h.immuneHistory = h.immuneHistory[len(h.immuneHistory)-maxSize:]
+	}
+}
+
 func (h *sequenceHost) SetIntrahostModel(model IntrahostModel) error {
 	if h.IntrahostModel != nil {
 		return SetIntrahostModelExistsError(h.IntrahostModel.ModelName(), h.IntrahostModel.ModelID())
@@ -155,6 +231,10 @@ func (h *sequenceHost) SetFitnessModel(model FitnessModel) error {
 	return nil
 }
 
+func (h *sequenceHost) ReplaceFitnessModel(model FitnessModel) {
+	h.FitnessModel = model
+}
+
 func (h *sequenceHost) SetTransmissionModel(model TransmissionModel) error {
 	if h.TransmissionModel != nil {
 		return SetTransmissionModelExistsError(h.TransmissionModel.ModelName(), h.TransmissionModel.ModelID())
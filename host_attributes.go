@@ -0,0 +1,226 @@
+package contagiongo
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// HostAttributes holds the attributes of each host loaded from
+// a host attribute file.
+type HostAttributes struct {
+	// Columns are the attribute names in the order of the file header,
+	// excluding the host_id column.
+	Columns []string
+	types   map[int]int
+	values  map[int]map[string]string
+}
+
+// LoadHostAttributes parses a CSV file where each row describes a host.
+// The header must have a host_id column. If a type column is present,
+// its values must be integers and are used as host type IDs.
+// All other columns are loaded as text attributes.
+func LoadHostAttributes(path string) (*HostAttributes, error) {
+	/*
+		Format:
+
+		host_id,type,age_group,location
+		0,1,adult,north
+		1,0,child,south
+
+		Lines that start with # are ignored.
+	*/
+	f, err := openNetworkFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading host attributes failed")
+	}
+	defer f.Close()
+	reader := csv.NewReader(f)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, FileParsingError(err, 1)
+	}
+	a := &HostAttributes{
+		types:  make(map[int]int),
+		values: make(map[int]map[string]string),
+	}
+	idCol := -1
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		header[i] = name
+		if name == "host_id" {
+			idCol = i
+			continue
+		}
+		a.Columns = append(a.Columns, name)
+	}
+	if idCol < 0 {
+		line, _ := reader.FieldPos(0)
+		return nil, FileParsingError(fmt.Errorf("host attribute header must have a host_id column"), line)
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if perr, ok := err.(*csv.ParseError); ok {
+				return nil, FileParsingError(perr.Err, perr.Line)
+			}
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		id, err := strconv.Atoi(strings.TrimSpace(record[idCol]))
+		if err != nil {
+			return nil, FileParsingError(err, line)
+		}
+		if _, exists := a.values[id]; exists {
+			return nil, FileParsingError(IntKeyExists(id), line)
+		}
+		values := make(map[string]string)
+		for i, name := range header {
+			if i == idCol {
+				continue
+			}
+			values[name] = strings.TrimSpace(record[i])
+		}
+		if typeValue, exists := values["type"]; exists {
+			a.types[id], err = strconv.Atoi(typeValue)
+			if err != nil {
+				return nil, FileParsingError(errors.Wrap(err, "host type must be an integer"), line)
+			}
+		}
+		a.values[id] = values
+	}
+	return a, nil
+}
+
+// HostIDs returns the sorted IDs of hosts in the file.
+func (a *HostAttributes) HostIDs() []int {
+	ids := make([]int, 0, len(a.values))
+	for id := range a.values {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// TypeID returns the host type ID of the host.
+// Hosts without a type have a type ID of 0.
+func (a *HostAttributes) TypeID(id int) int {
+	return a.types[id]
+}
+
+// Values returns the attributes of the host keyed by column name.
+// Returns nil if the host is not in the file.
+func (a *HostAttributes) Values(id int) map[string]string {
+	return a.values[id]
+}
+
+// Match returns true if the host has one of the given types and, for each
+// attribute, has one of the given values. An empty list of types matches
+// any type.
+func (a *HostAttributes) Match(id int, types []int, attrs map[string][]string) bool {
+	if _, exists := a.values[id]; !exists {
+		return false
+	}
+	if len(types) > 0 {
+		match := false
+		for _, t := range types {
+			if a.types[id] == t {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	for name, allowed := range attrs {
+		value, exists := a.values[id][name]
+		if !exists {
+			return false
+		}
+		match := false
+		for _, v := range allowed {
+			if value == v {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	return true
+}
+
+// hostSelectorValues converts the values of a host_attributes table to
+// lists of strings. Each value can be a string, a number, a boolean or
+// a list of these.
+func hostSelectorValues(attrs map[string]interface{}) (map[string][]string, error) {
+	selector := make(map[string][]string)
+	for name, value := range attrs {
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+		for _, v := range values {
+			switch v := v.(type) {
+			case string:
+				selector[name] = append(selector[name], v)
+			case int64:
+				selector[name] = append(selector[name], strconv.FormatInt(v, 10))
+			case float64:
+				selector[name] = append(selector[name], strconv.FormatFloat(v, 'f', -1, 64))
+			case bool:
+				selector[name] = append(selector[name], strconv.FormatBool(v))
+			default:
+				return nil, fmt.Errorf("invalid value %v for host attribute %s", v, name)
+			}
+		}
+	}
+	return selector, nil
+}
+
+// selectHosts returns the hosts listed in hostIDs followed by the sorted
+// IDs of other hosts whose type and attributes match the selectors.
+func selectHosts(hostIDs, hostTypes []int, hostAttrs map[string]interface{}, a *HostAttributes) ([]int, error) {
+	if len(hostTypes) == 0 && len(hostAttrs) == 0 {
+		return hostIDs, nil
+	}
+	if a == nil {
+		return nil, fmt.Errorf("host_types and host_attributes require a host attribute file in host_attributes_path")
+	}
+	attrs, err := hostSelectorValues(hostAttrs)
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]bool)
+	for _, name := range a.Columns {
+		columns[name] = true
+	}
+	for name := range attrs {
+		if !columns[name] {
+			return nil, fmt.Errorf(UnrecognizedKeywordError, name, "host attribute")
+		}
+	}
+	selected := append([]int{}, hostIDs...)
+	listed := make(map[int]bool)
+	for _, id := range hostIDs {
+		listed[id] = true
+	}
+	for _, id := range a.HostIDs() {
+		if !listed[id] && a.Match(id, hostTypes, attrs) {
+			selected = append(selected, id)
+		}
+	}
+	return selected, nil
+}
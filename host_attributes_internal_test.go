@@ -0,0 +1,60 @@
+package contagiongo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSelectHosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "attributes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hosts.csv")
+	content := "host_id,type,age_group\n0,0,child\n1,1,child\n2,1,adult\n# comment\n3,0,adult\n"
+	err = ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := LoadHostAttributes(path)
+	if err != nil {
+		t.Fatalf(UnexpectedErrorWhileError, "loading host attributes", err)
+	}
+	if typeID := a.TypeID(2); typeID != 1 {
+		t.Errorf(UnequalIntParameterError, "host type ID", 1, typeID)
+	}
+	var tests = []struct {
+		hostIDs  []int
+		types    []int
+		attrs    map[string]interface{}
+		expected []int
+	}{
+		{[]int{3}, nil, nil, []int{3}},
+		{nil, []int{1}, nil, []int{1, 2}},
+		{[]int{3}, []int{1}, map[string]interface{}{"age_group": "child"}, []int{3, 1}},
+		{nil, nil, map[string]interface{}{"age_group": []interface{}{"child", "adult"}}, []int{0, 1, 2, 3}},
+	}
+	for _, tt := range tests {
+		selected, err := selectHosts(tt.hostIDs, tt.types, tt.attrs, a)
+		if err != nil {
+			t.Fatalf(UnexpectedErrorWhileError, "selecting hosts", err)
+		}
+		if len(selected) != len(tt.expected) {
+			t.Errorf("expected hosts %v, got %v instead", tt.expected, selected)
+			continue
+		}
+		for i := range selected {
+			if selected[i] != tt.expected[i] {
+				t.Errorf("expected hosts %v, got %v instead", tt.expected, selected)
+				break
+			}
+		}
+	}
+	_, err = selectHosts(nil, nil, map[string]interface{}{"location": "north"}, a)
+	if err == nil {
+		t.Errorf(ExpectedErrorWhileError, "selecting hosts with an unknown attribute")
+	}
+}
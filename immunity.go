@@ -0,0 +1,128 @@
+package contagiongo
+
+// ImmuneSystem determines how strongly a host is protected against
+// a pathogen with a particular sequence.
+type ImmuneSystem interface {
+	// Protection returns the fraction of pathogens with the given sequence
+	// that are neutralized, from 0 (no protection) to 1 (complete
+	// protection).
+	Protection(sequence []uint8) float64
+}
+
+// ImmuneMemory is an epitope remembered by a host and the generation
+// when the host was first infected by a pathogen carrying it.
+type ImmuneMemory struct {
+	Epitope    []uint8 `json:"epitope"`
+	Generation int     `json:"generation"`
+}
+
+// memoryImmuneSystem protects a host against genotypes that are similar
+// to the genotypes it was previously infected with.
+type memoryImmuneSystem struct {
+	epitopes [][]uint8
+	strength float64
+	distance int
+	pos      []int
+}
+
+// HostImmuneSystem returns the immune system of the host based on the
+// epitopes it remembered up to generation t and the cross-immunity
+// parameters of its intrahost model.
+// Returns nil if the host has no immune memory.
+func HostImmuneSystem(host Host, t int) ImmuneSystem {
+	model := host.GetIntrahostModel()
+	if model == nil {
+		return nil
+	}
+	strength, distance := model.CrossImmunity()
+	if strength <= 0 {
+		return nil
+	}
+	var epitopes [][]uint8
+	for _, m := range host.ImmuneHistory() {
+		if m.Generation <= t {
+			epitopes = append(epitopes, m.Epitope)
+		}
+	}
+	if len(epitopes) == 0 {
+		return nil
+	}
+	return &memoryImmuneSystem{epitopes, strength, distance, model.EpitopePositions()}
+}
+
+// Protection returns the largest protection conferred by any remembered
+// epitope. Protection against an identical epitope is equal to the
+// cross-immunity strength and decreases linearly with the number of
+// differences until it reaches 0 at the cross-immunity distance.
+// If the distance is 0, only identical epitopes are protected against.
+func (s *memoryImmuneSystem) Protection(sequence []uint8) float64 {
+	epitope := Epitope(sequence, s.pos)
+	var protection float64
+	for _, remembered := range s.epitopes {
+		d := hammingDistance(epitope, remembered)
+		var p float64
+		if d == 0 {
+			p = s.strength
+		} else if d < s.distance {
+			p = s.strength * (1 - float64(d)/float64(s.distance))
+		}
+		if p > protection {
+			protection = p
+		}
+	}
+	return protection
+}
+
+// Epitope returns the states of the sequence at the given positions.
+// Returns the whole sequence if no positions are given.
+func Epitope(sequence []uint8, pos []int) []uint8 {
+	if len(pos) == 0 {
+		return sequence
+	}
+	epitope := make([]uint8, len(pos))
+	for i, p := range pos {
+		epitope[i] = sequence[p]
+	}
+	return epitope
+}
+
+// RememberInfection adds the epitope of the sequence that infected the
+// host at generation t to its immune history. Nothing is recorded if the
+// intrahost model of the host does not confer cross-immunity.
+func RememberInfection(host Host, sequence []uint8, t int) {
+	model := host.GetIntrahostModel()
+	if model == nil {
+		return
+	}
+	if strength, _ := model.CrossImmunity(); strength <= 0 {
+		return
+	}
+	host.RememberEpitope(Epitope(sequence, model.EpitopePositions()), t, model.ImmuneMemorySize())
+}
+
+// infectionProb returns the probability that pathogens transmitted to a
+// host in the given status can infect it based on the protection
+// given by its status.
+func infectionProb(host Host, status int) float64 {
+	model := host.GetIntrahostModel()
+	if model == nil {
+		return 1
+	}
+	return 1 - model.StatusProtection(status)
+}
+
+// hammingDistance returns the number of positions where the two sequences
+// differ. Sequences of different lengths are only compared up to the
+// length of the shorter sequence, and the extra sites count as differences.
+func hammingDistance(a, b []uint8) int {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	d := len(b) - len(a)
+	for i := range a {
+		if a[i] != b[i] {
+			d++
+		}
+	}
+	return d
+}
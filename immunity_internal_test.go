@@ -0,0 +1,51 @@
+package contagiongo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHostImmuneSystem_Protection(t *testing.T) {
+	model := new(ConstantPopModel)
+	model.crossImmunity = 0.8
+	model.crossImmunityDistance = 4
+	model.epitopePositions = []int{0, 1, 2, 3, 4}
+	model.immuneMemorySize = 2
+	host := EmptySequenceHost(0)
+	host.SetIntrahostModel(model)
+	if s := HostImmuneSystem(host, 0); s != nil {
+		t.Errorf("expected no immune system for a host without immune history")
+	}
+
+	RememberInfection(host, []uint8{0, 0, 0, 0, 0, 1, 1}, 1)
+	if s := HostImmuneSystem(host, 0); s != nil {
+		t.Errorf("expected no immune system before the first infection")
+	}
+	s := HostImmuneSystem(host, 1)
+	table := []struct {
+		sequence []uint8
+		expected float64
+	}{
+		// Sites outside the epitope are ignored
+		{[]uint8{0, 0, 0, 0, 0, 2, 2}, 0.8},
+		{[]uint8{1, 0, 0, 0, 0, 1, 1}, 0.6},
+		{[]uint8{1, 1, 1, 0, 0, 1, 1}, 0.2},
+		{[]uint8{1, 1, 1, 1, 0, 1, 1}, 0},
+	}
+	for _, row := range table {
+		if p := s.Protection(row.sequence); math.Abs(p-row.expected) > 1e-9 {
+			t.Errorf(UnequalFloatParameterError, "protection", row.expected, p)
+		}
+	}
+
+	// Oldest epitope is forgotten
+	RememberInfection(host, []uint8{1, 1, 1, 1, 1, 0, 0}, 2)
+	RememberInfection(host, []uint8{2, 2, 2, 2, 2, 0, 0}, 3)
+	if l := len(host.ImmuneHistory()); l != 2 {
+		t.Errorf(UnequalIntParameterError, "number of remembered epitopes", 2, l)
+	}
+	s = HostImmuneSystem(host, 3)
+	if p := s.Protection([]uint8{0, 0, 0, 0, 0, 1, 1}); p != 0 {
+		t.Errorf(UnequalFloatParameterError, "protection", 0., p)
+	}
+}
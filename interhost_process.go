@@ -3,9 +3,10 @@ package contagiongo
 import (
 	"math"
 	"math/rand"
+	"sort"
 	"sync"
 
-	rv "github.com/kentwait/randomvariate"
+	"github.com/segmentio/ksuid"
 )
 
 // TransmissionEvent is a struct for sending and receiving
@@ -27,8 +28,16 @@ type ExchangeEvent struct {
 // TransmitPathogens transmits the pathogen to its neighboring host/s.
 // If transmission occurs, sends transmitted node over the channel to
 // be added to the recepient. Also sends node information in order to
-// record the event.
-func TransmitPathogens(i, t int, src, dst Host, numMigrants int, transmissionProb float64, count int, c chan<- TransmissionEvent, d chan<- TransmissionPackage, wg *sync.WaitGroup) {
+// record the event. Random draws use the given generator, which should not
+// be shared with other goroutines.
+// If weights is not nil, each weight is the transmission fitness of the
+// corresponding pathogen in src.Pathogens(). Pathogens are then picked in
+// proportion to their weights and the transmission probability is scaled
+// by the mean weight.
+// Each transmitted pathogen fails to infect the destination host with
+// probability equal to the protection of the host's immune system against
+// the pathogen.
+func TransmitPathogens(r *rand.Rand, i, t int, src, dst Host, numMigrants int, transmissionProb float64, count int, weights []float64, c chan<- TransmissionEvent, d chan<- TransmissionPackage, wg *sync.WaitGroup) {
 	defer wg.Done()
 	// Check if migration size if larger than the current population size
 	// If larger, make migrants equal to existing size
@@ -42,10 +51,23 @@ func TransmitPathogens(i, t int, src, dst Host, numMigrants int, transmissionPro
 	// Determine if tranmission occurs or not based on source's
 	// transmission probability
 	// transmissionProb := src.GetTransmissionModel().TransmissionProb()
-	if rv.Binomial(1, transmissionProb) == 1.0 {
+	if weights != nil {
+		transmissionProb *= meanWeight(weights)
+	}
+	if r.Float64() < transmissionProb {
 		// If transmission occurs, randomly pick pathogens to transmit
-		for _, p := range src.PickPathogens(numMigrants) {
+		var migrants []GenotypeNode
+		if weights != nil {
+			migrants = pickWeightedPathogens(r, src.Pathogens(), weights, numMigrants)
+		} else {
+			migrants = src.PickPathogens(r, numMigrants)
+		}
+		immuneSystem := HostImmuneSystem(dst, t)
+		for _, p := range migrants {
 			if p != nil {
+				if immuneSystem != nil && r.Float64() < immuneSystem.Protection(p.Sequence()) {
+					continue
+				}
 				c <- TransmissionEvent{dst, p}
 				d <- TransmissionPackage{
 					instanceID: i,
@@ -60,26 +82,28 @@ func TransmitPathogens(i, t int, src, dst Host, numMigrants int, transmissionPro
 }
 
 // ExchangePathogens exchanges pathogens between neighboring hosts.
-func ExchangePathogens(i, t int, h1, h2 Host, h1Count, h2Count int, c chan<- ExchangeEvent, d chan<- TransmissionPackage, wg *sync.WaitGroup) {
+// Random draws use the given generator, which should not be shared with
+// other goroutines.
+func ExchangePathogens(r *rand.Rand, i, t int, h1, h2 Host, h1Count, h2Count, h1Age int, c chan<- ExchangeEvent, d chan<- TransmissionPackage, wg *sync.WaitGroup) {
 	defer wg.Done()
+	// Assumes transmission size if equal in all hosts
+	numMigrants := h1.GetTransmissionModel().TransmissionSize(r)
 	// Check if migration size if larger than the current population size
 	// If larger, skip
-	if h1.GetTransmissionModel().TransmissionSize() > h1Count {
+	if numMigrants > h1Count {
 		return
-	} else if h2.GetTransmissionModel().TransmissionSize() > h2Count {
+	} else if numMigrants > h2Count {
 		return
 	}
-	// Assumes transmission size if equal in all hosts
-	numMigrants := h1.GetTransmissionModel().TransmissionSize()
 
 	// Determine if exchange occurs or not based on square of the source's
 	// transmission probability. This assumes that transmission prob is equal
 	// between any two hosts.
-	transmissionProb := math.Pow(h1.GetTransmissionModel().TransmissionProb(), 2)
-	if rv.Binomial(1, transmissionProb) == 1.0 {
+	transmissionProb := math.Pow(h1.GetTransmissionModel().TransmissionProb(h1Count, h1Age), 2)
+	if r.Float64() < transmissionProb {
 		// If exchange occurs, randomly pick pathogens in the h1 and h2 hosts
 		// h1 -> h2
-		for _, p := range h1.PickPathogens(numMigrants) {
+		for _, p := range h1.PickPathogens(r, numMigrants) {
 			if p != nil {
 				c <- ExchangeEvent{
 					source:      h1,
@@ -96,7 +120,7 @@ func ExchangePathogens(i, t int, h1, h2 Host, h1Count, h2Count int, c chan<- Exc
 			}
 		}
 		// h2 -> h1
-		for _, p := range h2.PickPathogens(numMigrants) {
+		for _, p := range h2.PickPathogens(r, numMigrants) {
 			if p != nil {
 				c <- ExchangeEvent{
 					source:      h2,
@@ -115,6 +139,27 @@ func ExchangePathogens(i, t int, h1, h2 Host, h1Count, h2Count int, c chan<- Exc
 	}
 }
 
-func pickPathogens(count, numMigrants int) []int {
-	return rand.Perm(count)[:numMigrants]
+// infectHosts adds transmitted pathogens to their destination hosts.
+// Events are applied in order of destination and pathogen so that the
+// result does not depend on the order transmissions were decided.
+// Each destination host remembers the pathogens it was infected with.
+func infectHosts(sim Epidemic, t int, events []TransmissionEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if a, b := events[i].destination.ID(), events[j].destination.ID(); a != b {
+			return a < b
+		}
+		return ksuid.Compare(events[i].pathogen.UID(), events[j].pathogen.UID()) < 0
+	})
+	for _, e := range events {
+		// Infection age starts when a host without pathogens is infected
+		if e.destination.PathogenPopSize() == 0 {
+			sim.SetInfectionTime(e.destination.ID(), t)
+		}
+		e.destination.AddPathogens(e.pathogen)
+		RememberInfection(e.destination, e.pathogen.Sequence(), t)
+	}
+}
+
+func pickPathogens(r *rand.Rand, count, numMigrants int) []int {
+	return r.Perm(count)[:numMigrants]
 }
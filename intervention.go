@@ -0,0 +1,519 @@
+package contagiongo
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// The following are keywords for the actions performed by an intervention.
+const (
+	// VaccinateAction moves susceptible hosts to the vaccinated status.
+	VaccinateAction = "vaccinate"
+	// IsolateAction removes all connections of hosts carrying pathogens.
+	IsolateAction = "isolate"
+	// TreatAction switches the fitness model of hosts to the fitness
+	// landscape of pathogens exposed to a drug.
+	TreatAction = "treat"
+	// ReleaseAction restores the connections of an isolated host or the
+	// fitness model of a treated host once the isolation or treatment
+	// period is over.
+	ReleaseAction = "release"
+	// TransmissionProbAction changes the transmission probability of
+	// a transmission model.
+	TransmissionProbAction = "set_transmission_prob"
+)
+
+// The following are keywords for the conditions that decide when an
+// intervention is applied.
+const (
+	// ScheduleTrigger applies the intervention at a given generation.
+	ScheduleTrigger = "generation"
+	// PrevalenceTrigger applies the intervention once the fraction of
+	// hosts carrying pathogens reaches the intervention threshold.
+	PrevalenceTrigger = "prevalence"
+)
+
+// The following are keywords for the way hosts targeted by an intervention
+// are chosen among the eligible hosts.
+const (
+	// RandomSelection picks hosts at random.
+	RandomSelection = "random"
+	// DegreeSelection picks the hosts with the most neighbors first.
+	DegreeSelection = "degree"
+)
+
+// Intervention is an action applied to hosts or models during
+// a simulation such as vaccination or isolation.
+type Intervention interface {
+	// ID returns the ID of the intervention.
+	ID() int
+	// Action returns the keyword of the action performed.
+	Action() string
+	// Intervene applies the intervention at generation t if its trigger is
+	// satisfied, and reverts effects that have ended. Returns a record of
+	// every action taken.
+	Intervene(sim Epidemic, t int) []InterventionPackage
+	// State returns the progress of the intervention.
+	State() InterventionState
+	// Restore continues the intervention from a saved state.
+	// Effects on models are applied again to the simulation.
+	Restore(sim Epidemic, state InterventionState)
+}
+
+// InterventionState records the progress of an intervention so that it
+// can be continued from a checkpoint.
+type InterventionState struct {
+	// LastApplied is the last generation the intervention was applied.
+	// It is -1 if the intervention has not been applied.
+	LastApplied int `json:"last_applied"`
+	// Releases maps a generation to the isolated hosts that are
+	// reconnected at that generation.
+	Releases map[int][]int `json:"releases,omitempty"`
+	// Hosts are the hosts currently affected by the intervention.
+	Hosts []int `json:"hosts,omitempty"`
+}
+
+// interventionSchedule decides when an intervention is applied.
+type interventionSchedule struct {
+	id          int
+	trigger     string
+	start       int
+	interval    int
+	threshold   float64
+	lastApplied int
+}
+
+func (s *interventionSchedule) ID() int {
+	return s.id
+}
+
+// due returns true if the intervention should be applied at generation t.
+// An intervention is applied at most once unless an interval is set,
+// in which case it can be applied again after interval generations.
+func (s *interventionSchedule) due(sim Epidemic, t int) bool {
+	if t < s.start {
+		return false
+	}
+	if s.lastApplied >= 0 && (s.interval < 1 || t-s.lastApplied < s.interval) {
+		return false
+	}
+	switch s.trigger {
+	case PrevalenceTrigger:
+		return Prevalence(sim) >= s.threshold
+	}
+	return true
+}
+
+// hostTargets holds the hosts an intervention can act on and how many
+// of them are chosen every time the intervention is applied.
+type hostTargets struct {
+	// hostIDs are the eligible hosts. If nil, all hosts are eligible.
+	hostIDs   []int
+	numHosts  int
+	selection string
+}
+
+// candidates returns the sorted IDs of eligible hosts that satisfy
+// the condition.
+func (h *hostTargets) candidates(sim Epidemic, eligible func(id int, host Host) bool) []int {
+	var ids []int
+	if h.hostIDs == nil {
+		for id := range sim.HostMap() {
+			ids = append(ids, id)
+		}
+	} else {
+		ids = append(ids, h.hostIDs...)
+	}
+	sort.Ints(ids)
+	var candidates []int
+	for _, id := range ids {
+		if host := sim.Host(id); host != nil && eligible(id, host) {
+			candidates = append(candidates, id)
+		}
+	}
+	return candidates
+}
+
+// pick chooses numHosts hosts from the candidates. If numHosts is 0 or
+// there are fewer candidates, all candidates are chosen.
+// Chosen hosts are returned in ascending order.
+func (h *hostTargets) pick(r *rand.Rand, sim Epidemic, candidates []int) []int {
+	if h.numHosts < 1 || len(candidates) <= h.numHosts {
+		return candidates
+	}
+	picked := make([]int, 0, h.numHosts)
+	switch h.selection {
+	case DegreeSelection:
+		ranked := append([]int{}, candidates...)
+		sort.SliceStable(ranked, func(i, j int) bool {
+			return len(sim.HostNeighbors(ranked[i])) > len(sim.HostNeighbors(ranked[j]))
+		})
+		picked = append(picked, ranked[:h.numHosts]...)
+	default:
+		for _, i := range r.Perm(len(candidates))[:h.numHosts] {
+			picked = append(picked, candidates[i])
+		}
+	}
+	sort.Ints(picked)
+	return picked
+}
+
+// vaccination moves susceptible hosts to the vaccinated status.
+// Vaccinated hosts stay vaccinated for the vaccinated duration set in
+// their intrahost model.
+type vaccination struct {
+	interventionSchedule
+	hostTargets
+}
+
+// NewVaccination creates an intervention that vaccinates numHosts
+// susceptible hosts among hostIDs starting from generation start.
+// If hostIDs is nil, all hosts are eligible.
+func NewVaccination(id int, trigger string, start, interval int, threshold float64, hostIDs []int, numHosts int, selection string) Intervention {
+	iv := new(vaccination)
+	iv.interventionSchedule = interventionSchedule{id, trigger, start, interval, threshold, -1}
+	iv.hostTargets = hostTargets{hostIDs, numHosts, selection}
+	return iv
+}
+
+func (iv *vaccination) Action() string {
+	return VaccinateAction
+}
+
+func (iv *vaccination) Intervene(sim Epidemic, t int) []InterventionPackage {
+	if !iv.due(sim, t) {
+		return nil
+	}
+	iv.lastApplied = t
+	r := sim.Rand(t, interventionStream, iv.id)
+	candidates := iv.candidates(sim, func(id int, host Host) bool {
+		return sim.HostStatus(id) == SusceptibleStatusCode
+	})
+	var records []InterventionPackage
+	for _, id := range iv.pick(r, sim, candidates) {
+		duration := vaccinatedDuration(r, sim, sim.Host(id))
+		sim.SetHostStatus(id, VaccinatedStatusCode)
+		sim.SetHostTimer(id, duration)
+		records = append(records, InterventionPackage{
+			genID:          t,
+			interventionID: iv.id,
+			action:         VaccinateAction,
+			hostID:         id,
+			value:          float64(duration),
+		})
+	}
+	return records
+}
+
+// vaccinatedDuration returns the number of generations the host stays
+// vaccinated. User-defined compartmental models take the duration from
+// the vaccinated compartment.
+func vaccinatedDuration(r *rand.Rand, sim Epidemic, host Host) int {
+	if cs, ok := sim.(*CompartmentalSimulation); ok {
+		return cs.Model().StatusDuration(r, host, VaccinatedStatusCode)
+	}
+	return host.GetIntrahostModel().StatusDuration(r, VaccinatedStatusCode)
+}
+
+func (iv *vaccination) State() InterventionState {
+	return InterventionState{LastApplied: iv.lastApplied}
+}
+
+func (iv *vaccination) Restore(sim Epidemic, state InterventionState) {
+	iv.lastApplied = state.LastApplied
+}
+
+// isolation removes all connections of hosts carrying pathogens.
+// If duration is positive, connections are restored after duration
+// generations. Otherwise hosts remain isolated.
+type isolation struct {
+	interventionSchedule
+	hostTargets
+	duration int
+	releases map[int][]int
+}
+
+// NewIsolation creates an intervention that isolates numHosts hosts
+// carrying pathogens among hostIDs starting from generation start.
+// If hostIDs is nil, all hosts are eligible.
+func NewIsolation(id int, trigger string, start, interval int, threshold float64, hostIDs []int, numHosts int, selection string, duration int) Intervention {
+	iv := new(isolation)
+	iv.interventionSchedule = interventionSchedule{id, trigger, start, interval, threshold, -1}
+	iv.hostTargets = hostTargets{hostIDs, numHosts, selection}
+	iv.duration = duration
+	iv.releases = make(map[int][]int)
+	return iv
+}
+
+func (iv *isolation) Action() string {
+	return IsolateAction
+}
+
+func (iv *isolation) Intervene(sim Epidemic, t int) []InterventionPackage {
+	var records []InterventionPackage
+	// Reconnect hosts whose isolation is over
+	var releaseTimes []int
+	for releaseTime := range iv.releases {
+		if releaseTime <= t {
+			releaseTimes = append(releaseTimes, releaseTime)
+		}
+	}
+	sort.Ints(releaseTimes)
+	for _, releaseTime := range releaseTimes {
+		for _, id := range iv.releases[releaseTime] {
+			// Skip hosts that left the population
+			if sim.Host(id) == nil {
+				continue
+			}
+			sim.SetHostIsolated(id, false)
+			records = append(records, InterventionPackage{
+				genID:          t,
+				interventionID: iv.id,
+				action:         ReleaseAction,
+				hostID:         id,
+			})
+		}
+		delete(iv.releases, releaseTime)
+	}
+	if !iv.due(sim, t) {
+		return records
+	}
+	iv.lastApplied = t
+	r := sim.Rand(t, interventionStream, iv.id)
+	candidates := iv.candidates(sim, func(id int, host Host) bool {
+		return host.PathogenPopSize() > 0 && !sim.HostIsolated(id)
+	})
+	for _, id := range iv.pick(r, sim, candidates) {
+		sim.SetHostIsolated(id, true)
+		if iv.duration > 0 {
+			iv.releases[t+iv.duration] = append(iv.releases[t+iv.duration], id)
+		}
+		records = append(records, InterventionPackage{
+			genID:          t,
+			interventionID: iv.id,
+			action:         IsolateAction,
+			hostID:         id,
+			value:          float64(iv.duration),
+		})
+	}
+	return records
+}
+
+func (iv *isolation) State() InterventionState {
+	releases := make(map[int][]int)
+	for releaseTime, ids := range iv.releases {
+		releases[releaseTime] = append([]int{}, ids...)
+	}
+	return InterventionState{LastApplied: iv.lastApplied, Releases: releases}
+}
+
+func (iv *isolation) Restore(sim Epidemic, state InterventionState) {
+	iv.lastApplied = state.LastApplied
+	iv.releases = make(map[int][]int)
+	for releaseTime, ids := range state.Releases {
+		iv.releases[releaseTime] = append([]int{}, ids...)
+	}
+}
+
+// treatment replaces the fitness model of hosts while they are treated.
+// If duration is positive, hosts return to their original fitness model
+// after duration generations. Otherwise hosts remain treated.
+type treatment struct {
+	interventionSchedule
+	hostTargets
+	duration int
+	// models maps the ID of a fitness model to the fitness model used
+	// during treatment by hosts associated to it.
+	models    map[int]FitnessModel
+	originals map[int]FitnessModel
+	releases  map[int][]int
+}
+
+// NewTreatment creates an intervention that treats numHosts hosts among
+// hostIDs starting from generation start. During treatment, each host uses
+// the fitness model that models maps to the ID of its original fitness model.
+// If hostIDs is nil, all hosts are eligible.
+func NewTreatment(id int, trigger string, start, interval int, threshold float64, hostIDs []int, numHosts int, selection string, duration int, models map[int]FitnessModel) Intervention {
+	iv := new(treatment)
+	iv.interventionSchedule = interventionSchedule{id, trigger, start, interval, threshold, -1}
+	iv.hostTargets = hostTargets{hostIDs, numHosts, selection}
+	iv.duration = duration
+	iv.models = models
+	iv.originals = make(map[int]FitnessModel)
+	iv.releases = make(map[int][]int)
+	return iv
+}
+
+func (iv *treatment) Action() string {
+	return TreatAction
+}
+
+func (iv *treatment) Intervene(sim Epidemic, t int) []InterventionPackage {
+	var records []InterventionPackage
+	// Restore the fitness models of hosts whose treatment is over
+	var releaseTimes []int
+	for releaseTime := range iv.releases {
+		if releaseTime <= t {
+			releaseTimes = append(releaseTimes, releaseTime)
+		}
+	}
+	sort.Ints(releaseTimes)
+	for _, releaseTime := range releaseTimes {
+		for _, id := range iv.releases[releaseTime] {
+			host := sim.Host(id)
+			original := iv.originals[id]
+			delete(iv.originals, id)
+			// Skip hosts that left the population
+			if host == nil {
+				continue
+			}
+			host.ReplaceFitnessModel(original)
+			records = append(records, InterventionPackage{
+				genID:          t,
+				interventionID: iv.id,
+				action:         ReleaseAction,
+				hostID:         id,
+			})
+		}
+		delete(iv.releases, releaseTime)
+	}
+	if !iv.due(sim, t) {
+		return records
+	}
+	iv.lastApplied = t
+	r := sim.Rand(t, interventionStream, iv.id)
+	candidates := iv.candidates(sim, func(id int, host Host) bool {
+		if _, treated := iv.originals[id]; treated || host.GetFitnessModel() == nil {
+			return false
+		}
+		_, exists := iv.models[host.GetFitnessModel().ModelID()]
+		return exists
+	})
+	for _, id := range iv.pick(r, sim, candidates) {
+		iv.treat(sim.Host(id))
+		if iv.duration > 0 {
+			iv.releases[t+iv.duration] = append(iv.releases[t+iv.duration], id)
+		}
+		records = append(records, InterventionPackage{
+			genID:          t,
+			interventionID: iv.id,
+			action:         TreatAction,
+			hostID:         id,
+			value:          float64(iv.duration),
+		})
+	}
+	return records
+}
+
+// treat switches the host to the fitness model used during treatment.
+func (iv *treatment) treat(host Host) {
+	original := host.GetFitnessModel()
+	iv.originals[host.ID()] = original
+	host.ReplaceFitnessModel(iv.models[original.ModelID()])
+}
+
+func (iv *treatment) State() InterventionState {
+	releases := make(map[int][]int)
+	for releaseTime, ids := range iv.releases {
+		releases[releaseTime] = append([]int{}, ids...)
+	}
+	var hosts []int
+	for id := range iv.originals {
+		hosts = append(hosts, id)
+	}
+	sort.Ints(hosts)
+	return InterventionState{LastApplied: iv.lastApplied, Releases: releases, Hosts: hosts}
+}
+
+func (iv *treatment) Restore(sim Epidemic, state InterventionState) {
+	iv.lastApplied = state.LastApplied
+	iv.releases = make(map[int][]int)
+	for releaseTime, ids := range state.Releases {
+		iv.releases[releaseTime] = append([]int{}, ids...)
+	}
+	iv.originals = make(map[int]FitnessModel)
+	for _, id := range state.Hosts {
+		if host := sim.Host(id); host != nil {
+			iv.treat(host)
+		}
+	}
+}
+
+// transmissionProbChange replaces the transmission probability of the
+// transmission model with the given name.
+type transmissionProbChange struct {
+	interventionSchedule
+	modelName string
+	prob      float64
+}
+
+// NewTransmissionProbChange creates an intervention that sets the
+// transmission probability of the named transmission model to prob
+// starting from generation start.
+func NewTransmissionProbChange(id int, trigger string, start, interval int, threshold float64, modelName string, prob float64) Intervention {
+	iv := new(transmissionProbChange)
+	iv.interventionSchedule = interventionSchedule{id, trigger, start, interval, threshold, -1}
+	iv.modelName = modelName
+	iv.prob = prob
+	return iv
+}
+
+func (iv *transmissionProbChange) Action() string {
+	return TransmissionProbAction
+}
+
+func (iv *transmissionProbChange) Intervene(sim Epidemic, t int) []InterventionPackage {
+	if !iv.due(sim, t) {
+		return nil
+	}
+	iv.lastApplied = t
+	iv.apply(sim)
+	return []InterventionPackage{{
+		genID:          t,
+		interventionID: iv.id,
+		action:         TransmissionProbAction,
+		hostID:         -1,
+		value:          iv.prob,
+	}}
+}
+
+// apply sets the transmission probability of every model with
+// the intervention's model name.
+func (iv *transmissionProbChange) apply(sim Epidemic) {
+	for _, host := range sim.HostMap() {
+		if model := host.GetTransmissionModel(); model != nil && model.ModelName() == iv.modelName {
+			model.SetTransmissionProb(iv.prob)
+		}
+	}
+}
+
+func (iv *transmissionProbChange) State() InterventionState {
+	return InterventionState{LastApplied: iv.lastApplied}
+}
+
+func (iv *transmissionProbChange) Restore(sim Epidemic, state InterventionState) {
+	iv.lastApplied = state.LastApplied
+	if iv.lastApplied >= 0 {
+		iv.apply(sim)
+	}
+}
+
+// intervene applies the interventions of the simulation at generation t
+// and records the actions taken.
+func intervene(sim EpidemicSimulation, t int) {
+	interventions := sim.Interventions()
+	if len(interventions) == 0 {
+		return
+	}
+	c := make(chan InterventionPackage)
+	go func() {
+		for _, iv := range interventions {
+			for _, pack := range iv.Intervene(sim, t) {
+				pack.instanceID = sim.InstanceID()
+				c <- pack
+			}
+		}
+		close(c)
+	}()
+	sim.WriteInterventions(c)
+}
@@ -0,0 +1,25 @@
+package contagiongo
+
+import "testing"
+
+func TestInterventionSchedule_Due(t *testing.T) {
+	var tests = []struct {
+		interval    int
+		lastApplied int
+		t           int
+		expected    bool
+	}{
+		{0, -1, 4, false},
+		{0, -1, 5, true},
+		{0, -1, 20, true},
+		{0, 5, 20, false},
+		{3, 5, 7, false},
+		{3, 5, 8, true},
+	}
+	for _, tt := range tests {
+		s := interventionSchedule{id: 0, trigger: ScheduleTrigger, start: 5, interval: tt.interval, lastApplied: tt.lastApplied}
+		if due := s.due(nil, tt.t); due != tt.expected {
+			t.Errorf("expected due to be %t at generation %d with interval %d and last applied at %d, got %t instead", tt.expected, tt.t, tt.interval, tt.lastApplied, due)
+		}
+	}
+}
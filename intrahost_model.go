@@ -2,8 +2,7 @@ package contagiongo
 
 import (
 	"math"
-
-	rv "github.com/kentwait/randomvariate"
+	"math/rand"
 )
 
 // IntrahostModel is an interface for any type of intrahost model.
@@ -44,9 +43,40 @@ type IntrahostModel interface {
 
 	// Infection duration
 
-	// StatusDuration
-	StatusDuration(status int) int
+	// StatusDuration returns the number of generations a host stays in
+	// the given status. Random draws use the given generator.
+	StatusDuration(r *rand.Rand, status int) int
 	ProbabilisticDuration() bool
+
+	// Status thresholds
+
+	// InfectiveThreshold returns the pathogen population size at which
+	// an exposed host becomes infective. Returns 0 if not set.
+	InfectiveThreshold() int
+	// InfectiveMotif returns the sequence motif and its positions that
+	// makes an exposed host infective once any of its pathogens carries
+	// the motif. Returns empty slices if not set.
+	InfectiveMotif() (sequence []uint8, pos []int)
+	// ClearanceThreshold returns the pathogen population size below which
+	// the infection within the host is cleared. Returns 0 if not set.
+	ClearanceThreshold() int
+
+	// Immunity
+
+	// CrossImmunity returns the protection against a genotype whose
+	// epitope is identical to one in the immune history of the host, and
+	// the number of differences in the epitope at which protection
+	// disappears. Returns 0 if hosts do not remember past infections.
+	CrossImmunity() (strength float64, distance int)
+	// EpitopePositions returns the sites recognized by the immune system.
+	// Returns an empty slice if the whole sequence is recognized.
+	EpitopePositions() []int
+	// ImmuneMemorySize returns the maximum number of epitopes a host
+	// remembers. Returns 0 if the number is not limited.
+	ImmuneMemorySize() int
+	// StatusProtection returns the protection against infection by any
+	// genotype given to hosts in the given status.
+	StatusProtection(status int) float64
 }
 
 // ConstantPopModel models a constant pathogen population size within the host.
@@ -55,6 +85,8 @@ type ConstantPopModel struct {
 	mutationParams
 	recombinationParams
 	durationParams
+	thresholdParams
+	immunityParams
 	constantIntrahostPopModel
 }
 
@@ -65,6 +97,8 @@ type BevertonHoltThresholdPopModel struct {
 	mutationParams
 	recombinationParams
 	durationParams
+	thresholdParams
+	immunityParams
 	bhtIntrahostPopModel
 }
 
@@ -78,6 +112,8 @@ type FitnessDependentPopModel struct {
 	mutationParams
 	recombinationParams
 	durationParams
+	thresholdParams
+	immunityParams
 	fitnessIntrahostPopModel
 }
 
@@ -131,9 +167,9 @@ type durationParams struct {
 	probDuration   bool
 }
 
-func (params *durationParams) StatusDuration(status int) int {
+func (params *durationParams) StatusDuration(r *rand.Rand, status int) int {
 	if params.probDuration {
-		return rv.Poisson(float64(params.statusDuration[status]))
+		return poisson(r, float64(params.statusDuration[status]))
 	}
 	return params.statusDuration[status]
 }
@@ -142,6 +178,85 @@ func (params *durationParams) ProbabilisticDuration() bool {
 	return params.probDuration
 }
 
+type thresholdParams struct {
+	infectiveThreshold int
+	infectiveMotif     []uint8
+	infectiveMotifPos  []int
+	clearanceThreshold int
+}
+
+func (params *thresholdParams) InfectiveThreshold() int {
+	return params.infectiveThreshold
+}
+
+func (params *thresholdParams) InfectiveMotif() (sequence []uint8, pos []int) {
+	return params.infectiveMotif, params.infectiveMotifPos
+}
+
+func (params *thresholdParams) ClearanceThreshold() int {
+	return params.clearanceThreshold
+}
+
+type immunityParams struct {
+	crossImmunity         float64
+	crossImmunityDistance int
+	epitopePositions      []int
+	immuneMemorySize      int
+	statusProtection      map[int]float64
+}
+
+func (params *immunityParams) CrossImmunity() (strength float64, distance int) {
+	return params.crossImmunity, params.crossImmunityDistance
+}
+
+func (params *immunityParams) EpitopePositions() []int {
+	return params.epitopePositions
+}
+
+func (params *immunityParams) ImmuneMemorySize() int {
+	return params.immuneMemorySize
+}
+
+func (params *immunityParams) StatusProtection(status int) float64 {
+	return params.statusProtection[status]
+}
+
+// InfectiveThresholdReached returns true if the host satisfies the
+// pathogen load or genotype threshold set in its intrahost model to be
+// considered infective. Returns false if no threshold is set.
+func InfectiveThresholdReached(host Host) bool {
+	model := host.GetIntrahostModel()
+	if model == nil {
+		return false
+	}
+	if n := model.InfectiveThreshold(); n > 0 && host.PathogenPopSize() >= n {
+		return true
+	}
+	sequence, pos := model.InfectiveMotif()
+	if len(sequence) == 0 {
+		return false
+	}
+	m := newMotif(sequence, pos, 0)
+	for _, p := range host.Pathogens() {
+		if m.InSequence(p.Sequence()) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClearanceThresholdReached returns true if the pathogen load of the host
+// has fallen below the clearance threshold set in its intrahost model.
+// Returns false if no threshold is set.
+func ClearanceThresholdReached(host Host) bool {
+	model := host.GetIntrahostModel()
+	if model == nil {
+		return false
+	}
+	n := model.ClearanceThreshold()
+	return n > 0 && host.PathogenPopSize() < n
+}
+
 type constantIntrahostPopModel struct {
 	popSize int
 }
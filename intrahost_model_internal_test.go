@@ -0,0 +1,58 @@
+package contagiongo
+
+import "testing"
+
+var thresholdTests = []struct {
+	desc               string
+	infectiveThreshold int
+	infectiveMotif     []uint8
+	clearanceThreshold int
+	pathogens          int
+	sequence           []uint8
+	infective          bool
+	cleared            bool
+}{
+	{"unset thresholds", 0, nil, 0, 5, []uint8{0, 1, 0}, false, false},
+	{"unset thresholds without pathogens", 0, nil, 0, 0, []uint8{0, 1, 0}, false, false},
+	{"load below infective threshold", 5, nil, 0, 4, []uint8{0, 0, 0}, false, false},
+	{"load at infective threshold", 5, nil, 0, 5, []uint8{0, 0, 0}, true, false},
+	{"load above infective threshold", 5, nil, 0, 6, []uint8{0, 0, 0}, true, false},
+	{"load below clearance threshold", 0, nil, 3, 2, []uint8{0, 0, 0}, false, true},
+	{"load at clearance threshold", 0, nil, 3, 3, []uint8{0, 0, 0}, false, false},
+	{"load above clearance threshold", 0, nil, 3, 4, []uint8{0, 0, 0}, false, false},
+	{"genotype carries infective motif", 0, []uint8{1}, 0, 1, []uint8{0, 1, 0}, true, false},
+	{"genotype lacks infective motif", 0, []uint8{1}, 0, 1, []uint8{1, 0, 1}, false, false},
+	{"infective motif below load threshold", 5, []uint8{1}, 0, 1, []uint8{0, 1, 0}, true, false},
+}
+
+func TestThresholdReached(t *testing.T) {
+	tree := EmptyGenotypeTree()
+	r := NewRand(0)
+	for _, tt := range thresholdTests {
+		t.Run(tt.desc, func(t *testing.T) {
+			model := new(ConstantPopModel)
+			model.infectiveThreshold = tt.infectiveThreshold
+			model.clearanceThreshold = tt.clearanceThreshold
+			if tt.infectiveMotif != nil {
+				model.infectiveMotif = tt.infectiveMotif
+				model.infectiveMotifPos = []int{1}
+			}
+			host := EmptySequenceHost(0)
+			host.SetIntrahostModel(model)
+			for i := 0; i < tt.pathogens; i++ {
+				host.AddPathogens(tree.NewNode(newNodeUID(r), tt.sequence, 0))
+			}
+			if infective := InfectiveThresholdReached(host); infective != tt.infective {
+				t.Errorf("expected infective threshold reached to be %t, got %t instead", tt.infective, infective)
+			}
+			if cleared := ClearanceThresholdReached(host); cleared != tt.cleared {
+				t.Errorf("expected clearance threshold reached to be %t, got %t instead", tt.cleared, cleared)
+			}
+		})
+	}
+	// Hosts without an intrahost model never reach a threshold
+	host := EmptySequenceHost(0)
+	if InfectiveThresholdReached(host) || ClearanceThresholdReached(host) {
+		t.Errorf("expected no threshold to be reached without an intrahost model")
+	}
+}
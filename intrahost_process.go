@@ -5,25 +5,19 @@ import (
 	"math/rand"
 	"sort"
 	"sync"
-
-	rv "github.com/kentwait/randomvariate"
 )
 
 // MultinomialReplication replicates and selects sequences based on normalized fitness values used as probabilities.
-func MultinomialReplication(pathogens []GenotypeNode, normedFitnesses []float64, newPopSize int) <-chan GenotypeNode {
+// Replicated sequences are sent in the same order as the given pathogens.
+func MultinomialReplication(r *rand.Rand, pathogens []GenotypeNode, normedFitnesses []float64, newPopSize int) <-chan GenotypeNode {
 	c := make(chan GenotypeNode)
-	var wg sync.WaitGroup
-	wg.Add(len(pathogens))
-	for i, count := range rv.MultinomialA(newPopSize, normedFitnesses) {
-		go func(i, count int, wg *sync.WaitGroup) {
-			defer wg.Done()
+	counts := multinomial(r, newPopSize, normedFitnesses)
+	go func() {
+		for i, count := range counts {
 			for x := 0; x < count; x++ {
 				c <- pathogens[i]
 			}
-		}(i, count, &wg)
-	}
-	go func() {
-		wg.Wait()
+		}
 		close(c)
 	}()
 	return c
@@ -31,21 +25,25 @@ func MultinomialReplication(pathogens []GenotypeNode, normedFitnesses []float64,
 
 // IntrinsicRateReplication replicates pathogens by considering their
 // fitness value as the growth rate.
-func IntrinsicRateReplication(pathogens []GenotypeNode, replFitness []float64, immuneSystem interface{}) <-chan GenotypeNode {
+// Replicated sequences are sent in the same order as the given pathogens.
+// If immuneSystem is not nil, the growth rate of each pathogen is reduced
+// by the protection of the immune system against its sequence.
+func IntrinsicRateReplication(r *rand.Rand, pathogens []GenotypeNode, replFitness []float64, immuneSystem ImmuneSystem) <-chan GenotypeNode {
 	c := make(chan GenotypeNode)
-	var wg sync.WaitGroup
-	wg.Add(len(pathogens))
+	growthRates := make([]int, len(pathogens))
 	for i, pathogen := range pathogens {
-		go func(pathogen GenotypeNode, fitness float64, wg *sync.WaitGroup) {
-			defer wg.Done()
-			growthRate := rv.Poisson(fitness)
-			for i := 0; i < growthRate; i++ {
-				c <- pathogen
-			}
-		}(pathogen, replFitness[i], &wg)
+		rate := replFitness[i]
+		if immuneSystem != nil {
+			rate *= 1 - immuneSystem.Protection(pathogen.Sequence())
+		}
+		growthRates[i] = poisson(r, rate)
 	}
 	go func() {
-		wg.Wait()
+		for i, pathogen := range pathogens {
+			for x := 0; x < growthRates[i]; x++ {
+				c <- pathogen
+			}
+		}
 		close(c)
 	}()
 	return c
@@ -53,9 +51,9 @@ func IntrinsicRateReplication(pathogens []GenotypeNode, replFitness []float64, i
 
 // MutateSite returns the new state of a site based on the
 // given a set of transition probabilities.
-func MutateSite(transitionProbs ...float64) uint8 {
+func MutateSite(r *rand.Rand, transitionProbs ...float64) uint8 {
 	// Get new state
-	for i, v := range rv.Multinomial(1, transitionProbs) {
+	for i, v := range multinomial(r, 1, transitionProbs) {
 		if v == 1 {
 			return uint8(i)
 		}
@@ -64,13 +62,15 @@ func MutateSite(transitionProbs ...float64) uint8 {
 }
 
 // MutateSequence adds substitution mutations to sequenceNode.
-func MutateSequence(sequences <-chan GenotypeNode, tree GenotypeTree, model IntrahostModel) (<-chan GenotypeNode, <-chan GenotypeNode) {
+// Each sequence uses its own random number stream derived from r
+// in the order the sequences are received.
+func MutateSequence(r *rand.Rand, sequences <-chan GenotypeNode, tree GenotypeTree, model IntrahostModel) (<-chan GenotypeNode, <-chan GenotypeNode) {
 	c := make(chan GenotypeNode) // all the sequences, whether mutated or untouched
 	d := make(chan GenotypeNode) // new mutants
 	var wg sync.WaitGroup
 	for sequence := range sequences {
 		wg.Add(1)
-		go func(n GenotypeNode, model IntrahostModel, wg *sync.WaitGroup) {
+		go func(n GenotypeNode, model IntrahostModel, r *rand.Rand, wg *sync.WaitGroup) {
 			defer wg.Done()
 			mu := model.MutationRate()
 			// Copy sequence to make changes atomic
@@ -79,35 +79,45 @@ func MutateSequence(sequences <-chan GenotypeNode, tree GenotypeTree, model Intr
 			// Add mutations by state to account for unequal rates
 			totalHits := 0
 			if mu > 0 {
-				for state, numSites := range n.StateCounts() {
+				// Iterate over states in order to draw random numbers
+				// in the same sequence every time
+				stateCounts := n.StateCounts()
+				states := make([]int, 0, len(stateCounts))
+				for state := range stateCounts {
+					states = append(states, int(state))
+				}
+				sort.Ints(states)
+				for _, s := range states {
+					state := uint8(s)
+					numSites := stateCounts[state]
 					probs := model.TransitionProbs(int(state))
 					// Expected number of mutations over the entire sequence
 					nmu := float64(numSites) * mu
 					// Get number of hits in the sequence
 					var hits int
 					if nmu < 1.0 {
-						hits = rv.Poisson(nmu)
+						hits = poisson(r, nmu)
 					} else {
-						hits = rv.Binomial(numSites, mu)
+						hits = binomial(r, numSites, mu)
 					}
 					// Get position of hits
 					// Returns empty list if hits == 0
-					hitPositions := pickSites(hits, numSites, n.StatePositions(state))
+					hitPositions := pickSites(r, hits, numSites, n.StatePositions(state))
 					// Create new node per hit
 					for _, pos := range hitPositions {
-						sequence[pos] = MutateSite(probs...)
+						sequence[pos] = MutateSite(r, probs...)
 					}
 					totalHits += hits
 				}
 			}
 			if totalHits > 0 {
-				newNode := tree.NewNode(sequence, totalHits, n)
+				newNode := tree.NewNode(newNodeUID(r), sequence, totalHits, n)
 				c <- newNode
 				d <- newNode
 			} else {
 				c <- n
 			}
-		}(sequence, model, &wg)
+		}(sequence, model, NewRand(r.Int63()), &wg)
 	}
 	go func() {
 		wg.Wait()
@@ -119,7 +129,7 @@ func MutateSequence(sequences <-chan GenotypeNode, tree GenotypeTree, model Intr
 
 // RecombineSequencePairs recombines two sequences at random positions
 // similar to the behavior of diploid chromosomes.
-func RecombineSequencePairs(numSeqs, numRecSites int, sequences <-chan GenotypeNode, tree GenotypeTree, model IntrahostModel) (<-chan GenotypeNode, <-chan GenotypeNode) {
+func RecombineSequencePairs(r *rand.Rand, numSeqs, numRecSites int, sequences <-chan GenotypeNode, tree GenotypeTree, model IntrahostModel) (<-chan GenotypeNode, <-chan GenotypeNode) {
 	c := make(chan GenotypeNode) // all sequences regardless whether it recombined or not
 	d := make(chan GenotypeNode) // only sequences that recombined
 
@@ -130,7 +140,7 @@ func RecombineSequencePairs(numSeqs, numRecSites int, sequences <-chan GenotypeN
 
 	// permute and determine pairs
 	// if odd, the last 3 sequences form a triad
-	permIdx := rand.Perm(numSeqs)
+	permIdx := r.Perm(numSeqs)
 	seqGroupLookup := make(map[int]int)      // key is order of sequence in channel, value is the pair ID it belongs to
 	seqGroup := make(map[int][]GenotypeNode) // key is the pair ID, values are list of genotype nodes
 	seqTriadID := -1                         // is not negative if a triad exists
@@ -158,7 +168,8 @@ func RecombineSequencePairs(numSeqs, numRecSites int, sequences <-chan GenotypeN
 		case len(seqGroup[groupID]) == 2 && (groupID != seqTriadID):
 			fallthrough
 		case len(seqGroup[groupID]) == 3 && (groupID == seqTriadID):
-			go func(rate float64, numRecSites int, wg *sync.WaitGroup, seqs ...GenotypeNode) {
+			wg.Add(1)
+			go func(rate float64, numRecSites int, r *rand.Rand, wg *sync.WaitGroup, seqs ...GenotypeNode) {
 				defer wg.Done()
 				// assumes all sequences have the same length
 				// which may not be true if indels are implemented in the future
@@ -166,9 +177,9 @@ func RecombineSequencePairs(numSeqs, numRecSites int, sequences <-chan GenotypeN
 				nrate := float64(numRecSites) * rate
 				var hits int
 				if nrate < 1/float64(numRecSites) {
-					hits = rv.Poisson(nrate)
+					hits = poisson(r, nrate)
 				} else {
-					hits = rv.Binomial(numRecSites, rate)
+					hits = binomial(r, numRecSites, rate)
 				}
 
 				// Create empty sequences
@@ -183,7 +194,7 @@ func RecombineSequencePairs(numSeqs, numRecSites int, sequences <-chan GenotypeN
 				for i := 0; i < numRecSites; i++ {
 					hittablePositions[i] = i
 				}
-				hitPositions := pickSites(hits, numRecSites, hittablePositions)
+				hitPositions := pickSites(r, hits, numRecSites, hittablePositions)
 				prevOrder := 0
 				prevPos := 0
 				if hitPositions[len(hitPositions)-1] < numRecSites-1 {
@@ -197,7 +208,7 @@ func RecombineSequencePairs(numSeqs, numRecSites int, sequences <-chan GenotypeN
 							idx0, idx1, idx2 = 0, 1, 2
 						} else {
 							if prevOrder == 0 { // 0, 1, 2
-								if r := rand.Intn(2); r == 0 {
+								if r.Intn(2) == 0 {
 									idx0, idx1, idx2 = 1, 2, 0
 									prevOrder = 1
 								} else {
@@ -205,7 +216,7 @@ func RecombineSequencePairs(numSeqs, numRecSites int, sequences <-chan GenotypeN
 									prevOrder = 2
 								}
 							} else if prevOrder == 1 { // 1, 2, 0
-								if r := rand.Intn(2); r == 0 {
+								if r.Intn(2) == 0 {
 									idx0, idx1, idx2 = 0, 1, 2
 									prevOrder = 0
 								} else {
@@ -213,7 +224,7 @@ func RecombineSequencePairs(numSeqs, numRecSites int, sequences <-chan GenotypeN
 									prevOrder = 2
 								}
 							} else if prevOrder == 2 { // 2, 0, 1
-								if r := rand.Intn(2); r == 0 {
+								if r.Intn(2) == 0 {
 									idx0, idx1, idx2 = 1, 2, 0
 									prevOrder = 1
 								} else {
@@ -241,7 +252,7 @@ func RecombineSequencePairs(numSeqs, numRecSites int, sequences <-chan GenotypeN
 
 				if totalHits > 0 {
 					for _, recombinantSeq := range recombinantSeqs {
-						newNode := tree.NewRecombinantNode(recombinantSeq, totalHits, seqs...)
+						newNode := tree.NewRecombinantNode(newNodeUID(r), recombinantSeq, totalHits, seqs...)
 						c <- newNode
 						d <- newNode
 					}
@@ -250,7 +261,7 @@ func RecombineSequencePairs(numSeqs, numRecSites int, sequences <-chan GenotypeN
 						c <- n
 					}
 				}
-			}(rate, numRecSites, &wg, seqGroup[groupID]...)
+			}(rate, numRecSites, NewRand(r.Int63()), &wg, seqGroup[groupID]...)
 		}
 		x++
 	}
@@ -264,7 +275,7 @@ func RecombineSequencePairs(numSeqs, numRecSites int, sequences <-chan GenotypeN
 
 // RecombineAnySequence recombines any two sequences at a random position
 // similar to the behavior of template switching.
-func RecombineAnySequence(numSeqs, numRecSites int, sequences <-chan GenotypeNode, tree GenotypeTree, model IntrahostModel) (<-chan GenotypeNode, <-chan GenotypeNode) {
+func RecombineAnySequence(r *rand.Rand, numSeqs, numRecSites int, sequences <-chan GenotypeNode, tree GenotypeTree, model IntrahostModel) (<-chan GenotypeNode, <-chan GenotypeNode) {
 	c := make(chan GenotypeNode) // all sequences regardless whether it recombined or not
 	d := make(chan GenotypeNode) // only sequences that recombined
 
@@ -281,9 +292,9 @@ func RecombineAnySequence(numSeqs, numRecSites int, sequences <-chan GenotypeNod
 	rate := model.RecombinationRate()
 
 	var wg sync.WaitGroup
-	for x, node := range nodeMap {
+	for x := 0; x < len(nodeMap); x++ {
 		wg.Add(1)
-		go func(x int, node GenotypeNode, nodes map[int]GenotypeNode, rate float64, numRecSites int, wg *sync.WaitGroup) {
+		go func(x int, node GenotypeNode, nodes map[int]GenotypeNode, rate float64, numRecSites int, r *rand.Rand, wg *sync.WaitGroup) {
 			defer wg.Done()
 			// Return immediately if nodes only has one node
 			if len(nodes) == 1 {
@@ -295,9 +306,9 @@ func RecombineAnySequence(numSeqs, numRecSites int, sequences <-chan GenotypeNod
 			nrate := float64(numRecSites) * rate
 			var hits int
 			if nrate < 1/float64(numRecSites) {
-				hits = rv.Poisson(nrate)
+				hits = poisson(r, nrate)
 			} else {
-				hits = rv.Binomial(numRecSites, rate)
+				hits = binomial(r, numRecSites, rate)
 			}
 
 			// Create empty sequence
@@ -309,7 +320,7 @@ func RecombineAnySequence(numSeqs, numRecSites int, sequences <-chan GenotypeNod
 			for i := 0; i < numRecSites; i++ {
 				hittablePositions[i] = i
 			}
-			hitPositions := pickSites(hits, numRecSites, hittablePositions)
+			hitPositions := pickSites(r, hits, numRecSites, hittablePositions)
 			if hitPositions[len(hitPositions)-1] < numRecSites-1 {
 				hitPositions = append(hitPositions, numRecSites-1)
 			}
@@ -323,17 +334,15 @@ func RecombineAnySequence(numSeqs, numRecSites int, sequences <-chan GenotypeNod
 				repeatCount := 0
 				maxRepeat := 3
 				for repeat {
-					// iterate over the set of nodes until the selected node
+					// pick a random node until the selected node
 					// is not the previous node
-					for nodePos, node := range nodes {
-						if prevNodePos != nodePos {
-							copy(recombinantSeq[prevPos:pos], node.Sequence()[prevPos:pos])
-							prevNodePos = nodePos
-							repeat = false
-							parents = append(parents, node)
-							totalHits++
-							break
-						}
+					if nodePos := r.Intn(len(nodes)); prevNodePos != nodePos {
+						node := nodes[nodePos]
+						copy(recombinantSeq[prevPos:pos], node.Sequence()[prevPos:pos])
+						prevNodePos = nodePos
+						repeat = false
+						parents = append(parents, node)
+						totalHits++
 					}
 					if !repeat {
 						break
@@ -348,13 +357,13 @@ func RecombineAnySequence(numSeqs, numRecSites int, sequences <-chan GenotypeNod
 			}
 
 			if totalHits > 0 {
-				newNode := tree.NewRecombinantNode(recombinantSeq, totalHits, parents...)
+				newNode := tree.NewRecombinantNode(newNodeUID(r), recombinantSeq, totalHits, parents...)
 				c <- newNode
 				d <- newNode
 			} else {
 				c <- node
 			}
-		}(x, node, nodeMap, rate, numRecSites, &wg)
+		}(x, nodeMap[x], nodeMap, rate, numRecSites, NewRand(r.Int63()), &wg)
 	}
 	go func() {
 		wg.Wait()
@@ -387,7 +396,7 @@ func RecombineAnySequence(numSeqs, numRecSites int, sequences <-chan GenotypeNod
 // 	// Get number of hits in the sequence
 // 	var hits int
 // 	if nrate < 1/float64(numSites) {
-// 		hits = rv.Poisson(nrate)
+// 		hits = poisson(r, nrate)
 // 	} else {
 // 		hits = rv.Binomial(numSites, rate)
 // 	}
@@ -437,7 +446,7 @@ func RecombineAnySequence(numSeqs, numRecSites int, sequences <-chan GenotypeNod
 // 	return c, d
 // }
 
-func pickSites(hitsNeeded, numSites int, positions []int) []int {
+func pickSites(r *rand.Rand, hitsNeeded, numSites int, positions []int) []int {
 	if hitsNeeded == 0 {
 		return []int{}
 	}
@@ -447,7 +456,7 @@ func pickSites(hitsNeeded, numSites int, positions []int) []int {
 	// Get position of hits
 	hitPositions := make([]int, hitsNeeded)
 	for i := 0; i < hitsNeeded; i++ {
-		x := rand.Intn(numSites - i)
+		x := r.Intn(numSites - i)
 		hitPositions[i] = hittable[x]
 		hittable = append(hittable[:x], hittable[x+1:]...)
 	}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"math"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -227,11 +228,196 @@ func LoadFitnessMatrix(path string, valueType string) (map[int]map[uint8]float64
 	return m, nil
 }
 
+// LoadMotifModel parses the motifs encoded in the text file at the given
+// path and creates a new additive motif model.
+func LoadMotifModel(id int, name, path string) (MotifModel, error) {
+	/*
+		Format:
+
+		# This is a comment
+		# Any line starting with a # is skipped
+		default -> 1.0
+		0:1 -> 0.5
+		3:0 7:1 -> 0.2
+		0:1 3:0 7:1 -> -0.4
+
+		Each motif line lists the sites of the motif as pos:state pairs,
+		where state is the integer code of the character, followed by the
+		value added to the fitness of sequences that carry the motif.
+		Motifs may share sites, such that the last motif above is an
+		epistatic term for sequences that carry both of the first two.
+		The default line sets the fitness of sequences without any motif
+		and is 0 if omitted. Values are in decimal form.
+	*/
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(FileOpenError(err), "loading motifs failed")
+	}
+	defer f.Close()
+	reSite := regexp.MustCompile(`^(\d+):(\d+)$`)
+	m := EmptyMotifModel(id, name)
+	scanner := bufio.NewScanner(f)
+	i := 0
+	for scanner.Scan() {
+		i++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			// ignore blank and comment lines
+			continue
+		}
+		splittedLine := strings.Split(line, "->")
+		if len(splittedLine) != 2 {
+			err := fmt.Errorf("missing -> delimiter")
+			return nil, FileParsingError(err, i)
+		}
+		prefix, valueStr := strings.TrimSpace(splittedLine[0]), strings.TrimSpace(splittedLine[1])
+		v, err := strconv.ParseFloat(valueStr, 64)
+		if err != nil {
+			return nil, FileParsingError(err, i)
+		}
+		if prefix == "default" {
+			m.SetDefaultFitness(v)
+			continue
+		}
+		var sequence []uint8
+		var pos []int
+		for _, site := range strings.Fields(prefix) {
+			res := reSite.FindStringSubmatch(site)
+			if len(res) == 0 {
+				err := fmt.Errorf("motif site must be formatted as pos:state, got %s", site)
+				return nil, FileParsingError(err, i)
+			}
+			p, _ := strconv.Atoi(res[1])
+			state, err := strconv.ParseUint(res[2], 10, 8)
+			if err != nil {
+				return nil, FileParsingError(err, i)
+			}
+			pos = append(pos, p)
+			sequence = append(sequence, uint8(state))
+		}
+		err = m.AddMotif(sequence, pos, v)
+		if err != nil {
+			return nil, FileParsingError(err, i)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "loading motifs failed")
+	}
+	return m, nil
+}
+
+// LoadEpistasisMatrix loads the site fields and pairwise couplings of an
+// epistasis fitness model from a sparse text file.
+func LoadEpistasisMatrix(path string) (fields map[int]map[uint8]float64, couplings map[[2]int]map[[2]uint8]float64, err error) {
+	/*
+		Format:
+
+		# This is a comment
+		# Any line starting with a # is skipped
+		h 0 1 -0.2
+		h 3 0 0.1
+		J 0 3 1 0 0.5
+		J 3 7 2 2 -1.5
+
+		Field lines start with h followed by the position, the integer
+		code of the character, and the value added to the log fitness of
+		sequences with that character at that position. Coupling lines
+		start with J followed by the two positions, the characters at the
+		first and second positions, and the value added to the log fitness
+		of sequences with both characters. Terms that are not listed are 0.
+		Values are in log form.
+	*/
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, errors.Wrap(FileOpenError(err), "loading epistasis matrix failed")
+	}
+	defer f.Close()
+	fields = make(map[int]map[uint8]float64)
+	couplings = make(map[[2]int]map[[2]uint8]float64)
+	scanner := bufio.NewScanner(f)
+	i := 0
+	for scanner.Scan() {
+		i++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			// ignore blank and comment lines
+			continue
+		}
+		splittedLine := strings.Fields(line)
+		var numInts int
+		switch splittedLine[0] {
+		case "h":
+			numInts = 2
+		case "J":
+			numInts = 4
+		default:
+			err := fmt.Errorf("line must start with h or J, got %s", splittedLine[0])
+			return nil, nil, FileParsingError(err, i)
+		}
+		if len(splittedLine) != numInts+2 {
+			err := fmt.Errorf("expected %d values after %s, got %d", numInts+1, splittedLine[0], len(splittedLine)-1)
+			return nil, nil, FileParsingError(err, i)
+		}
+		// Positions come first followed by the characters
+		ints := make([]int, numInts)
+		for k, str := range splittedLine[1 : numInts+1] {
+			var n uint64
+			if k < numInts/2 {
+				n, err = strconv.ParseUint(str, 10, 32)
+			} else {
+				n, err = strconv.ParseUint(str, 10, 8)
+			}
+			if err != nil {
+				return nil, nil, FileParsingError(err, i)
+			}
+			ints[k] = int(n)
+		}
+		v, err := strconv.ParseFloat(splittedLine[numInts+1], 64)
+		if err != nil {
+			return nil, nil, FileParsingError(err, i)
+		}
+		if numInts == 2 {
+			pos, state := ints[0], uint8(ints[1])
+			if _, exists := fields[pos]; !exists {
+				fields[pos] = make(map[uint8]float64)
+			}
+			if _, exists := fields[pos][state]; exists {
+				err := fmt.Errorf("duplicate field for state %d at position %d", state, pos)
+				return nil, nil, FileParsingError(err, i)
+			}
+			fields[pos][state] = v
+			continue
+		}
+		// Store pairs with the lower position first
+		pair := [2]int{ints[0], ints[1]}
+		states := [2]uint8{uint8(ints[2]), uint8(ints[3])}
+		if pair[0] == pair[1] {
+			err := fmt.Errorf("cannot couple position %d with itself", pair[0])
+			return nil, nil, FileParsingError(err, i)
+		} else if pair[0] > pair[1] {
+			pair = [2]int{pair[1], pair[0]}
+			states = [2]uint8{states[1], states[0]}
+		}
+		if _, exists := couplings[pair]; !exists {
+			couplings[pair] = make(map[[2]uint8]float64)
+		}
+		if _, exists := couplings[pair][states]; exists {
+			err := fmt.Errorf("duplicate coupling for states %d and %d at positions %d and %d", states[0], states[1], pair[0], pair[1])
+			return nil, nil, FileParsingError(err, i)
+		}
+		couplings[pair][states] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, errors.Wrap(err, "loading epistasis matrix failed")
+	}
+	return fields, couplings, nil
+}
+
 // LoadAdjacencyMatrix creates a new 2D mapping based on a text file.
 func LoadAdjacencyMatrix(path string) (HostNetwork, error) {
 	/*
 		Parses text file for connection information between hosts.
-		Ignores lines that starts with #.
+		Ignores blank lines and lines that starts with #.
 		The text file should be formatted as follows for every line:
 
 			from_uid<int>    to_uid<int>    weight<float64>
@@ -241,60 +427,136 @@ func LoadAdjacencyMatrix(path string) (HostNetwork, error) {
 		specified by the given UIDs.
 
 		If weight is missing, sets a weight of -1.0 to show that the weight
-		not specified.
+		not specified. Any other line that cannot be parsed returns an error
+		with its line number.
 
 		If the edge is undirected, two declarations are expected per source-
 		recepient pair: one in the forward direction and the other in the
 		reverse direction.
 
+		Files ending in .gz are decompressed. See LoadHostNetwork for other
+		file formats.
+
+	*/
+	return LoadHostNetwork(path, AdjacencyNetworkFormat)
+}
+
+// LoadTemporalEdgeList creates a TemporalNetwork based on a text file
+// where each connection is present for a range of generations.
+func LoadTemporalEdgeList(path string) (TemporalNetwork, error) {
+	/*
+		Parses text file for connection information between hosts.
+		Ignores lines that starts with #.
+		The text file should be formatted as follows for every line:
+
+			from_uid<int>    to_uid<int>    weight<float64>    start_gen<int>    end_gen<int>
+
+		The connection is present from start_gen up to and including
+		end_gen. If end_gen is -1, the connection is present until the
+		end of the simulation.
+
+		Like LoadAdjacencyMatrix, connections are directed so two
+		declarations are expected for undirected edges.
 	*/
 	f, err := os.Open(path)
-	defer f.Close()
 	if err != nil {
-		log.Fatal(err)
+		return nil, errors.Wrap(FileOpenError(err), "loading temporal network failed")
 	}
-	m := make(adjacencyMatrix)
-	re := regexp.MustCompile(`(\d+)\s+(\d+)\s+(\d*\.?\d+)`)
+	defer f.Close()
+	var edges []temporalEdge
+	re := regexp.MustCompile(`^\s*(\d+)\s+(\d+)\s+(\d*\.?\d+)\s+(\d+)\s+(-?\d+)`)
 	scanner := bufio.NewScanner(f)
 	i := 0
 	for scanner.Scan() {
 		i++
 		line := scanner.Text()
-		if strings.HasPrefix(line, "#") {
-			// ignore comment lines
+		if strings.HasPrefix(line, "#") || len(strings.TrimSpace(line)) == 0 {
+			// ignore comment and blank lines
 			continue
 		}
 		res := re.FindStringSubmatch(line)
 		if len(res) == 0 {
+			err := fmt.Errorf("temporal edge list entry must have 5 values (source and destination IDs, connection weight, start and end generations)")
+			return nil, FileParsingError(err, i)
+		}
+		var e temporalEdge
+		e.from, _ = strconv.Atoi(res[1])
+		e.to, _ = strconv.Atoi(res[2])
+		e.weight, err = strconv.ParseFloat(res[3], 64)
+		if err != nil {
+			return nil, FileParsingError(err, i)
+		}
+		e.start, _ = strconv.Atoi(res[4])
+		e.end, err = strconv.Atoi(res[5])
+		if err != nil {
+			return nil, FileParsingError(err, i)
+		}
+		if e.end >= 0 && e.end < e.start {
+			err := fmt.Errorf("end generation %d is less than the start generation %d", e.end, e.start)
+			return nil, FileParsingError(err, i)
+		}
+		if e.end < -1 {
+			err := fmt.Errorf("end generation must be -1 or greater than or equal to the start generation: %d", e.end)
+			return nil, FileParsingError(err, i)
+		}
+		edges = append(edges, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "loading temporal network failed")
+	}
+	return newTemporalEdgeList(edges), nil
+}
+
+// LoadPatches parses a text file that assigns each host to a patch.
+// Returns a map where the key is the host ID and the value is the
+// patch ID of the host.
+func LoadPatches(path string) (map[int]int, error) {
+	/*
+		Parses text file for the patch of every host.
+		Ignores blank lines and lines that starts with #.
+		The text file should be formatted as follows for every line:
+
+			host_uid<int>    patch_uid<int>
+
+		Each host can only be assigned to one patch.
+	*/
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(FileOpenError(err), "loading patches failed")
+	}
+	defer f.Close()
+	patches := make(map[int]int)
+	scanner := bufio.NewScanner(f)
+	i := 0
+	for scanner.Scan() {
+		i++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			// ignore blank and comment lines
 			continue
 		}
-		if len(res) < 3 {
-			err := fmt.Errorf("adjacency list entry must have 2 values (source and destination IDs) or 3 values (source and destination IDs, connection weight)")
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			err := fmt.Errorf("patch entry must have 2 values (host and patch IDs)")
 			return nil, FileParsingError(err, i)
 		}
-		a, err := strconv.Atoi(res[1])
+		hostID, err := strconv.Atoi(fields[0])
 		if err != nil {
 			return nil, FileParsingError(err, i)
 		}
-		b, err := strconv.Atoi(res[2])
+		patchID, err := strconv.Atoi(fields[1])
 		if err != nil {
 			return nil, FileParsingError(err, i)
 		}
-		var wt float64
-		if len(res) == 4 {
-			wt, err = strconv.ParseFloat(res[3], 64)
-			if err != nil {
-				return nil, FileParsingError(err, i)
-			}
-			if wt < 0 {
-				return nil, InvalidConnectionWeightError(wt, i)
-			}
-		} else {
-			wt = -1.0
+		if _, exists := patches[hostID]; exists {
+			return nil, FileParsingError(IntKeyExists(hostID), i)
 		}
-		m.AddWeightedConnection(a, b, wt)
+		patches[hostID] = patchID
 	}
-	return m, nil
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "loading patches failed")
+	}
+	return patches, nil
 }
 
 // LoadEvoEpiConfig creates an EvoEpiConfig struct from a TOML file.
@@ -304,5 +566,9 @@ func LoadEvoEpiConfig(path string) (*EvoEpiConfig, error) {
 	if err != nil {
 		return &EvoEpiConfig{}, err
 	}
+	conf.path, err = filepath.Abs(path)
+	if err != nil {
+		return &EvoEpiConfig{}, err
+	}
 	return &conf, nil
 }
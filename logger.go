@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"database/sql"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -41,6 +44,14 @@ type DataLogger interface {
 	// WriteTransmission records the ID's of genotype node that
 	// are transmitted between hosts.
 	WriteTransmission(c <-chan TransmissionPackage)
+	// WriteInterventions records every action taken by an intervention.
+	WriteInterventions(c <-chan InterventionPackage)
+	// WriteDemography records every host that enters or leaves
+	// the population.
+	WriteDemography(c <-chan DemographyPackage)
+	// Truncate removes all records logged after the given generation.
+	// This is used to resume a simulation from a checkpoint.
+	Truncate(t int) error
 }
 
 // GenotypeFreqPackage encapsulates the data to be written everytime
@@ -83,6 +94,29 @@ type TransmissionPackage struct {
 	nodeID     ksuid.KSUID
 }
 
+// InterventionPackage encapsulates information to be written
+// every time an intervention acts on a host or a model.
+type InterventionPackage struct {
+	instanceID     int
+	genID          int
+	interventionID int
+	action         string
+	// hostID is -1 if the action does not target a particular host
+	hostID int
+	value  float64
+}
+
+// DemographyPackage encapsulates information to be written
+// every time a host is born, dies, immigrates or emigrates.
+type DemographyPackage struct {
+	instanceID int
+	genID      int
+	hostID     int
+	event      string
+	// status is the status of the host when the event happened
+	status int
+}
+
 // CSVLogger is a DataLogger that writes simulation data
 // as comma-delimited files.
 type CSVLogger struct {
@@ -92,6 +126,8 @@ type CSVLogger struct {
 	statusPath       string
 	transmissionPath string
 	mutationPath     string
+	interventionPath string
+	demographyPath   string
 }
 
 // NewCSVLogger creates a new logger that writes data into CSV files.
@@ -112,6 +148,8 @@ func (l *CSVLogger) SetBasePath(basepath string, i int) {
 	l.statusPath = strings.TrimSuffix(basepath, ".") + fmt.Sprintf(".%03d.%s.csv", i, "status")
 	l.transmissionPath = strings.TrimSuffix(basepath, ".") + fmt.Sprintf(".%03d.%s.csv", i, "trans")
 	l.mutationPath = strings.TrimSuffix(basepath, ".") + fmt.Sprintf(".%03d.%s.csv", i, "tree")
+	l.interventionPath = strings.TrimSuffix(basepath, ".") + fmt.Sprintf(".%03d.%s.csv", i, "intervention")
+	l.demographyPath = strings.TrimSuffix(basepath, ".") + fmt.Sprintf(".%03d.%s.csv", i, "demography")
 }
 
 // Init creates CSV files and writes header information for each file.
@@ -153,6 +191,14 @@ func (l *CSVLogger) Init() error {
 	if err != nil {
 		return err
 	}
+	err = newFile(l.interventionPath, "instance,generation,interventionID,action,hostID,value\n")
+	if err != nil {
+		return err
+	}
+	err = newFile(l.demographyPath, "instance,generation,hostID,event,status\n")
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -163,7 +209,7 @@ func (l *CSVLogger) WriteGenotypes(c <-chan Genotype) {
 	const template = "%s,%s\n"
 	var b bytes.Buffer
 	// b.WriteString("genotypeID,sequence\n")
-	for genotype := range c {
+	for _, genotype := range sortGenotypes(c) {
 		row := fmt.Sprintf(template,
 			genotype.GenotypeUID().String(),
 			genotype.StringSequence(),
@@ -185,7 +231,7 @@ func (l *CSVLogger) WriteGenotypeNodes(c <-chan GenotypeNode) {
 	const template = "%s,%s\n"
 	var b bytes.Buffer
 	// b.WriteString("nodeID,genotypeID\n")
-	for node := range c {
+	for _, node := range sortGenotypeNodes(c) {
 		row := fmt.Sprintf(template,
 			node.UID().String(),
 			node.GenotypeUID().String(),
@@ -207,7 +253,7 @@ func (l *CSVLogger) WriteGenotypeFreq(c <-chan GenotypeFreqPackage) {
 	const template = "%d,%d,%d,%s,%d\n"
 	var b bytes.Buffer
 	// b.WriteString("instance,generation,hostID,genotypeID,freq\n")
-	for pack := range c {
+	for _, pack := range sortGenotypeFreqs(c) {
 		row := fmt.Sprintf(template,
 			pack.instanceID,
 			pack.genID,
@@ -232,7 +278,7 @@ func (l *CSVLogger) WriteMutations(c <-chan MutationPackage) {
 	const template = "%d,%d,%d,%s,%s\n"
 	var b bytes.Buffer
 	// b.WriteString("instance,generation,hostID,parentNodeID,nodeID\n")
-	for pack := range c {
+	for _, pack := range sortMutations(c) {
 		row := fmt.Sprintf(template,
 			pack.instanceID,
 			pack.genID,
@@ -256,7 +302,7 @@ func (l *CSVLogger) WriteStatus(c <-chan StatusPackage) {
 	const template = "%d,%d,%d,%d\n"
 	var b bytes.Buffer
 	// b.WriteString("instance,generation,hostID,status\n")
-	for pack := range c {
+	for _, pack := range sortStatuses(c) {
 		row := fmt.Sprintf(template,
 			pack.instanceID,
 			pack.genID,
@@ -280,7 +326,7 @@ func (l *CSVLogger) WriteTransmission(c <-chan TransmissionPackage) {
 	const template = "%d,%d,%d,%d,%s\n"
 	var b bytes.Buffer
 	// b.WriteString("instance,generation,fromHostID,toHostID,nodeID\n")
-	for pack := range c {
+	for _, pack := range sortTransmissions(c) {
 		row := fmt.Sprintf(template,
 			pack.instanceID,
 			pack.genID,
@@ -297,6 +343,234 @@ func (l *CSVLogger) WriteTransmission(c <-chan TransmissionPackage) {
 	}
 }
 
+// WriteInterventions records every action taken by an intervention.
+func (l *CSVLogger) WriteInterventions(c <-chan InterventionPackage) {
+	// Format
+	// <instanceID>  <generation>  <interventionID>  <action>  <hostID>  <value>
+	const template = "%d,%d,%d,%s,%d,%s\n"
+	var b bytes.Buffer
+	for _, pack := range sortInterventions(c) {
+		row := fmt.Sprintf(template,
+			pack.instanceID,
+			pack.genID,
+			pack.interventionID,
+			pack.action,
+			pack.hostID,
+			strconv.FormatFloat(pack.value, 'g', -1, 64),
+		)
+		b.WriteString(row)
+	}
+	err := AppendToFile(l.interventionPath, b.Bytes())
+	if err != nil {
+		log.Panicf("%+v\n", err)
+	}
+}
+
+// WriteDemography records every host that enters or leaves
+// the population.
+func (l *CSVLogger) WriteDemography(c <-chan DemographyPackage) {
+	// Format
+	// <instanceID>  <generation>  <hostID>  <event>  <status>
+	const template = "%d,%d,%d,%s,%d\n"
+	var b bytes.Buffer
+	for _, pack := range sortDemography(c) {
+		row := fmt.Sprintf(template,
+			pack.instanceID,
+			pack.genID,
+			pack.hostID,
+			pack.event,
+			pack.status,
+		)
+		b.WriteString(row)
+	}
+	err := AppendToFile(l.demographyPath, b.Bytes())
+	if err != nil {
+		log.Panicf("%+v\n", err)
+	}
+}
+
+// Truncate removes all records logged after the given generation.
+// Genotypes and genotype nodes are only recorded at the end of the
+// simulation so these files are reset.
+func (l *CSVLogger) Truncate(t int) error {
+	for _, path := range []string{l.genotypeFreqPath, l.mutationPath, l.statusPath, l.transmissionPath, l.interventionPath, l.demographyPath} {
+		err := TruncateCSVFile(path, 1, t)
+		if err != nil {
+			return errors.Wrap(err, "truncating log failed")
+		}
+	}
+	for _, path := range []string{l.genotypePath, l.genotypeNodePath} {
+		err := TruncateCSVFile(path, -1, t)
+		if err != nil {
+			return errors.Wrap(err, "truncating log failed")
+		}
+	}
+	return nil
+}
+
+// TruncateCSVFile removes rows whose generation, found in the given column,
+// is greater than t. The header is always kept while incomplete rows are
+// removed. If col is negative, all rows except the header are removed.
+func TruncateCSVFile(path string, col, t int) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return FileOpenError(err)
+	}
+	lines := strings.SplitAfter(string(b), "\n")
+	var buf bytes.Buffer
+	for i, line := range lines {
+		if i == 0 {
+			buf.WriteString(line)
+			continue
+		}
+		if col < 0 || !strings.HasSuffix(line, "\n") {
+			break
+		}
+		row := strings.Split(line, ",")
+		if len(row) <= col {
+			continue
+		}
+		gen, err := strconv.Atoi(row[col])
+		if err != nil || gen > t {
+			continue
+		}
+		buf.WriteString(line)
+	}
+	err = ioutil.WriteFile(path, buf.Bytes(), 0644)
+	if err != nil {
+		return FileWriteError(err)
+	}
+	return nil
+}
+
+// The following functions collect the records sent over a channel and
+// sort them so that records are written in the same order regardless of
+// how goroutines were scheduled.
+
+func sortGenotypes(c <-chan Genotype) []Genotype {
+	var records []Genotype
+	for genotype := range c {
+		records = append(records, genotype)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return ksuid.Compare(records[i].GenotypeUID(), records[j].GenotypeUID()) < 0
+	})
+	return records
+}
+
+func sortGenotypeNodes(c <-chan GenotypeNode) []GenotypeNode {
+	var records []GenotypeNode
+	for node := range c {
+		records = append(records, node)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return ksuid.Compare(records[i].UID(), records[j].UID()) < 0
+	})
+	return records
+}
+
+func sortGenotypeFreqs(c <-chan GenotypeFreqPackage) []GenotypeFreqPackage {
+	var records []GenotypeFreqPackage
+	for pack := range c {
+		records = append(records, pack)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.genID != b.genID {
+			return a.genID < b.genID
+		} else if a.hostID != b.hostID {
+			return a.hostID < b.hostID
+		}
+		return ksuid.Compare(a.genotypeID, b.genotypeID) < 0
+	})
+	return records
+}
+
+func sortMutations(c <-chan MutationPackage) []MutationPackage {
+	var records []MutationPackage
+	for pack := range c {
+		records = append(records, pack)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.genID != b.genID {
+			return a.genID < b.genID
+		} else if a.hostID != b.hostID {
+			return a.hostID < b.hostID
+		} else if x := ksuid.Compare(a.nodeID, b.nodeID); x != 0 {
+			return x < 0
+		}
+		return ksuid.Compare(a.parentNodeID, b.parentNodeID) < 0
+	})
+	return records
+}
+
+func sortStatuses(c <-chan StatusPackage) []StatusPackage {
+	var records []StatusPackage
+	for pack := range c {
+		records = append(records, pack)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.genID != b.genID {
+			return a.genID < b.genID
+		}
+		return a.hostID < b.hostID
+	})
+	return records
+}
+
+func sortTransmissions(c <-chan TransmissionPackage) []TransmissionPackage {
+	var records []TransmissionPackage
+	for pack := range c {
+		records = append(records, pack)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.genID != b.genID {
+			return a.genID < b.genID
+		} else if a.fromHostID != b.fromHostID {
+			return a.fromHostID < b.fromHostID
+		} else if a.toHostID != b.toHostID {
+			return a.toHostID < b.toHostID
+		}
+		return ksuid.Compare(a.nodeID, b.nodeID) < 0
+	})
+	return records
+}
+
+func sortInterventions(c <-chan InterventionPackage) []InterventionPackage {
+	var records []InterventionPackage
+	for pack := range c {
+		records = append(records, pack)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.genID != b.genID {
+			return a.genID < b.genID
+		} else if a.interventionID != b.interventionID {
+			return a.interventionID < b.interventionID
+		}
+		return a.hostID < b.hostID
+	})
+	return records
+}
+
+func sortDemography(c <-chan DemographyPackage) []DemographyPackage {
+	var records []DemographyPackage
+	for pack := range c {
+		records = append(records, pack)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.genID != b.genID {
+			return a.genID < b.genID
+		}
+		return a.hostID < b.hostID
+	})
+	return records
+}
+
 // NewFile creates a new file on the given path if it does not exist.
 // Returns an error if the file exists.
 func NewFile(path string, b []byte) error {
@@ -342,6 +616,68 @@ func AppendToFile(path string, b []byte) error {
 	return nil
 }
 
+// NullLogger is a DataLogger that discards all records. It is used
+// when only the state of the simulation is needed and not its history,
+// such as when fitting parameters.
+type NullLogger struct{}
+
+// SetBasePath does nothing.
+func (l *NullLogger) SetBasePath(basepath string, i int) {}
+
+// Init does nothing.
+func (l *NullLogger) Init() error { return nil }
+
+// WriteGenotypes discards genotypes.
+func (l *NullLogger) WriteGenotypes(c <-chan Genotype) {
+	for range c {
+	}
+}
+
+// WriteGenotypeNodes discards genotype nodes.
+func (l *NullLogger) WriteGenotypeNodes(c <-chan GenotypeNode) {
+	for range c {
+	}
+}
+
+// WriteGenotypeFreq discards genotype frequencies.
+func (l *NullLogger) WriteGenotypeFreq(c <-chan GenotypeFreqPackage) {
+	for range c {
+	}
+}
+
+// WriteMutations discards mutations.
+func (l *NullLogger) WriteMutations(c <-chan MutationPackage) {
+	for range c {
+	}
+}
+
+// WriteStatus discards host statuses.
+func (l *NullLogger) WriteStatus(c <-chan StatusPackage) {
+	for range c {
+	}
+}
+
+// WriteTransmission discards transmission events.
+func (l *NullLogger) WriteTransmission(c <-chan TransmissionPackage) {
+	for range c {
+	}
+}
+
+// WriteInterventions discards intervention actions.
+func (l *NullLogger) WriteInterventions(c <-chan InterventionPackage) {
+	for range c {
+	}
+}
+
+// WriteDemography discards demographic events.
+func (l *NullLogger) WriteDemography(c <-chan DemographyPackage) {
+	for range c {
+	}
+}
+
+// Truncate does nothing.
+func (l *NullLogger) Truncate(t int) error { return nil }
+
 // SQLiteLogger is a DataLogger that writes simulation data
 // t0 SQLite databases. Each writer function writes to an independent SQLite
 // database and foreign keys are added to each database at the closing
@@ -353,6 +689,8 @@ type SQLiteLogger struct {
 	statusPath       string
 	transmissionPath string
 	mutationPath     string
+	interventionPath string
+	demographyPath   string
 	instanceID       int
 }
 
@@ -374,6 +712,8 @@ func (l *SQLiteLogger) SetBasePath(basepath string, i int) {
 	l.statusPath = strings.TrimSuffix(basepath, ".") + fmt.Sprintf(".%s.db", "status")
 	l.transmissionPath = strings.TrimSuffix(basepath, ".") + fmt.Sprintf(".%s.db", "trans")
 	l.mutationPath = strings.TrimSuffix(basepath, ".") + fmt.Sprintf(".%s.db", "tree")
+	l.interventionPath = strings.TrimSuffix(basepath, ".") + fmt.Sprintf(".%s.db", "intervention")
+	l.demographyPath = strings.TrimSuffix(basepath, ".") + fmt.Sprintf(".%s.db", "demography")
 
 	// set instance
 	l.instanceID = i
@@ -441,6 +781,18 @@ func (l *SQLiteLogger) Init() error {
 	if err != nil {
 		return errors.Wrapf(err, "creating %s table failed", tableName)
 	}
+
+	tableName = "Intervention"
+	err = newTable(l.interventionPath, tableName, "(id integer not null primary key, generation int, interventionID int, action text, hostID int, value real)")
+	if err != nil {
+		return errors.Wrapf(err, "creating %s table failed", tableName)
+	}
+
+	tableName = "Demography"
+	err = newTable(l.demographyPath, tableName, "(id integer not null primary key, generation int, hostID int, event text, status int)")
+	if err != nil {
+		return errors.Wrapf(err, "creating %s table failed", tableName)
+	}
 	return nil
 }
 
@@ -466,7 +818,7 @@ func (l *SQLiteLogger) WriteGenotypes(c <-chan Genotype) {
 		log.Panicf("%+v\n", err)
 	}
 	defer stmt.Close()
-	for genotype := range c {
+	for _, genotype := range sortGenotypes(c) {
 		_, err = stmt.Exec(
 			genotype.GenotypeUID().String(),
 			genotype.StringSequence(),
@@ -503,7 +855,7 @@ func (l *SQLiteLogger) WriteGenotypeNodes(c <-chan GenotypeNode) {
 		log.Panicf("%+v\n", err)
 	}
 	defer stmt.Close()
-	for node := range c {
+	for _, node := range sortGenotypeNodes(c) {
 		_, err = stmt.Exec(
 			node.UID().String(),
 			node.GenotypeUID().String(),
@@ -540,7 +892,7 @@ func (l *SQLiteLogger) WriteGenotypeFreq(c <-chan GenotypeFreqPackage) {
 		log.Panicf("%+v\n", err)
 	}
 	defer stmt.Close()
-	for pack := range c {
+	for _, pack := range sortGenotypeFreqs(c) {
 		_, err = stmt.Exec(
 			pack.genID,
 			pack.hostID,
@@ -579,7 +931,7 @@ func (l *SQLiteLogger) WriteMutations(c <-chan MutationPackage) {
 		log.Panicf("%+v\n", err)
 	}
 	defer stmt.Close()
-	for pack := range c {
+	for _, pack := range sortMutations(c) {
 		_, err = stmt.Exec(
 			pack.genID,
 			pack.hostID,
@@ -617,7 +969,7 @@ func (l *SQLiteLogger) WriteStatus(c <-chan StatusPackage) {
 		log.Panicf("%+v\n", err)
 	}
 	defer stmt.Close()
-	for pack := range c {
+	for _, pack := range sortStatuses(c) {
 		_, err = stmt.Exec(
 			pack.genID,
 			pack.hostID,
@@ -655,7 +1007,7 @@ func (l *SQLiteLogger) WriteTransmission(c <-chan TransmissionPackage) {
 		log.Panicf("%+v\n", err)
 	}
 	defer stmt.Close()
-	for pack := range c {
+	for _, pack := range sortTransmissions(c) {
 		_, err = stmt.Exec(
 			pack.genID,
 			pack.fromHostID,
@@ -671,6 +1023,140 @@ func (l *SQLiteLogger) WriteTransmission(c <-chan TransmissionPackage) {
 	tx.Commit()
 }
 
+// WriteInterventions records every action taken by an intervention.
+func (l *SQLiteLogger) WriteInterventions(c <-chan InterventionPackage) {
+	tableName := fmt.Sprintf("Intervention%03d", l.instanceID)
+	path := l.interventionPath
+	_stmt := "insert into " + tableName + "(generation, interventionID, action, hostID, value) values(?, ?, ?, ?, ?)"
+	// Database ops below
+	db, err := OpenSQLiteDBOptimized(path)
+	if err != nil {
+		log.Panicf("%+v\n", err)
+	}
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		err = SQLBeginTransactionError(err)
+		log.Panicf("%+v\n", err)
+	}
+	stmt, err := tx.Prepare(_stmt)
+	if err != nil {
+		err = SQLPrepareStatementError(err, _stmt)
+		log.Panicf("%+v\n", err)
+	}
+	defer stmt.Close()
+	for _, pack := range sortInterventions(c) {
+		_, err = stmt.Exec(
+			pack.genID,
+			pack.interventionID,
+			pack.action,
+			pack.hostID,
+			pack.value,
+		)
+		if err != nil {
+			err = SQLExecStatementError(err)
+			log.Panicf("%+v\n", err)
+		}
+	}
+	// Commit at the end
+	tx.Commit()
+}
+
+// WriteDemography records every host that enters or leaves
+// the population.
+func (l *SQLiteLogger) WriteDemography(c <-chan DemographyPackage) {
+	tableName := fmt.Sprintf("Demography%03d", l.instanceID)
+	path := l.demographyPath
+	_stmt := "insert into " + tableName + "(generation, hostID, event, status) values(?, ?, ?, ?)"
+	// Database ops below
+	db, err := OpenSQLiteDBOptimized(path)
+	if err != nil {
+		log.Panicf("%+v\n", err)
+	}
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		err = SQLBeginTransactionError(err)
+		log.Panicf("%+v\n", err)
+	}
+	stmt, err := tx.Prepare(_stmt)
+	if err != nil {
+		err = SQLPrepareStatementError(err, _stmt)
+		log.Panicf("%+v\n", err)
+	}
+	defer stmt.Close()
+	for _, pack := range sortDemography(c) {
+		_, err = stmt.Exec(
+			pack.genID,
+			pack.hostID,
+			pack.event,
+			pack.status,
+		)
+		if err != nil {
+			err = SQLExecStatementError(err)
+			log.Panicf("%+v\n", err)
+		}
+	}
+	// Commit at the end
+	tx.Commit()
+}
+
+// Truncate removes all records logged after the given generation.
+func (l *SQLiteLogger) Truncate(t int) error {
+	truncateTable := func(path, tableName string) error {
+		db, err := OpenSQLiteDBOptimized(path)
+		if err != nil {
+			return errors.Wrap(err, "Truncate failed")
+		}
+		defer db.Close()
+		fullTableName := fmt.Sprintf("%s%03d", tableName, l.instanceID)
+		sqlStmt := fmt.Sprintf("delete from %s where generation > %d;", fullTableName, t)
+		if tableName == "Genotype" || tableName == "Node" {
+			// Genotypes and nodes are only recorded at the end
+			sqlStmt = fmt.Sprintf("delete from %s;", fullTableName)
+		}
+		_, err = db.Exec(sqlStmt)
+		if err != nil {
+			return errors.Wrap(SQLExecError(err, sqlStmt), "Truncate failed")
+		}
+		return nil
+	}
+
+	err := truncateTable(l.genotypeFreqPath, "GenotypeFreq")
+	if err != nil {
+		return err
+	}
+	err = truncateTable(l.mutationPath, "Tree")
+	if err != nil {
+		return err
+	}
+	err = truncateTable(l.statusPath, "Status")
+	if err != nil {
+		return err
+	}
+	err = truncateTable(l.transmissionPath, "Transmission")
+	if err != nil {
+		return err
+	}
+	err = truncateTable(l.interventionPath, "Intervention")
+	if err != nil {
+		return err
+	}
+	err = truncateTable(l.demographyPath, "Demography")
+	if err != nil {
+		return err
+	}
+	err = truncateTable(l.genotypePath, "Genotype")
+	if err != nil {
+		return err
+	}
+	err = truncateTable(l.genotypeNodePath, "Node")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // OpenSQLiteDBOptimized establishes a database connection using WAL
 // and exclusive locking.
 func OpenSQLiteDBOptimized(path string) (*sql.DB, error) {
@@ -0,0 +1,194 @@
+package contagiongo
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// Metapopulation groups hosts into patches where hosts mix well.
+// Instead of transmitting to a fixed set of neighbors, an infected host
+// contacts hosts picked at random every generation. Contacts are made
+// within the host's own patch, or in another patch with probability equal
+// to the weight of the connection between the two patches in the
+// mobility network.
+type Metapopulation struct {
+	// ContactRate is the expected number of contacts made by an infected
+	// host in a generation.
+	ContactRate float64
+	patches     map[int]int
+	members     map[int][]int
+	moves       map[int][]patchMove
+}
+
+// patchMove is the probability that a contact is made
+// in a particular patch.
+type patchMove struct {
+	patch int
+	prob  float64
+}
+
+// NewMetapopulation creates a new metapopulation from the patch of each
+// host and the mobility network between patches. The weights of the
+// connections from a patch must add up to at most 1. The remaining
+// probability is the probability of making a contact within the patch.
+func NewMetapopulation(patches map[int]int, mobility HostNetwork, contactRate float64) (*Metapopulation, error) {
+	m := &Metapopulation{
+		ContactRate: contactRate,
+		patches:     make(map[int]int),
+		members:     make(map[int][]int),
+		moves:       make(map[int][]patchMove),
+	}
+	for hostID, patchID := range patches {
+		m.patches[hostID] = patchID
+		m.members[patchID] = append(m.members[patchID], hostID)
+	}
+	for _, ids := range m.members {
+		sort.Ints(ids)
+	}
+	for _, a := range mobility.HostIDs() {
+		if _, exists := m.members[a]; !exists {
+			return nil, fmt.Errorf("mobility from patch %d that has no hosts", a)
+		}
+		neighbors := mobility.GetNeighbors(a)
+		sort.Ints(neighbors)
+		var total float64
+		for _, b := range neighbors {
+			if _, exists := m.members[b]; !exists {
+				return nil, fmt.Errorf("mobility to patch %d that has no hosts", b)
+			}
+			w := mobility.Connection(a, b)
+			if w < 0 {
+				return nil, fmt.Errorf("mobility weight from patch %d to patch %d must be specified", a, b)
+			}
+			if a == b || w == 0 {
+				continue
+			}
+			m.moves[a] = append(m.moves[a], patchMove{b, w})
+			total += w
+		}
+		if total > 1 {
+			return nil, fmt.Errorf(InvalidFloatParameterError, fmt.Sprintf("total mobility weight from patch %d", a), total, "must be less than or equal to 1")
+		}
+	}
+	return m, nil
+}
+
+// Patch returns the patch of the host and whether the host
+// belongs to a patch.
+func (m *Metapopulation) Patch(id int) (int, bool) {
+	patchID, exists := m.patches[id]
+	return patchID, exists
+}
+
+// PatchHostIDs returns the sorted IDs of hosts in the patch.
+func (m *Metapopulation) PatchHostIDs(patchID int) []int {
+	return m.members[patchID]
+}
+
+// Contacts returns the hosts contacted by the host in a generation,
+// sorted by host ID. The number of contacts is Poisson-distributed with
+// mean ContactRate. Each contacted host is picked uniformly from the
+// patch where the contact is made, and hosts contacted more than once are
+// only returned once. Isolated hosts make no contacts and cannot be
+// contacted.
+func (m *Metapopulation) Contacts(r *rand.Rand, sim Epidemic, id int) []Host {
+	patchID, exists := m.patches[id]
+	if !exists || sim.HostIsolated(id) {
+		return nil
+	}
+	contacted := make(map[int]bool)
+	n := poisson(r, m.ContactRate)
+	for i := 0; i < n; i++ {
+		// Pick the patch where the contact is made
+		dest := patchID
+		x := r.Float64()
+		for _, move := range m.moves[patchID] {
+			if x < move.prob {
+				dest = move.patch
+				break
+			}
+			x -= move.prob
+		}
+		members := m.members[dest]
+		contactID := members[r.Intn(len(members))]
+		if contactID == id || sim.HostIsolated(contactID) || sim.Host(contactID) == nil {
+			continue
+		}
+		contacted[contactID] = true
+	}
+	contacts := make([]Host, 0, len(contacted))
+	for _, contactID := range sortedKeys(contacted) {
+		contacts = append(contacts, sim.Host(contactID))
+	}
+	return contacts
+}
+
+type metapopulationConfig struct {
+	PatchPath    string `toml:"patch_path"`    // host ID and patch ID per line
+	MobilityPath string `toml:"mobility_path"` // connections between patches
+	// MobilityFormat is the file format of mobility_path, using the same
+	// formats as host_network_format. If empty, the format is inferred
+	// from the file extension.
+	MobilityFormat string  `toml:"mobility_format"`
+	ContactRate    float64 `toml:"contact_rate"` // expected contacts per infected host per generation
+
+	validated bool
+}
+
+// Validate checks the validity of the metapopulation configuration.
+func (c *metapopulationConfig) Validate() error {
+	// Check PatchPath
+	exists, err := Exists(c.PatchPath)
+	if err != nil {
+		return FileExistsCheckError(err, c.PatchPath)
+	}
+	if !exists {
+		return FileDoesNotExistError(c.PatchPath)
+	}
+	// Check MobilityPath. Without mobility, contacts are only made
+	// within patches.
+	if len(c.MobilityPath) > 0 {
+		exists, err = Exists(c.MobilityPath)
+		if err != nil {
+			return FileExistsCheckError(err, c.MobilityPath)
+		}
+		if !exists {
+			return FileDoesNotExistError(c.MobilityPath)
+		}
+	}
+	if len(c.MobilityFormat) > 0 {
+		err = checkKeyword(c.MobilityFormat, "mobility_format",
+			AdjacencyNetworkFormat, CSVNetworkFormat,
+			GraphMLNetworkFormat, GMLNetworkFormat, PajekNetworkFormat,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if c.ContactRate < 0 {
+		return fmt.Errorf(InvalidFloatParameterError, "contact_rate", c.ContactRate, "must be greater than or equal to 0")
+	}
+	c.validated = true
+	return nil
+}
+
+// CreateMetapopulation loads the patches and the mobility network
+// and creates a new Metapopulation.
+func (c *metapopulationConfig) CreateMetapopulation() (*Metapopulation, error) {
+	if !c.validated {
+		return nil, fmt.Errorf("validate metapopulation parameters first")
+	}
+	patches, err := LoadPatches(c.PatchPath)
+	if err != nil {
+		return nil, err
+	}
+	mobility := EmptyAdjacencyMatrix()
+	if len(c.MobilityPath) > 0 {
+		mobility, err = LoadHostNetwork(c.MobilityPath, c.MobilityFormat)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewMetapopulation(patches, mobility, c.ContactRate)
+}
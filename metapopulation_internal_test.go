@@ -0,0 +1,48 @@
+package contagiongo
+
+import "testing"
+
+func TestMetapopulation_Contacts(t *testing.T) {
+	sim := new(SequenceNodeEpidemic)
+	sim.hosts = make(map[int]Host)
+	patches := make(map[int]int)
+	for i := 0; i < 20; i++ {
+		sim.hosts[i] = EmptySequenceHost(i)
+		patches[i] = i % 2
+	}
+	sim.setHostNetwork(EmptyAdjacencyMatrix())
+	mobility := EmptyAdjacencyMatrix()
+	mobility.AddWeightedConnection(0, 1, 0.6)
+	mobility.AddWeightedConnection(1, 0, 0.6)
+	mobility.AddWeightedConnection(1, 1, 0.6)
+	if _, err := NewMetapopulation(patches, mobility, 5); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	mobility.AddWeightedConnection(1, 2, 0.6)
+	if _, err := NewMetapopulation(patches, mobility, 5); err == nil {
+		t.Errorf("expected error for mobility to a patch without hosts")
+	}
+	mobility.DeleteConnection(1, 2)
+	mobility.UpdateConnectionWeight(1, 0, 1.2)
+	if _, err := NewMetapopulation(patches, mobility, 5); err == nil {
+		t.Errorf("expected error for total mobility weight greater than 1")
+	}
+
+	// Without mobility, contacts are only made within the patch
+	m, err := NewMetapopulation(patches, EmptyAdjacencyMatrix(), 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r := NewRand(0)
+	for i := 0; i < 100; i++ {
+		for _, host := range m.Contacts(r, sim, 0) {
+			if patchID, _ := m.Patch(host.ID()); patchID != 0 || host.ID() == 0 {
+				t.Errorf("expected host 0 to only contact other hosts in patch 0, contacted host %d in patch %d", host.ID(), patchID)
+			}
+		}
+	}
+	sim.SetHostIsolated(0, true)
+	if contacts := m.Contacts(r, sim, 0); len(contacts) > 0 {
+		t.Errorf(UnequalIntParameterError, "number of contacts of an isolated host", 0, len(contacts))
+	}
+}
@@ -3,6 +3,7 @@ package contagiongo
 import (
 	"bytes"
 	"fmt"
+	"sort"
 )
 
 // HostNetwork interface describes a host population connected together as
@@ -10,6 +11,9 @@ import (
 type HostNetwork interface {
 	// ConnectedPopSize returns the total number of hosts in the network.
 	ConnectedPopSize() int
+	// HostIDs returns the sorted list of hosts that have at least one
+	// connection.
+	HostIDs() []int
 	// GetNeighbors retrieves the unordered list of neighbors from
 	// the adjacency matrix.
 	GetNeighbors(ID int) (neighbors []int)
@@ -37,6 +41,8 @@ type HostNetwork interface {
 
 	// DeleteConnection removes a one way connection a-b.
 	DeleteConnection(a, b int) error
+	// DeleteHost removes all connections to and from the host.
+	DeleteHost(ID int)
 
 	// Copy returns a new copy of the adjacency matrix.
 	// Changes made to the original copy will not affect the new copy
@@ -66,6 +72,22 @@ func (m adjacencyMatrix) ConnectedPopSize() int {
 	return len(hostIdsSet)
 }
 
+func (m adjacencyMatrix) HostIDs() []int {
+	hostIdsSet := make(map[int]bool)
+	for i, hosts := range m {
+		hostIdsSet[i] = true
+		for j := range hosts {
+			hostIdsSet[j] = true
+		}
+	}
+	ids := make([]int, 0, len(hostIdsSet))
+	for id := range hostIdsSet {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
 func (m adjacencyMatrix) GetNeighbors(ID int) (neighbors []int) {
 	for j := range m[ID] {
 		neighbors = append(neighbors, j)
@@ -126,6 +148,13 @@ func (m adjacencyMatrix) DeleteConnection(a, b int) error {
 	return nil
 }
 
+func (m adjacencyMatrix) DeleteHost(ID int) {
+	delete(m, ID)
+	for i := range m {
+		delete(m[i], ID)
+	}
+}
+
 func (m adjacencyMatrix) Copy() adjacencyMatrix {
 	n := make(adjacencyMatrix)
 	for i, nbrs := range m {
@@ -249,6 +278,13 @@ func EmptyAdjacencyMatrix() HostNetwork {
 	return m
 }
 
+// WriteAdjacencyMatrix writes the connections of the network to a text
+// file that can be read using LoadAdjacencyMatrix. Each line contains the
+// source and destination host IDs and the connection weight.
+func WriteAdjacencyMatrix(path string, m HostNetwork) error {
+	return WriteHostNetwork(path, AdjacencyNetworkFormat, m)
+}
+
 // // GNPAdjacencyMatrix generates an Erdos-Renyi graph using the given number
 // // of nodes n, probability p and a seed integer.
 // func GNPAdjacencyMatrix(n int, p float64, seed int64) adjacencyMatrix {
@@ -0,0 +1,747 @@
+package contagiongo
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// The following are keywords for the file formats of host networks.
+const (
+	// AdjacencyNetworkFormat is a whitespace-separated list of
+	// from, to and weight columns.
+	AdjacencyNetworkFormat = "adjacency"
+	// CSVNetworkFormat is a comma-separated edge list with a header.
+	CSVNetworkFormat = "csv"
+	// GraphMLNetworkFormat is the XML-based GraphML format.
+	GraphMLNetworkFormat = "graphml"
+	// GMLNetworkFormat is the Graph Modelling Language format.
+	GMLNetworkFormat = "gml"
+	// PajekNetworkFormat is the Pajek .net format.
+	PajekNetworkFormat = "pajek"
+)
+
+// NetworkFormat returns the host network format implied by the extension
+// of the path. A .gz extension is ignored. Files with an unknown extension
+// are assumed to be adjacency lists.
+func NetworkFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(strings.TrimSuffix(path, ".gz"))) {
+	case ".csv":
+		return CSVNetworkFormat
+	case ".graphml":
+		return GraphMLNetworkFormat
+	case ".gml":
+		return GMLNetworkFormat
+	case ".net":
+		return PajekNetworkFormat
+	}
+	return AdjacencyNetworkFormat
+}
+
+// LoadHostNetwork creates a HostNetwork from a file in the given format.
+// If format is empty, the format is inferred from the file extension.
+// Files ending in .gz are decompressed. In every format, connections
+// without a weight have a weight of -1, which means that the weight is
+// unspecified and the transmission probability of the model is used.
+func LoadHostNetwork(path, format string) (HostNetwork, error) {
+	if format == "" {
+		format = NetworkFormat(path)
+	}
+	f, err := openNetworkFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading host network failed")
+	}
+	defer f.Close()
+	var m HostNetwork
+	switch strings.ToLower(format) {
+	case AdjacencyNetworkFormat:
+		m, err = parseAdjacencyList(f)
+	case CSVNetworkFormat:
+		m, err = parseCSVEdgeList(f)
+	case GraphMLNetworkFormat:
+		m, err = parseGraphML(f)
+	case GMLNetworkFormat:
+		m, err = parseGML(f)
+	case PajekNetworkFormat:
+		m, err = parsePajek(f)
+	default:
+		return nil, fmt.Errorf(UnrecognizedKeywordError, format, "host network format")
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading host network %s failed", path)
+	}
+	return m, nil
+}
+
+// WriteHostNetwork writes the connections of the network to a file in
+// the given format. If format is empty, the format is inferred from the
+// file extension. Files ending in .gz are compressed.
+func WriteHostNetwork(path, format string, m HostNetwork) error {
+	if format == "" {
+		format = NetworkFormat(path)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(FileOpenError(err), "writing host network failed")
+	}
+	defer f.Close()
+	var w io.Writer = f
+	var gz *gzip.Writer
+	if strings.HasSuffix(path, ".gz") {
+		gz = gzip.NewWriter(f)
+		w = gz
+	}
+	bw := bufio.NewWriter(w)
+	switch strings.ToLower(format) {
+	case AdjacencyNetworkFormat:
+		writeAdjacencyList(bw, m)
+	case CSVNetworkFormat:
+		writeCSVEdgeList(bw, m)
+	case GraphMLNetworkFormat:
+		writeGraphML(bw, m)
+	case GMLNetworkFormat:
+		writeGML(bw, m)
+	case PajekNetworkFormat:
+		writePajek(bw, m)
+	default:
+		return fmt.Errorf(UnrecognizedKeywordError, format, "host network format")
+	}
+	err = bw.Flush()
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		return errors.Wrap(FileWriteError(err), "writing host network failed")
+	}
+	return nil
+}
+
+// gzipReadCloser closes both the gzip reader and the underlying file.
+type gzipReadCloser struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (r *gzipReadCloser) Close() error {
+	r.Reader.Close()
+	return r.f.Close()
+}
+
+// openNetworkFile opens a network file for reading, decompressing
+// files that end in .gz.
+func openNetworkFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, FileOpenError(err)
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, FileOpenError(err)
+	}
+	return &gzipReadCloser{gz, f}, nil
+}
+
+// edges returns the connections of the network sorted by source and
+// destination host IDs.
+func edges(m HostNetwork) [][2]int {
+	var list [][2]int
+	for _, a := range m.HostIDs() {
+		neighbors := m.GetNeighbors(a)
+		sort.Ints(neighbors)
+		for _, b := range neighbors {
+			list = append(list, [2]int{a, b})
+		}
+	}
+	return list
+}
+
+// formatWeight formats a connection weight. Unspecified weights are
+// negative and are formatted as an empty string so that they are left out
+// when written.
+func formatWeight(w float64) string {
+	if w < 0 {
+		return ""
+	}
+	return strconv.FormatFloat(w, 'f', -1, 64)
+}
+
+// parseWeight parses a connection weight, which must not be negative.
+func parseWeight(s string, lineNum int) (float64, error) {
+	wt, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, FileParsingError(err, lineNum)
+	}
+	if wt < 0 {
+		return 0, InvalidConnectionWeightError(wt, lineNum)
+	}
+	return wt, nil
+}
+
+// parseAdjacencyList reads lines with source and destination IDs and an
+// optional connection weight separated by whitespace.
+func parseAdjacencyList(r io.Reader) (HostNetwork, error) {
+	m := make(adjacencyMatrix)
+	scanner := bufio.NewScanner(r)
+	i := 0
+	for scanner.Scan() {
+		i++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			// ignore blank and comment lines
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			err := fmt.Errorf("adjacency list entry must have 2 values (source and destination IDs) or 3 values (source and destination IDs, connection weight)")
+			return nil, FileParsingError(err, i)
+		}
+		a, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, FileParsingError(err, i)
+		}
+		b, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, FileParsingError(err, i)
+		}
+		// Weight is -1.0 if not specified
+		wt := -1.0
+		if len(fields) == 3 {
+			wt, err = parseWeight(fields[2], i)
+			if err != nil {
+				return nil, err
+			}
+		}
+		m.AddWeightedConnection(a, b, wt)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, FileParsingError(err, i+1)
+	}
+	return m, nil
+}
+
+func writeAdjacencyList(w io.Writer, m HostNetwork) {
+	for _, e := range edges(m) {
+		if wt := formatWeight(m.Connection(e[0], e[1])); wt != "" {
+			fmt.Fprintf(w, "%d %d %s\n", e[0], e[1], wt)
+		} else {
+			fmt.Fprintf(w, "%d %d\n", e[0], e[1])
+		}
+	}
+}
+
+// parseCSVEdgeList reads a comma-separated edge list. The header must
+// have source (or from) and target (or to) columns, and may have a
+// weight column. Connections without a weight have a weight of -1.
+func parseCSVEdgeList(r io.Reader) (HostNetwork, error) {
+	m := make(adjacencyMatrix)
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, FileParsingError(err, 1)
+	}
+	src, dst, wtCol := -1, -1, -1
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "source", "from":
+			src = i
+		case "target", "to":
+			dst = i
+		case "weight":
+			wtCol = i
+		}
+	}
+	if src < 0 || dst < 0 {
+		err := fmt.Errorf("CSV header must have source and target columns")
+		line, _ := reader.FieldPos(0)
+		return nil, FileParsingError(err, line)
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if perr, ok := err.(*csv.ParseError); ok {
+				return nil, FileParsingError(perr.Err, perr.Line)
+			}
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		a, err := strconv.Atoi(strings.TrimSpace(record[src]))
+		if err != nil {
+			return nil, FileParsingError(err, line)
+		}
+		b, err := strconv.Atoi(strings.TrimSpace(record[dst]))
+		if err != nil {
+			return nil, FileParsingError(err, line)
+		}
+		// Weight is -1.0 if not specified
+		wt := -1.0
+		if wtCol >= 0 && len(strings.TrimSpace(record[wtCol])) > 0 {
+			wt, err = parseWeight(strings.TrimSpace(record[wtCol]), line)
+			if err != nil {
+				return nil, err
+			}
+		}
+		m.UpsertConnectionWeight(a, b, wt)
+	}
+	return m, nil
+}
+
+func writeCSVEdgeList(w io.Writer, m HostNetwork) {
+	fmt.Fprintln(w, "source,target,weight")
+	for _, e := range edges(m) {
+		fmt.Fprintf(w, "%d,%d,%s\n", e[0], e[1], formatWeight(m.Connection(e[0], e[1])))
+	}
+}
+
+// parseNodeID parses a node ID used in GraphML and GML files. IDs are
+// integers, optionally prefixed by letters such as "n0".
+func parseNodeID(s string) (int, error) {
+	return strconv.Atoi(strings.TrimLeftFunc(strings.TrimSpace(s), unicode.IsLetter))
+}
+
+// parseGraphML reads a GraphML file. Node IDs must be integers, optionally
+// prefixed by letters. The connection weight is read from the edge
+// attribute named "weight" and is -1 if not specified. Undirected edges
+// are added in both directions.
+func parseGraphML(r io.Reader) (HostNetwork, error) {
+	m := make(adjacencyMatrix)
+	decoder := xml.NewDecoder(r)
+	line := func() int {
+		l, _ := decoder.InputPos()
+		return l
+	}
+	attr := func(el xml.StartElement, name string) (string, bool) {
+		for _, a := range el.Attr {
+			if a.Name.Local == name {
+				return a.Value, true
+			}
+		}
+		return "", false
+	}
+	var weightKey string
+	directed := true
+	type edge struct {
+		a, b     int
+		wt       float64
+		directed bool
+	}
+	var current *edge
+	var inWeight bool
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, FileParsingError(err, line())
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "key":
+				if name, _ := attr(el, "attr.name"); name == "weight" {
+					weightKey, _ = attr(el, "id")
+				}
+			case "graph":
+				if def, _ := attr(el, "edgedefault"); def == "undirected" {
+					directed = false
+				}
+			case "edge":
+				src, ok1 := attr(el, "source")
+				dst, ok2 := attr(el, "target")
+				if !ok1 || !ok2 {
+					return nil, FileParsingError(fmt.Errorf("edge must have source and target attributes"), line())
+				}
+				a, err := parseNodeID(src)
+				if err != nil {
+					return nil, FileParsingError(err, line())
+				}
+				b, err := parseNodeID(dst)
+				if err != nil {
+					return nil, FileParsingError(err, line())
+				}
+				current = &edge{a: a, b: b, wt: -1, directed: directed}
+				if d, ok := attr(el, "directed"); ok {
+					current.directed = d == "true"
+				}
+			case "data":
+				key, _ := attr(el, "key")
+				inWeight = current != nil && key == weightKey && weightKey != ""
+			}
+		case xml.CharData:
+			if inWeight {
+				wt, err := parseWeight(strings.TrimSpace(string(el)), line())
+				if err != nil {
+					return nil, err
+				}
+				current.wt = wt
+			}
+		case xml.EndElement:
+			switch el.Name.Local {
+			case "data":
+				inWeight = false
+			case "edge":
+				m.UpsertConnectionWeight(current.a, current.b, current.wt)
+				if !current.directed {
+					m.UpsertConnectionWeight(current.b, current.a, current.wt)
+				}
+				current = nil
+			}
+		}
+	}
+	return m, nil
+}
+
+func writeGraphML(w io.Writer, m HostNetwork) {
+	fmt.Fprintln(w, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(w, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Fprintln(w, `  <key id="weight" for="edge" attr.name="weight" attr.type="double"/>`)
+	fmt.Fprintln(w, `  <graph id="G" edgedefault="directed">`)
+	for _, id := range m.HostIDs() {
+		fmt.Fprintf(w, "    <node id=\"%d\"/>\n", id)
+	}
+	for _, e := range edges(m) {
+		if wt := formatWeight(m.Connection(e[0], e[1])); wt != "" {
+			fmt.Fprintf(w, "    <edge source=\"%d\" target=\"%d\"><data key=\"weight\">%s</data></edge>\n", e[0], e[1], wt)
+		} else {
+			fmt.Fprintf(w, "    <edge source=\"%d\" target=\"%d\"/>\n", e[0], e[1])
+		}
+	}
+	fmt.Fprintln(w, `  </graph>`)
+	fmt.Fprintln(w, `</graphml>`)
+}
+
+// gmlToken is a key, value or bracket in a GML file.
+type gmlToken struct {
+	text string
+	line int
+}
+
+// tokenizeGML splits a GML file into tokens. Quoted strings are returned
+// without quotes, and comments starting with # are removed.
+func tokenizeGML(r io.Reader) ([]gmlToken, error) {
+	var tokens []gmlToken
+	scanner := bufio.NewScanner(r)
+	i := 0
+	var quoted *strings.Builder
+	var quoteLine int
+	for scanner.Scan() {
+		i++
+		line := scanner.Text()
+		for pos := 0; pos < len(line); {
+			if quoted != nil {
+				end := strings.IndexByte(line[pos:], '"')
+				if end < 0 {
+					quoted.WriteString(line[pos:])
+					quoted.WriteByte('\n')
+					break
+				}
+				quoted.WriteString(line[pos : pos+end])
+				tokens = append(tokens, gmlToken{quoted.String(), quoteLine})
+				quoted = nil
+				pos += end + 1
+				continue
+			}
+			c := line[pos]
+			switch {
+			case c == '#':
+				pos = len(line)
+			case c == '"':
+				quoted = new(strings.Builder)
+				quoteLine = i
+				pos++
+			case c == '[' || c == ']':
+				tokens = append(tokens, gmlToken{string(c), i})
+				pos++
+			case unicode.IsSpace(rune(c)):
+				pos++
+			default:
+				end := pos
+				for end < len(line) && !unicode.IsSpace(rune(line[end])) && line[end] != '[' && line[end] != ']' && line[end] != '"' {
+					end++
+				}
+				tokens = append(tokens, gmlToken{line[pos:end], i})
+				pos = end
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, FileParsingError(err, i+1)
+	}
+	if quoted != nil {
+		return nil, FileParsingError(fmt.Errorf("unterminated string"), quoteLine)
+	}
+	return tokens, nil
+}
+
+// parseGML reads a GML file. Node IDs must be integers. The connection
+// weight is read from the edge's weight or value key and is -1 if not
+// specified. Edges are undirected unless the graph sets directed to 1.
+func parseGML(r io.Reader) (HostNetwork, error) {
+	tokens, err := tokenizeGML(r)
+	if err != nil {
+		return nil, err
+	}
+	pos := 0
+	next := func() (gmlToken, error) {
+		if pos >= len(tokens) {
+			last := 0
+			if len(tokens) > 0 {
+				last = tokens[len(tokens)-1].line
+			}
+			return gmlToken{}, FileParsingError(fmt.Errorf("unexpected end of file"), last)
+		}
+		tok := tokens[pos]
+		pos++
+		return tok, nil
+	}
+	// readList reads key-value pairs until the closing bracket. Values
+	// that are lists are passed to the handler instead of being returned.
+	var readList func(onList func(key gmlToken) error) (map[string]gmlToken, error)
+	readList = func(onList func(key gmlToken) error) (map[string]gmlToken, error) {
+		values := make(map[string]gmlToken)
+		for {
+			key, err := next()
+			if err != nil {
+				return nil, err
+			}
+			if key.text == "]" {
+				return values, nil
+			}
+			value, err := next()
+			if err != nil {
+				return nil, err
+			}
+			if value.text == "[" {
+				err = onList(key)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if value.text == "]" {
+				return nil, FileParsingError(fmt.Errorf("missing value for key %s", key.text), key.line)
+			}
+			values[key.text] = value
+		}
+	}
+	skipList := func(key gmlToken) error {
+		var skip func(key gmlToken) error
+		skip = func(key gmlToken) error {
+			_, err := readList(skip)
+			return err
+		}
+		return skip(key)
+	}
+	type edge struct {
+		a, b int
+		wt   float64
+	}
+	var edgeList []edge
+	var graphValues map[string]gmlToken
+	var foundGraph bool
+	for pos < len(tokens) {
+		key, _ := next()
+		open, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if key.text != "graph" || open.text != "[" {
+			if open.text == "[" {
+				if err := skipList(key); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		foundGraph = true
+		graphValues, err = readList(func(key gmlToken) error {
+			switch key.text {
+			case "edge":
+				values, err := readList(skipList)
+				if err != nil {
+					return err
+				}
+				src, ok1 := values["source"]
+				dst, ok2 := values["target"]
+				if !ok1 || !ok2 {
+					return FileParsingError(fmt.Errorf("edge must have source and target keys"), key.line)
+				}
+				a, err := strconv.Atoi(src.text)
+				if err != nil {
+					return FileParsingError(err, src.line)
+				}
+				b, err := strconv.Atoi(dst.text)
+				if err != nil {
+					return FileParsingError(err, dst.line)
+				}
+				e := edge{a: a, b: b, wt: -1}
+				for _, name := range []string{"weight", "value"} {
+					if v, ok := values[name]; ok {
+						e.wt, err = parseWeight(v.text, v.line)
+						if err != nil {
+							return err
+						}
+						break
+					}
+				}
+				edgeList = append(edgeList, e)
+				return nil
+			}
+			// Nodes do not carry any information used by the simulation
+			return skipList(key)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !foundGraph {
+		return nil, FileParsingError(fmt.Errorf("graph not found"), 1)
+	}
+	directed := false
+	if v, ok := graphValues["directed"]; ok {
+		directed = v.text == "1"
+	}
+	m := make(adjacencyMatrix)
+	for _, e := range edgeList {
+		m.UpsertConnectionWeight(e.a, e.b, e.wt)
+		if !directed {
+			m.UpsertConnectionWeight(e.b, e.a, e.wt)
+		}
+	}
+	return m, nil
+}
+
+func writeGML(w io.Writer, m HostNetwork) {
+	fmt.Fprintln(w, "graph [")
+	fmt.Fprintln(w, "  directed 1")
+	for _, id := range m.HostIDs() {
+		fmt.Fprintf(w, "  node [\n    id %d\n  ]\n", id)
+	}
+	for _, e := range edges(m) {
+		fmt.Fprintf(w, "  edge [\n    source %d\n    target %d\n", e[0], e[1])
+		if wt := formatWeight(m.Connection(e[0], e[1])); wt != "" {
+			fmt.Fprintf(w, "    weight %s\n", wt)
+		}
+		fmt.Fprintln(w, "  ]")
+	}
+	fmt.Fprintln(w, "]")
+}
+
+// parsePajek reads a Pajek .net file. Vertices are numbered from 1 in
+// Pajek files, so vertex i becomes host i-1 unless its label is an integer,
+// in which case the label is used as the host ID. Connections listed under
+// *Edges are added in both directions while those under *Arcs are directed.
+// Connections without a weight have a weight of -1.
+func parsePajek(r io.Reader) (HostNetwork, error) {
+	m := make(adjacencyMatrix)
+	hostIDs := make(map[int]int)
+	hostID := func(v int) int {
+		if id, exists := hostIDs[v]; exists {
+			return id
+		}
+		return v - 1
+	}
+	scanner := bufio.NewScanner(r)
+	i := 0
+	section := ""
+	for scanner.Scan() {
+		i++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "%") {
+			// ignore blank and comment lines
+			continue
+		}
+		if strings.HasPrefix(line, "*") {
+			section = strings.ToLower(strings.Fields(line)[0])
+			switch section {
+			case "*vertices", "*arcs", "*edges":
+			default:
+				return nil, FileParsingError(fmt.Errorf("unsupported section %s", section), i)
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		switch section {
+		case "*vertices":
+			v, err := strconv.Atoi(fields[0])
+			if err != nil {
+				return nil, FileParsingError(err, i)
+			}
+			if len(fields) > 1 {
+				label := strings.Trim(fields[1], `"`)
+				if id, err := strconv.Atoi(label); err == nil {
+					hostIDs[v] = id
+				}
+			}
+		case "*arcs", "*edges":
+			if len(fields) < 2 || len(fields) > 3 {
+				err := fmt.Errorf("pajek %s entry must have 2 values (source and destination vertices) or 3 values (source and destination vertices, connection weight)", section)
+				return nil, FileParsingError(err, i)
+			}
+			a, err := strconv.Atoi(fields[0])
+			if err != nil {
+				return nil, FileParsingError(err, i)
+			}
+			b, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, FileParsingError(err, i)
+			}
+			// Weight is -1.0 if not specified
+			wt := -1.0
+			if len(fields) == 3 {
+				wt, err = parseWeight(fields[2], i)
+				if err != nil {
+					return nil, err
+				}
+			}
+			m.UpsertConnectionWeight(hostID(a), hostID(b), wt)
+			if section == "*edges" {
+				m.UpsertConnectionWeight(hostID(b), hostID(a), wt)
+			}
+		default:
+			return nil, FileParsingError(fmt.Errorf("entry found outside of a section"), i)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, FileParsingError(err, i+1)
+	}
+	return m, nil
+}
+
+func writePajek(w io.Writer, m HostNetwork) {
+	ids := m.HostIDs()
+	vertices := make(map[int]int)
+	fmt.Fprintf(w, "*Vertices %d\n", len(ids))
+	for i, id := range ids {
+		vertices[id] = i + 1
+		fmt.Fprintf(w, "%d \"%d\"\n", i+1, id)
+	}
+	fmt.Fprintln(w, "*Arcs")
+	for _, e := range edges(m) {
+		if wt := formatWeight(m.Connection(e[0], e[1])); wt != "" {
+			fmt.Fprintf(w, "%d %d %s\n", vertices[e[0]], vertices[e[1]], wt)
+		} else {
+			fmt.Fprintf(w, "%d %d\n", vertices[e[0]], vertices[e[1]])
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package contagiongo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteHostNetwork_RoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "network")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := EmptyAdjacencyMatrix()
+	m.AddWeightedConnection(0, 1, 1)
+	m.AddWeightedConnection(1, 0, 0.5)
+	m.AddWeightedConnection(-2, 3, 2.25)
+	for _, name := range []string{"net.txt", "net.csv", "net.graphml", "net.gml", "net.net", "net.csv.gz"} {
+		path := filepath.Join(dir, name)
+		err := WriteHostNetwork(path, "", m)
+		if err != nil {
+			t.Fatalf(UnexpectedErrorWhileError, "writing "+name, err)
+		}
+		loaded, err := LoadHostNetwork(path, "")
+		if err != nil {
+			t.Fatalf(UnexpectedErrorWhileError, "loading "+name, err)
+		}
+		if c := numConnections(loaded); c != 3 {
+			t.Errorf(UnequalIntParameterError, "number of connections in "+name, 3, c)
+		}
+		for _, e := range edges(m) {
+			if w := loaded.Connection(e[0], e[1]); w != m.Connection(e[0], e[1]) {
+				t.Errorf("expected weight %f for %d-%d in %s, got %f instead", m.Connection(e[0], e[1]), e[0], e[1], name, w)
+			}
+		}
+	}
+}
+
+func TestWriteHostNetwork_UnspecifiedWeightRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "network")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m, err := parseAdjacencyList(strings.NewReader("0 1\n1 0\n1 2 0.5\n"))
+	if err != nil {
+		t.Fatalf(UnexpectedErrorWhileError, "parsing adjacency list", err)
+	}
+	for _, name := range []string{"net.txt", "net.csv", "net.graphml", "net.gml", "net.net"} {
+		path := filepath.Join(dir, name)
+		err := WriteHostNetwork(path, "", m)
+		if err != nil {
+			t.Fatalf(UnexpectedErrorWhileError, "writing "+name, err)
+		}
+		loaded, err := LoadHostNetwork(path, "")
+		if err != nil {
+			t.Fatalf(UnexpectedErrorWhileError, "loading "+name, err)
+		}
+		if c := numConnections(loaded); c != 3 {
+			t.Errorf(UnequalIntParameterError, "number of connections in "+name, 3, c)
+		}
+		for _, e := range edges(m) {
+			if w := loaded.Connection(e[0], e[1]); w != m.Connection(e[0], e[1]) {
+				t.Errorf("expected weight %f for %d-%d in %s, got %f instead", m.Connection(e[0], e[1]), e[0], e[1], name, w)
+			}
+		}
+	}
+}
+
+func TestParseAdjacencyList_InvalidLine(t *testing.T) {
+	_, err := parseAdjacencyList(strings.NewReader("# comment\n0 1 1.0\n\n1 x 1.0\n"))
+	if err == nil {
+		t.Fatalf(ExpectedErrorWhileError, "parsing invalid host ID")
+	}
+	if !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("expected error on line 4, got %q instead", err)
+	}
+}
+
+func TestLoadHostNetwork_UnspecifiedWeight(t *testing.T) {
+	dir, err := ioutil.TempDir("", "network")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Every file has a connection from 0 to 1 without a weight and a
+	// connection from 1 to 0 with a weight of 0.5
+	files := map[string]string{
+		"net.txt": "0 1\n1 0 0.5\n",
+		"net.csv": "source,target,weight\n0,1,\n1,0,0.5\n",
+		"net.graphml": `<graphml>
+  <key id="w" for="edge" attr.name="weight" attr.type="double"/>
+  <graph edgedefault="directed">
+    <edge source="0" target="1"/>
+    <edge source="1" target="0"><data key="w">0.5</data></edge>
+  </graph>
+</graphml>
+`,
+		"net.gml": "graph [\n  directed 1\n  edge [ source 0 target 1 ]\n  edge [ source 1 target 0 weight 0.5 ]\n]\n",
+		"net.net": "*Vertices 2\n1 \"0\"\n2 \"1\"\n*Arcs\n1 2\n2 1 0.5\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf(UnexpectedErrorWhileError, "writing "+name, err)
+		}
+		loaded, err := LoadHostNetwork(path, "")
+		if err != nil {
+			t.Fatalf(UnexpectedErrorWhileError, "loading "+name, err)
+		}
+		if w := loaded.Connection(0, 1); w != -1 {
+			t.Errorf("expected unspecified weight %f for 0-1 in %s, got %f instead", -1.0, name, w)
+		}
+		if w := loaded.Connection(1, 0); w != 0.5 {
+			t.Errorf("expected weight %f for 1-0 in %s, got %f instead", 0.5, name, w)
+		}
+	}
+}
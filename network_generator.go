@@ -0,0 +1,342 @@
+package contagiongo
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+// The following functions generate undirected random networks whose
+// hosts are numbered from 0 to n-1. Every connection is added in both
+// directions using the given weight.
+
+// ErdosRenyiNetwork generates a G(n, p) random network where each pair
+// of hosts is connected with probability p.
+func ErdosRenyiNetwork(r *rand.Rand, n int, p, w float64) HostNetwork {
+	m := make(adjacencyMatrix)
+	if p <= 0 {
+		return m
+	}
+	if p >= 1 {
+		for a := 0; a < n; a++ {
+			for b := a + 1; b < n; b++ {
+				m.AddWeightedBiConnection(a, b, w)
+			}
+		}
+		return m
+	}
+	// Skip over pairs that are not connected by drawing geometrically
+	// distributed gaps (Batagelj and Brandes 2005)
+	logQ := math.Log1p(-p)
+	a, b := 1, -1
+	for a < n {
+		b += 1 + int(math.Floor(math.Log(1-r.Float64())/logQ))
+		for b >= a && a < n {
+			b -= a
+			a++
+		}
+		if a < n {
+			m.AddWeightedBiConnection(a, b, w)
+		}
+	}
+	return m
+}
+
+// BarabasiAlbertNetwork generates a scale-free network by preferential
+// attachment. Starting from a star of k+1 hosts, each new host connects to
+// k existing hosts chosen with probability proportional to their degree.
+func BarabasiAlbertNetwork(r *rand.Rand, n, k int, w float64) HostNetwork {
+	m := make(adjacencyMatrix)
+	// Each host appears in the list once for every connection it has
+	var repeated []int
+	for b := 1; b <= k && b < n; b++ {
+		m.AddWeightedBiConnection(0, b, w)
+		repeated = append(repeated, 0, b)
+	}
+	for a := k + 1; a < n; a++ {
+		targets := make(map[int]bool)
+		var picked []int
+		for len(picked) < k {
+			b := repeated[r.Intn(len(repeated))]
+			if !targets[b] {
+				targets[b] = true
+				picked = append(picked, b)
+			}
+		}
+		for _, b := range picked {
+			m.AddWeightedBiConnection(a, b, w)
+			repeated = append(repeated, a, b)
+		}
+	}
+	return m
+}
+
+// WattsStrogatzNetwork generates a small-world network. Hosts are first
+// arranged in a ring where each host is connected to its k nearest
+// neighbors, k/2 on each side. Each connection is then rewired to a random
+// host with probability p, avoiding self-loops and duplicate connections.
+func WattsStrogatzNetwork(r *rand.Rand, n, k int, p, w float64) HostNetwork {
+	m := make(adjacencyMatrix)
+	for j := 1; j <= k/2; j++ {
+		for a := 0; a < n; a++ {
+			b := (a + j) % n
+			if a != b && !m.ConnectionExists(a, b) {
+				m.AddWeightedBiConnection(a, b, w)
+			}
+		}
+	}
+	for j := 1; j <= k/2; j++ {
+		for a := 0; a < n; a++ {
+			b := (a + j) % n
+			if r.Float64() >= p || !m.ConnectionExists(a, b) {
+				continue
+			}
+			// Host is already connected to every other host
+			if len(m[a]) >= n-1 {
+				continue
+			}
+			c := r.Intn(n)
+			for c == a || m.ConnectionExists(a, c) {
+				c = r.Intn(n)
+			}
+			m.DeleteBiConnection(a, b)
+			m.AddWeightedBiConnection(a, c, w)
+		}
+	}
+	return m
+}
+
+// StochasticBlockNetwork generates a network where hosts are divided into
+// consecutively numbered blocks of the given sizes. A host in block i is
+// connected to a host in block j with probability probs[i][j].
+func StochasticBlockNetwork(r *rand.Rand, sizes []int, probs [][]float64, w float64) HostNetwork {
+	m := make(adjacencyMatrix)
+	var blocks []int
+	for i, size := range sizes {
+		for s := 0; s < size; s++ {
+			blocks = append(blocks, i)
+		}
+	}
+	for a := range blocks {
+		for b := a + 1; b < len(blocks); b++ {
+			if r.Float64() < probs[blocks[a]][blocks[b]] {
+				m.AddWeightedBiConnection(a, b, w)
+			}
+		}
+	}
+	return m
+}
+
+// ConfigurationNetwork generates a random network where host i has
+// degrees[i] connections. Connection stubs are paired at random and
+// self-loops and duplicate connections are discarded, so some hosts may
+// end up with fewer connections than specified.
+func ConfigurationNetwork(r *rand.Rand, degrees []int, w float64) HostNetwork {
+	m := make(adjacencyMatrix)
+	var stubs []int
+	for a, degree := range degrees {
+		for d := 0; d < degree; d++ {
+			stubs = append(stubs, a)
+		}
+	}
+	r.Shuffle(len(stubs), func(i, j int) {
+		stubs[i], stubs[j] = stubs[j], stubs[i]
+	})
+	for i := 0; i+1 < len(stubs); i += 2 {
+		a, b := stubs[i], stubs[i+1]
+		if a == b || m.ConnectionExists(a, b) {
+			continue
+		}
+		m.AddWeightedBiConnection(a, b, w)
+	}
+	return m
+}
+
+// LatticeNetwork generates a two-dimensional grid where each host is
+// connected to the hosts above, below, left and right of it. Host IDs are
+// assigned row by row. If periodic is true, the edges of the grid wrap
+// around to form a torus.
+func LatticeNetwork(rows, cols int, periodic bool, w float64) HostNetwork {
+	m := make(adjacencyMatrix)
+	id := func(i, j int) int { return i*cols + j }
+	connect := func(a, b int) {
+		if a != b && !m.ConnectionExists(a, b) {
+			m.AddWeightedBiConnection(a, b, w)
+		}
+	}
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			if j+1 < cols {
+				connect(id(i, j), id(i, j+1))
+			} else if periodic {
+				connect(id(i, j), id(i, 0))
+			}
+			if i+1 < rows {
+				connect(id(i, j), id(i+1, j))
+			} else if periodic {
+				connect(id(i, j), id(0, j))
+			}
+		}
+	}
+	return m
+}
+
+// networkConfig contains parameters to generate a random host network
+// instead of loading it from host_network_path.
+type networkConfig struct {
+	Model    string  `toml:"model"`     // erdos_renyi, barabasi_albert, watts_strogatz, stochastic_block, configuration, lattice
+	NumNodes int     `toml:"num_nodes"` // defaults to host_popsize
+	Weight   float64 `toml:"weight"`    // defaults to 1
+	Seed     int64   `toml:"seed"`
+
+	Prob           float64     `toml:"prob"`            // only for erdos_renyi and watts_strogatz (rewiring)
+	NumConnections int         `toml:"num_connections"` // only for barabasi_albert and watts_strogatz
+	BlockSizes     []int       `toml:"block_sizes"`     // only for stochastic_block
+	BlockProbs     [][]float64 `toml:"block_probs"`     // only for stochastic_block
+	DegreeSequence []int       `toml:"degree_sequence"` // only for configuration
+	Rows           int         `toml:"rows"`            // only for lattice
+	Cols           int         `toml:"cols"`            // only for lattice
+	Periodic       bool        `toml:"periodic"`        // only for lattice
+
+	validated bool
+}
+
+// Validate checks the validity of the network configuration.
+func (c *networkConfig) Validate() error {
+	err := checkKeyword(c.Model, "network model",
+		"erdos_renyi", "barabasi_albert", "watts_strogatz",
+		"stochastic_block", "configuration", "lattice",
+	)
+	if err != nil {
+		return err
+	}
+	if c.Weight < 0 {
+		return fmt.Errorf(InvalidFloatParameterError, "weight", c.Weight, "must be greater than or equal to 0")
+	}
+	// Assign default value
+	if c.Weight == 0 {
+		c.Weight = 1
+	}
+	// Number of nodes is implied by the parameters of some models
+	switch strings.ToLower(c.Model) {
+	case "stochastic_block":
+		var sum int
+		for _, size := range c.BlockSizes {
+			sum += size
+		}
+		if c.NumNodes == 0 {
+			c.NumNodes = sum
+		}
+	case "configuration":
+		if c.NumNodes == 0 {
+			c.NumNodes = len(c.DegreeSequence)
+		}
+	case "lattice":
+		if c.NumNodes == 0 {
+			c.NumNodes = c.Rows * c.Cols
+		}
+	}
+	if c.NumNodes < 1 {
+		return fmt.Errorf(InvalidIntParameterError, "num_nodes", c.NumNodes, "must be greater than or equal to 1")
+	}
+	switch strings.ToLower(c.Model) {
+	case "erdos_renyi":
+		if c.Prob < 0 || c.Prob > 1 {
+			return fmt.Errorf(InvalidFloatParameterError, "prob", c.Prob, "must be between 0 and 1")
+		}
+	case "barabasi_albert":
+		if c.NumConnections < 1 || c.NumConnections >= c.NumNodes {
+			return fmt.Errorf(InvalidIntParameterError, "num_connections", c.NumConnections, "must be between 1 and num_nodes - 1")
+		}
+	case "watts_strogatz":
+		if c.NumConnections < 2 || c.NumConnections%2 != 0 || c.NumConnections >= c.NumNodes {
+			return fmt.Errorf(InvalidIntParameterError, "num_connections", c.NumConnections, "must be an even number between 2 and num_nodes - 1")
+		}
+		if c.Prob < 0 || c.Prob > 1 {
+			return fmt.Errorf(InvalidFloatParameterError, "prob", c.Prob, "must be between 0 and 1")
+		}
+	case "stochastic_block":
+		if len(c.BlockSizes) == 0 {
+			return fmt.Errorf("stochastic_block network requires block_sizes")
+		}
+		var sum int
+		for _, size := range c.BlockSizes {
+			if size < 1 {
+				return fmt.Errorf(InvalidIntParameterError, "block size", size, "must be greater than or equal to 1")
+			}
+			sum += size
+		}
+		if sum != c.NumNodes {
+			return fmt.Errorf(UnequalIntParameterError, "sum of block_sizes", c.NumNodes, sum)
+		}
+		if len(c.BlockProbs) != len(c.BlockSizes) {
+			return fmt.Errorf(UnequalIntParameterError, "number of rows in block_probs", len(c.BlockSizes), len(c.BlockProbs))
+		}
+		for _, row := range c.BlockProbs {
+			if len(row) != len(c.BlockSizes) {
+				return fmt.Errorf(UnequalIntParameterError, "number of columns in block_probs", len(c.BlockSizes), len(row))
+			}
+		}
+		for i, row := range c.BlockProbs {
+			for j, p := range row {
+				if p < 0 || p > 1 {
+					return fmt.Errorf(InvalidFloatParameterError, "block probability", p, "must be between 0 and 1")
+				}
+				if p != c.BlockProbs[j][i] {
+					return fmt.Errorf("block_probs must be symmetric")
+				}
+			}
+		}
+	case "configuration":
+		if len(c.DegreeSequence) != c.NumNodes {
+			return fmt.Errorf(UnequalIntParameterError, "length of degree_sequence", c.NumNodes, len(c.DegreeSequence))
+		}
+		var sum int
+		for _, degree := range c.DegreeSequence {
+			if degree < 0 {
+				return fmt.Errorf(InvalidIntParameterError, "degree", degree, "must be greater than or equal to 0")
+			}
+			sum += degree
+		}
+		if sum%2 != 0 {
+			return fmt.Errorf(InvalidIntParameterError, "sum of degree_sequence", sum, "must be even")
+		}
+	case "lattice":
+		if c.Rows < 1 || c.Cols < 1 {
+			return fmt.Errorf("lattice rows and cols must be greater than or equal to 1")
+		}
+		if c.Rows*c.Cols != c.NumNodes {
+			return fmt.Errorf(UnequalIntParameterError, "rows * cols", c.NumNodes, c.Rows*c.Cols)
+		}
+	}
+	c.validated = true
+	return nil
+}
+
+// Generate creates a new random network using the seed of the
+// configuration. The same configuration always generates the same network.
+func (c *networkConfig) Generate() (HostNetwork, error) {
+	if !c.validated {
+		err := c.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	r := NewRand(DeriveSeed(c.Seed))
+	switch strings.ToLower(c.Model) {
+	case "erdos_renyi":
+		return ErdosRenyiNetwork(r, c.NumNodes, c.Prob, c.Weight), nil
+	case "barabasi_albert":
+		return BarabasiAlbertNetwork(r, c.NumNodes, c.NumConnections, c.Weight), nil
+	case "watts_strogatz":
+		return WattsStrogatzNetwork(r, c.NumNodes, c.NumConnections, c.Prob, c.Weight), nil
+	case "stochastic_block":
+		return StochasticBlockNetwork(r, c.BlockSizes, c.BlockProbs, c.Weight), nil
+	case "configuration":
+		return ConfigurationNetwork(r, c.DegreeSequence, c.Weight), nil
+	case "lattice":
+		return LatticeNetwork(c.Rows, c.Cols, c.Periodic, c.Weight), nil
+	}
+	return nil, fmt.Errorf(UnrecognizedKeywordError, c.Model, "network model")
+}
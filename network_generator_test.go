@@ -0,0 +1,58 @@
+package contagiongo
+
+import "testing"
+
+func numConnections(m HostNetwork) int {
+	var count int
+	for _, a := range m.HostIDs() {
+		count += len(m.GetNeighbors(a))
+	}
+	return count
+}
+
+func TestBarabasiAlbertNetwork(t *testing.T) {
+	n, k := 100, 2
+	m := BarabasiAlbertNetwork(NewRand(0), n, k, 1)
+	// Initial star has k connections and each new host adds k more
+	expected := 2 * (k + (n-k-1)*k)
+	if count := numConnections(m); count != expected {
+		t.Errorf(UnequalIntParameterError, "number of directed connections", expected, count)
+	}
+}
+
+func TestWattsStrogatzNetwork(t *testing.T) {
+	n, k := 50, 4
+	m := WattsStrogatzNetwork(NewRand(0), n, k, 0.3, 1)
+	// Rewiring preserves the number of connections
+	if count := numConnections(m); count != n*k {
+		t.Errorf(UnequalIntParameterError, "number of directed connections", n*k, count)
+	}
+	for _, a := range m.HostIDs() {
+		if m.ConnectionExists(a, a) {
+			t.Errorf("unexpected self-loop in host %d", a)
+		}
+	}
+}
+
+func TestLatticeNetwork(t *testing.T) {
+	m := LatticeNetwork(3, 4, true, 1)
+	for _, a := range m.HostIDs() {
+		if l := len(m.GetNeighbors(a)); l != 4 {
+			t.Errorf(UnequalIntParameterError, "number of neighbors", 4, l)
+		}
+	}
+	m = LatticeNetwork(3, 4, false, 1)
+	if l := len(m.GetNeighbors(0)); l != 2 {
+		t.Errorf(UnequalIntParameterError, "number of neighbors of corner host", 2, l)
+	}
+}
+
+func TestErdosRenyiNetwork(t *testing.T) {
+	n, p := 200, 0.1
+	m := ErdosRenyiNetwork(NewRand(0), n, p, 1)
+	expected := float64(n*(n-1)) * p
+	count := float64(numConnections(m))
+	if count < 0.9*expected || count > 1.1*expected {
+		t.Errorf("expected about %f directed connections, got %f instead", expected, count)
+	}
+}
@@ -0,0 +1,204 @@
+package contagiongo
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// NetworkStats summarizes the structure of a host network.
+// Degrees count the neighbors of a host, which are the hosts it can
+// transmit to. Clustering, components, diameter and assortativity are
+// computed after ignoring the direction of connections.
+type NetworkStats struct {
+	NumHosts              int         `json:"num_hosts"`
+	NumConnections        int         `json:"num_connections"`
+	Directed              bool        `json:"directed"`
+	MinDegree             int         `json:"min_degree"`
+	MaxDegree             int         `json:"max_degree"`
+	MeanDegree            float64     `json:"mean_degree"`
+	DegreeDistribution    map[int]int `json:"degree_distribution"`
+	ClusteringCoefficient float64     `json:"clustering_coefficient"`
+	NumComponents         int         `json:"num_components"`
+	LargestComponentSize  int         `json:"largest_component_size"`
+	DiameterEstimate      int         `json:"diameter_estimate"`
+	// Assortativity is the degree correlation between connected hosts.
+	// It is zero if all hosts have the same degree.
+	Assortativity float64 `json:"assortativity"`
+	// IsolatedHosts lists the hosts from 0 to popSize-1
+	// that have no connections.
+	IsolatedHosts []int `json:"isolated_hosts"`
+}
+
+// ComputeNetworkStats computes the structure of the network.
+// Hosts from 0 to popSize-1 that are not in the network
+// are reported as isolated hosts.
+func ComputeNetworkStats(m HostNetwork, popSize int) *NetworkStats {
+	stats := &NetworkStats{
+		DegreeDistribution: make(map[int]int),
+		IsolatedHosts:      []int{},
+	}
+	// Undirected neighbors without self-loops
+	undirected := make(map[int]map[int]bool)
+	addNode := func(id int) {
+		if _, exists := undirected[id]; !exists {
+			undirected[id] = make(map[int]bool)
+		}
+	}
+	for _, a := range m.HostIDs() {
+		addNode(a)
+		for _, b := range m.GetNeighbors(a) {
+			addNode(b)
+			stats.NumConnections++
+			if !m.ConnectionExists(b, a) {
+				stats.Directed = true
+			}
+			if a != b {
+				undirected[a][b] = true
+				undirected[b][a] = true
+			}
+		}
+	}
+	ids := make([]int, 0, len(undirected))
+	for id := range undirected {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	stats.NumHosts = len(ids)
+	for i := 0; i < popSize; i++ {
+		if len(undirected[i]) == 0 && len(m.GetNeighbors(i)) == 0 {
+			stats.IsolatedHosts = append(stats.IsolatedHosts, i)
+		}
+	}
+	if len(ids) == 0 {
+		return stats
+	}
+
+	// Degree distribution
+	stats.MinDegree = math.MaxInt32
+	for _, id := range ids {
+		d := len(m.GetNeighbors(id))
+		stats.DegreeDistribution[d]++
+		if d < stats.MinDegree {
+			stats.MinDegree = d
+		}
+		if d > stats.MaxDegree {
+			stats.MaxDegree = d
+		}
+	}
+	stats.MeanDegree = float64(stats.NumConnections) / float64(len(ids))
+
+	// Average local clustering coefficient. Hosts with less than two
+	// neighbors have a coefficient of zero.
+	var totalClustering float64
+	for _, id := range ids {
+		neighbors := sortedKeys(undirected[id])
+		k := len(neighbors)
+		if k < 2 {
+			continue
+		}
+		links := 0
+		for i, a := range neighbors {
+			for _, b := range neighbors[i+1:] {
+				if undirected[a][b] {
+					links++
+				}
+			}
+		}
+		totalClustering += 2 * float64(links) / float64(k*(k-1))
+	}
+	stats.ClusteringCoefficient = totalClustering / float64(len(ids))
+
+	// Connected components and diameter
+	visited := make(map[int]bool)
+	for _, id := range ids {
+		if visited[id] {
+			continue
+		}
+		stats.NumComponents++
+		dist := bfsDistances(undirected, id)
+		for node := range dist {
+			visited[node] = true
+		}
+		if len(dist) > stats.LargestComponentSize {
+			stats.LargestComponentSize = len(dist)
+		}
+		// Double sweep: the eccentricity of the farthest host from an
+		// arbitrary host is a lower bound of the diameter that is exact
+		// for trees and usually close for other networks.
+		far, _ := farthest(dist)
+		_, ecc := farthest(bfsDistances(undirected, far))
+		if ecc > stats.DiameterEstimate {
+			stats.DiameterEstimate = ecc
+		}
+	}
+
+	// Degree assortativity over both ends of every undirected connection
+	var n, sumXY, sumX, sumX2 float64
+	for _, a := range ids {
+		da := float64(len(undirected[a]))
+		for b := range undirected[a] {
+			db := float64(len(undirected[b]))
+			n++
+			sumXY += da * db
+			sumX += da
+			sumX2 += da * da
+		}
+	}
+	if n > 0 {
+		mean := sumX / n
+		variance := sumX2/n - mean*mean
+		if variance > 1e-12 {
+			stats.Assortativity = (sumXY/n - mean*mean) / variance
+		}
+	}
+	return stats
+}
+
+// Check returns an error if some hosts in the population
+// have no connections to other hosts.
+func (s *NetworkStats) Check() error {
+	if len(s.IsolatedHosts) > 0 {
+		return fmt.Errorf("%d hosts have no connections in the host network: %v", len(s.IsolatedHosts), s.IsolatedHosts)
+	}
+	return nil
+}
+
+func sortedKeys(set map[int]bool) []int {
+	keys := make([]int, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// bfsDistances returns the number of connections between the source host
+// and every host reachable from it.
+func bfsDistances(neighbors map[int]map[int]bool, source int) map[int]int {
+	dist := map[int]int{source: 0}
+	queue := []int{source}
+	for len(queue) > 0 {
+		a := queue[0]
+		queue = queue[1:]
+		for _, b := range sortedKeys(neighbors[a]) {
+			if _, seen := dist[b]; !seen {
+				dist[b] = dist[a] + 1
+				queue = append(queue, b)
+			}
+		}
+	}
+	return dist
+}
+
+// farthest returns the host with the largest distance,
+// choosing the smallest ID among ties.
+func farthest(dist map[int]int) (id, d int) {
+	id, d = math.MaxInt32, -1
+	for node, nd := range dist {
+		if nd > d || (nd == d && node < id) {
+			id, d = node, nd
+		}
+	}
+	return id, d
+}
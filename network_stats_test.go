@@ -0,0 +1,41 @@
+package contagiongo
+
+import "testing"
+
+func TestComputeNetworkStats(t *testing.T) {
+	// Triangle 0-1-2 with a tail 2-3-4, host 5 is isolated
+	m := EmptyAdjacencyMatrix()
+	for _, e := range [][2]int{{0, 1}, {1, 2}, {0, 2}, {2, 3}, {3, 4}} {
+		m.AddWeightedBiConnection(e[0], e[1], 1)
+	}
+	stats := ComputeNetworkStats(m, 6)
+	if stats.NumHosts != 5 {
+		t.Errorf(UnequalIntParameterError, "number of hosts", 5, stats.NumHosts)
+	}
+	if stats.NumConnections != 10 {
+		t.Errorf(UnequalIntParameterError, "number of connections", 10, stats.NumConnections)
+	}
+	if stats.Directed {
+		t.Errorf("expected an undirected network")
+	}
+	if stats.NumComponents != 1 {
+		t.Errorf(UnequalIntParameterError, "number of components", 1, stats.NumComponents)
+	}
+	if stats.DiameterEstimate != 3 {
+		t.Errorf(UnequalIntParameterError, "diameter", 3, stats.DiameterEstimate)
+	}
+	if stats.MaxDegree != 3 || stats.DegreeDistribution[2] != 3 {
+		t.Errorf("unexpected degree distribution %v", stats.DegreeDistribution)
+	}
+	// Hosts 0 and 1 have coefficient 1, host 2 has 1/3
+	expected := (1 + 1 + 1.0/3) / 5
+	if stats.ClusteringCoefficient != expected {
+		t.Errorf(UnequalFloatParameterError, "clustering coefficient", expected, stats.ClusteringCoefficient)
+	}
+	if len(stats.IsolatedHosts) != 1 || stats.IsolatedHosts[0] != 5 {
+		t.Errorf("expected isolated hosts [5], got %v instead", stats.IsolatedHosts)
+	}
+	if stats.Check() == nil {
+		t.Errorf(ExpectedErrorWhileError, "checking network with isolated hosts")
+	}
+}
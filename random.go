@@ -0,0 +1,230 @@
+package contagiongo
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+// The following are IDs used to separate the random number streams used
+// in each step of a simulation generation.
+const (
+	processStream = iota + 1
+	transmitStream
+	updateStream
+	interventionStream
+	demographyStream
+	contactStream
+)
+
+// uidTime is the timestamp used to create genotype and genotype node IDs.
+// A fixed timestamp is used so that IDs only depend on the random seed.
+var uidTime = time.Unix(1400000000, 0)
+
+// splitMixSource is a rand.Source that implements the SplitMix64
+// generator. It is cheap to create, allowing a new source to be created
+// for every host and every pathogen in each generation.
+type splitMixSource struct {
+	state uint64
+}
+
+func (s *splitMixSource) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+func (s *splitMixSource) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	return splitMix64(s.state)
+}
+
+func (s *splitMixSource) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+func splitMix64(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// NewRand creates a new random number generator from the given seed.
+// Unlike the global generator, it is not safe for concurrent use.
+func NewRand(seed int64) *rand.Rand {
+	return rand.New(&splitMixSource{uint64(seed)})
+}
+
+// DeriveSeed creates a new seed from a parent seed and a list of IDs.
+// The same seed and IDs always return the same value, while different IDs
+// return statistically independent seeds. For example, the seed of a
+// simulation instance is derived from the master seed and the instance ID.
+func DeriveSeed(seed int64, ids ...int) int64 {
+	x := splitMix64(uint64(seed) + 0x9e3779b97f4a7c15)
+	for _, id := range ids {
+		x = splitMix64(x ^ splitMix64(uint64(id)+0x9e3779b97f4a7c15))
+	}
+	return int64(x)
+}
+
+// newNodeUID creates a new genotype node ID using random numbers drawn
+// from the given generator.
+func newNodeUID(r *rand.Rand) ksuid.KSUID {
+	payload := make([]byte, 16)
+	binary.BigEndian.PutUint64(payload[:8], r.Uint64())
+	binary.BigEndian.PutUint64(payload[8:], r.Uint64())
+	uid, err := ksuid.FromParts(uidTime, payload)
+	if err != nil {
+		panic(err)
+	}
+	return uid
+}
+
+// newGenotypeUID creates a genotype ID based on the sequence.
+// Identical sequences always get the same ID.
+func newGenotypeUID(sequence []uint8) ksuid.KSUID {
+	h := sha256.Sum256(sequence)
+	uid, err := ksuid.FromParts(uidTime, h[:16])
+	if err != nil {
+		panic(err)
+	}
+	return uid
+}
+
+// binomial draws the number of successes in n trials with
+// success probability p.
+func binomial(r *rand.Rand, n int, p float64) int {
+	if n < 1 || p <= 0 {
+		return 0
+	} else if p >= 1 {
+		return n
+	} else if p > 0.5 {
+		return n - binomial(r, n, 1-p)
+	}
+	// Count successes by adding up geometrically-distributed waiting times
+	// until the number of trials is exceeded.
+	logQ := math.Log1p(-p)
+	var successes int
+	var trials float64
+	for {
+		trials += math.Floor(math.Log(1-r.Float64())/logQ) + 1
+		if trials > float64(n) {
+			return successes
+		}
+		successes++
+	}
+}
+
+// poisson draws the number of events given the expected
+// number of events lambda.
+func poisson(r *rand.Rand, lambda float64) int {
+	if lambda <= 0 {
+		return 0
+	}
+	// Split large lambda into smaller ones to avoid underflow
+	var k int
+	for lambda > 30 {
+		k += poisson(r, 30)
+		lambda -= 30
+	}
+	l := math.Exp(-lambda)
+	p := 1.0
+	for {
+		p *= r.Float64()
+		if p <= l {
+			return k
+		}
+		k++
+	}
+}
+
+// multinomial distributes n trials into categories given the probability
+// of each category. Probabilities do not need to sum to 1.
+func multinomial(r *rand.Rand, n int, probs []float64) []int {
+	counts := make([]int, len(probs))
+	// Remaining probability mass from the current category onwards
+	remaining := make([]float64, len(probs)+1)
+	last := -1
+	for i := len(probs) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + probs[i]
+		if last < 0 && probs[i] > 0 {
+			last = i
+		}
+	}
+	for i, p := range probs {
+		if n == 0 || i > last {
+			break
+		}
+		if i == last {
+			counts[i] = n
+			break
+		}
+		counts[i] = binomial(r, n, p/remaining[i])
+		n -= counts[i]
+	}
+	return counts
+}
+
+// gamma draws from a gamma distribution with the given shape and scale
+// using the method of Marsaglia and Tsang.
+func gamma(r *rand.Rand, shape, scale float64) float64 {
+	if shape <= 0 || scale <= 0 {
+		return 0
+	}
+	if shape < 1 {
+		// Boost shape and correct using a uniform power
+		return gamma(r, shape+1, scale) * math.Pow(r.Float64(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := r.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := r.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v * scale
+		}
+	}
+}
+
+// beta draws from a beta distribution with shape parameters a and b.
+func beta(r *rand.Rand, a, b float64) float64 {
+	x := gamma(r, a, 1)
+	y := gamma(r, b, 1)
+	if x+y == 0 {
+		return 0
+	}
+	return x / (x + y)
+}
+
+// negativeBinomial draws a count with the given mean and dispersion k
+// as a gamma-Poisson mixture. Smaller values of k give more variable
+// counts.
+func negativeBinomial(r *rand.Rand, mean, k float64) int {
+	if mean <= 0 {
+		return 0
+	}
+	return poisson(r, gamma(r, k, mean/k))
+}
+
+// geometric draws the number of failures before the first success
+// for a geometric distribution with the given mean.
+func geometric(r *rand.Rand, mean float64) int {
+	if mean <= 0 {
+		return 0
+	}
+	p := 1 / (1 + mean)
+	return int(math.Floor(math.Log(1-r.Float64()) / math.Log1p(-p)))
+}
+
+// betaBinomial draws the number of successes in n trials where the
+// success probability is drawn from a beta distribution.
+func betaBinomial(r *rand.Rand, n int, a, b float64) int {
+	return binomial(r, n, beta(r, a, b))
+}
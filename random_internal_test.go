@@ -0,0 +1,70 @@
+package contagiongo
+
+import "testing"
+
+func TestDeriveSeed(t *testing.T) {
+	if DeriveSeed(1, 2, 3) != DeriveSeed(1, 2, 3) {
+		t.Errorf("expected identical seeds given the same IDs")
+	}
+	if DeriveSeed(1, 2, 3) == DeriveSeed(1, 3, 2) {
+		t.Errorf("expected different seeds given IDs in a different order")
+	}
+	if DeriveSeed(1, 2) == DeriveSeed(2, 2) {
+		t.Errorf("expected different seeds given different parent seeds")
+	}
+}
+
+func TestMultinomial(t *testing.T) {
+	r := NewRand(42)
+	probs := []float64{0.2, 0, 0.5, 0.3, 0}
+	for i := 0; i < 100; i++ {
+		counts := multinomial(r, 50, probs)
+		var sum int
+		for j, count := range counts {
+			if probs[j] == 0 && count > 0 {
+				t.Errorf("expected 0 for category %d with probability 0, got %d instead", j, count)
+			}
+			sum += count
+		}
+		if sum != 50 {
+			t.Errorf(UnequalIntParameterError, "sum of counts", 50, sum)
+		}
+	}
+}
+
+func TestNewRand_Reproducible(t *testing.T) {
+	r1, r2 := NewRand(7), NewRand(7)
+	for i := 0; i < 10; i++ {
+		a, b := binomial(r1, 100, 0.3), binomial(r2, 100, 0.3)
+		if a != b {
+			t.Errorf(UnequalIntParameterError, "binomial draw", a, b)
+		}
+		x, y := poisson(r1, 45.5), poisson(r2, 45.5)
+		if x != y {
+			t.Errorf(UnequalIntParameterError, "poisson draw", x, y)
+		}
+	}
+}
+
+func TestSizeDistributions_Mean(t *testing.T) {
+	r := NewRand(1)
+	var tests = []struct {
+		name     string
+		draw     func() int
+		expected float64
+	}{
+		{"negative binomial", func() int { return negativeBinomial(r, 4, 0.5) }, 4},
+		{"geometric", func() int { return geometric(r, 3) }, 3},
+		{"beta-binomial", func() int { return betaBinomial(r, 10, 2, 3) }, 4},
+	}
+	n := 20000
+	for _, tt := range tests {
+		var sum int
+		for i := 0; i < n; i++ {
+			sum += tt.draw()
+		}
+		if mean := float64(sum) / float64(n); mean < 0.9*tt.expected || mean > 1.1*tt.expected {
+			t.Errorf("expected %s mean of about %f, got %f instead", tt.name, tt.expected, mean)
+		}
+	}
+}
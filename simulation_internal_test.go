@@ -0,0 +1,160 @@
+package contagiongo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadTestConfig writes a small SIR configuration and its input files
+// to dir and returns the validated configuration. Ten hosts are connected
+// in a ring and host 0 is infected at the start. Extra is appended to the
+// configuration file and can add new sections.
+func loadTestConfig(t *testing.T, dir, extra string) *EvoEpiConfig {
+	numHosts, numSites := 10, 5
+	var hostIDs []string
+	var network strings.Builder
+	for i := 0; i < numHosts; i++ {
+		hostIDs = append(hostIDs, fmt.Sprint(i))
+		j := (i + 1) % numHosts
+		fmt.Fprintf(&network, "%d %d 1.0\n%d %d 1.0\n", i, j, j, i)
+	}
+	var fitness strings.Builder
+	fitness.WriteString("log\n")
+	for i := 0; i < numSites; i++ {
+		fmt.Fprintf(&fitness, "%d: 0.0, -0.1\n", i)
+	}
+	files := map[string]string{
+		"net.txt": network.String(),
+		"fit.txt": fitness.String(),
+		"seq.fa":  "% A:0 B:1\n>h:0\nAAAAA\n>h:0\nAAAAA\n",
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatalf(UnexpectedErrorWhileError, "writing "+name, err)
+		}
+	}
+	ids := "[" + strings.Join(hostIDs, ",") + "]"
+	config := fmt.Sprintf(`[simulation]
+num_generations = 30
+num_instances = 1
+num_sites = %d
+host_popsize = %d
+epidemic_model = "sir"
+expected_characters = ["A","B"]
+pathogen_path = "%[3]s/seq.fa"
+host_network_path = "%[3]s/net.txt"
+
+[logging]
+log_freq = 1
+log_transmission = true
+log_path = "%[3]s/log"
+
+[[intrahost_model]]
+model_name = "m"
+host_ids = %[4]s
+mutation_rate = 0.01
+transition_matrix = [[0.0,1.0],[1.0,0.0]]
+recombination_rate = 0.0
+replication_model = "constant"
+constant_pop_size = 20
+infected_duration = 6
+recovered_duration = 5
+
+[[fitness_model]]
+model_name = "f"
+host_ids = %[4]s
+fitness_model = "multiplicative"
+fitness_model_path = "%[3]s/fit.txt"
+
+[[transmission_model]]
+model_name = "t"
+host_ids = %[4]s
+mode = "constant"
+transmission_prob = 0.5
+transmission_size = 2
+%[5]s`, numSites, numHosts, dir, ids, extra)
+	path := filepath.Join(dir, "config.toml")
+	err := ioutil.WriteFile(path, []byte(config), 0644)
+	if err != nil {
+		t.Fatalf(UnexpectedErrorWhileError, "writing configuration", err)
+	}
+	conf, err := LoadEvoEpiConfig(path)
+	if err != nil {
+		t.Fatalf(UnexpectedErrorWhileError, "loading configuration", err)
+	}
+	err = conf.Validate()
+	if err != nil {
+		t.Fatalf(UnexpectedErrorWhileError, "validating configuration", err)
+	}
+	return conf
+}
+
+// newTestSimulation creates an SIR simulation from the configuration
+// that writes to the given logger.
+func newTestSimulation(t *testing.T, conf *EvoEpiConfig, logger DataLogger, seed int64) EpidemicSimulation {
+	sim, err := NewSIRSimulation(conf, logger)
+	if err != nil {
+		t.Fatalf(UnexpectedErrorWhileError, "creating simulation", err)
+	}
+	sim.SetSeed(seed)
+	return sim
+}
+
+// countStatus returns the number of hosts in the given status.
+func countStatus(sim Epidemic, status int) int {
+	var n int
+	for hostID := range sim.HostMap() {
+		if sim.HostStatus(hostID) == status {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRunEpidemic_StopConditions(t *testing.T) {
+	tests := []struct {
+		desc    string
+		extra   string
+		stopped bool
+	}{
+		{"no stop conditions", "", false},
+		{"condition holds", `
+[[stop_condition]]
+condition = "allele_loss"
+position = 0
+sequence = "A"
+`, false},
+		{"condition fails", `
+[[stop_condition]]
+condition = "allele_loss"
+position = 0
+sequence = "B"
+`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "contagion")
+			if err != nil {
+				t.Fatalf(UnexpectedErrorWhileError, "creating temporary directory", err)
+			}
+			defer os.RemoveAll(dir)
+			conf := loadTestConfig(t, dir, tt.extra)
+			sim := newTestSimulation(t, conf, new(NullLogger), 1)
+			sim.Run(1)
+			if tt.stopped {
+				// The allele is absent from the start so the simulation
+				// stops after the first generation
+				if !sim.Stopped() || sim.Time() != 1 {
+					t.Errorf("expected simulation to stop at generation 1, stopped at %d (%t)", sim.Time(), sim.Stopped())
+				}
+			} else if sim.Time() <= 1 {
+				t.Errorf("expected simulation to continue past generation 1, stopped at %d", sim.Time())
+			}
+		})
+	}
+}
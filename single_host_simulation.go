@@ -17,6 +17,7 @@ type singleHostSimulation struct {
 	intrahostModel IntrahostModel
 	fitnessModel   FitnessModel
 	tree           GenotypeTree
+	seed           int64
 }
 
 func (sim *singleHostSimulation) Host() Host {
@@ -63,6 +64,9 @@ func (sim *singleHostSimulation) ExposedProcess(i, t int, host Host, c chan<- Mu
 func (sim *singleHostSimulation) InfectedProcess(i, t int, host Host, c chan<- MutationPackage, wg *sync.WaitGroup) {
 	defer wg.Done()
 	pathogens := host.Pathogens()
+	r := NewRand(DeriveSeed(sim.seed, t, processStream))
+	// Fitness may depend on the host and on its current pathogens
+	ctx := NewFitnessContext(t, 0, host, pathogens)
 	var replicatedC <-chan GenotypeNode
 	switch strings.ToLower(sim.intrahostModel.ReplicationMethod()) {
 	case "relative":
@@ -71,7 +75,7 @@ func (sim *singleHostSimulation) InfectedProcess(i, t int, host Host, c chan<- M
 		var minLogFitness float64
 		// Compute log total fitness and get max value
 		for i, pathogen := range pathogens {
-			logFitnesses[i] = pathogen.Fitness(host.GetFitnessModel())
+			logFitnesses[i] = FitnessInContext(host.GetFitnessModel(), ctx, pathogen)
 			if minLogFitness > logFitnesses[i] {
 				minLogFitness = logFitnesses[i]
 			}
@@ -92,19 +96,19 @@ func (sim *singleHostSimulation) InfectedProcess(i, t int, host Host, c chan<- M
 		// TODO: Expose this in the interface
 		nextPopSize := host.GetIntrahostModel().NextPathogenPopSize(currentPopSize)
 		// Execute
-		replicatedC = MultinomialReplication(pathogens, normedFitnesses, nextPopSize)
+		replicatedC = MultinomialReplication(r, pathogens, normedFitnesses, nextPopSize)
 	case "absolute":
 		// Get decimal fitness values. Each value is the expected number of
 		// offspring
 		replicativeFitnesses := make([]float64, len(pathogens))
 		for i, pathogen := range pathogens {
-			replicativeFitnesses[i] = pathogen.Fitness(host.GetFitnessModel())
+			replicativeFitnesses[i] = FitnessInContext(host.GetFitnessModel(), ctx, pathogen)
 		}
 		// Execute
-		replicatedC = IntrinsicRateReplication(pathogens, replicativeFitnesses, nil)
+		replicatedC = IntrinsicRateReplication(r, pathogens, replicativeFitnesses, nil)
 	}
 	// Mutate replicated pathogens
-	mutatedC, newMutantsC := MutateSequence(replicatedC, sim.tree, host.GetIntrahostModel())
+	mutatedC, newMutantsC := MutateSequence(r, replicatedC, sim.tree, host.GetIntrahostModel())
 	// Clear current set of pathogens and get new set from the channel
 	host.RemoveAllPathogens()
 	var wg2 sync.WaitGroup
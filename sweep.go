@@ -0,0 +1,390 @@
+package contagiongo
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// sweepConfig describes a parameter sweep. Each point of the sweep is
+// a complete configuration that is run with its own log directory.
+type sweepConfig struct {
+	Method     string                  `toml:"method"`      // grid, lhs
+	NumSamples int                     `toml:"num_samples"` // only for lhs
+	LogPath    string                  `toml:"log_path"`
+	Parameters []*sweepParameterConfig `toml:"parameter"`
+
+	validated bool
+}
+
+// Validate checks the validity of the sweep configuration.
+func (c *sweepConfig) Validate() error {
+	err := checkKeyword(c.Method, "sweep method", "grid", "lhs")
+	if err != nil {
+		return err
+	}
+	if strings.ToLower(c.Method) == "lhs" && c.NumSamples < 1 {
+		return fmt.Errorf(InvalidIntParameterError, "num_samples", c.NumSamples, "must be greater than or equal to 1")
+	}
+	if len(c.LogPath) == 0 {
+		return fmt.Errorf(InvalidStringParameterError, "log_path", "\"\"", "sweep log path cannot be empty")
+	}
+	if len(c.Parameters) == 0 {
+		return fmt.Errorf("sweep has no parameters")
+	}
+	for _, p := range c.Parameters {
+		err := p.Validate(strings.ToLower(c.Method))
+		if err != nil {
+			return err
+		}
+	}
+	c.validated = true
+	return nil
+}
+
+// sweepParameterConfig describes the values taken by a single
+// configuration field in a parameter sweep. Values are either listed
+// explicitly or spread evenly between min and max.
+type sweepParameterConfig struct {
+	Section   string        `toml:"section"`    // simulation, intrahost_model, transmission_model
+	ModelName string        `toml:"model_name"` // only for intrahost_model and transmission_model, all models if empty
+	Field     string        `toml:"field"`
+	Values    []interface{} `toml:"values"`
+	Min       float64       `toml:"min"`
+	Max       float64       `toml:"max"`
+	Steps     int           `toml:"steps"` // only for grid
+
+	validated bool
+}
+
+// Validate checks the validity of the sweep parameter given
+// the sweep method.
+func (c *sweepParameterConfig) Validate(method string) error {
+	err := checkKeyword(c.Section, "sweep section", "simulation", "intrahost_model", "transmission_model")
+	if err != nil {
+		return err
+	}
+	if len(c.Field) == 0 {
+		return fmt.Errorf(InvalidStringParameterError, "field", "\"\"", "field name cannot be empty")
+	}
+	if len(c.Values) == 0 {
+		if c.Min > c.Max {
+			return fmt.Errorf(InvalidFloatParameterError, "min", c.Min, "must be less than or equal to max")
+		}
+		if method == "grid" && c.Steps < 1 {
+			return fmt.Errorf(InvalidIntParameterError, "steps", c.Steps, "must be greater than or equal to 1")
+		}
+	}
+	c.validated = true
+	return nil
+}
+
+// Name returns the label used for the parameter in the sweep manifest.
+func (c *sweepParameterConfig) Name() string {
+	return fieldLabel(c.Section, c.ModelName, c.Field)
+}
+
+// levels returns the values of the parameter used in a grid sweep.
+func (c *sweepParameterConfig) levels() []interface{} {
+	if len(c.Values) > 0 {
+		return c.Values
+	}
+	if c.Steps == 1 {
+		return []interface{}{c.Min}
+	}
+	levels := make([]interface{}, c.Steps)
+	for i := range levels {
+		levels[i] = c.Min + (c.Max-c.Min)*float64(i)/float64(c.Steps-1)
+	}
+	return levels
+}
+
+// quantile returns the parameter value at u, where u is between 0 and 1.
+func (c *sweepParameterConfig) quantile(u float64) interface{} {
+	if len(c.Values) > 0 {
+		i := int(u * float64(len(c.Values)))
+		if i == len(c.Values) {
+			i--
+		}
+		return c.Values[i]
+	}
+	return c.Min + (c.Max-c.Min)*u
+}
+
+// SweepPoint is a single set of parameter values in a parameter sweep.
+type SweepPoint struct {
+	RunID   int
+	LogPath string
+	Values  []interface{}
+}
+
+// SweepParameterNames returns the labels of the swept parameters
+// in the order of the values in each SweepPoint.
+func (c *EvoEpiConfig) SweepParameterNames() []string {
+	if c.Sweep == nil {
+		return nil
+	}
+	names := make([]string, len(c.Sweep.Parameters))
+	for i, p := range c.Sweep.Parameters {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// SweepPoints expands the sweep section into the list of parameter sets
+// to run. The grid method returns the Cartesian product of the values of
+// each parameter, while the lhs method draws a Latin hypercube sample
+// using the given seed.
+func (c *EvoEpiConfig) SweepPoints(seed int64) ([]*SweepPoint, error) {
+	if c.Sweep == nil {
+		return nil, fmt.Errorf("configuration has no sweep section")
+	}
+	if !c.Sweep.validated {
+		err := c.Sweep.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	params := c.Sweep.Parameters
+	// Check that each swept field exists. Values drawn for integer fields
+	// are rounded so that the manifest records the values actually used.
+	integer := make([]bool, len(params))
+	for j, p := range params {
+		kind, err := c.fieldKind(p.Section, p.ModelName, p.Field)
+		if err != nil {
+			return nil, err
+		}
+		integer[j] = kind == reflect.Int
+	}
+	var valueSets [][]interface{}
+	switch strings.ToLower(c.Sweep.Method) {
+	case "grid":
+		valueSets = [][]interface{}{{}}
+		for _, p := range params {
+			var expanded [][]interface{}
+			for _, values := range valueSets {
+				for _, v := range p.levels() {
+					point := make([]interface{}, len(values), len(values)+1)
+					copy(point, values)
+					expanded = append(expanded, append(point, v))
+				}
+			}
+			valueSets = expanded
+		}
+	case "lhs":
+		n := c.Sweep.NumSamples
+		valueSets = make([][]interface{}, n)
+		for i := range valueSets {
+			valueSets[i] = make([]interface{}, len(params))
+		}
+		// Each parameter range is divided into n strata and each stratum
+		// is sampled exactly once.
+		for j, p := range params {
+			r := NewRand(DeriveSeed(seed, j))
+			strata := r.Perm(n)
+			for i := range valueSets {
+				u := (float64(strata[i]) + r.Float64()) / float64(n)
+				valueSets[i][j] = p.quantile(u)
+			}
+		}
+	}
+	points := make([]*SweepPoint, len(valueSets))
+	for i, values := range valueSets {
+		for j, v := range values {
+			if x, ok := v.(float64); ok && integer[j] {
+				values[j] = int64(math.Round(x))
+			}
+		}
+		runID := i + 1
+		points[i] = &SweepPoint{
+			RunID:   runID,
+			LogPath: filepath.Join(c.Sweep.LogPath, fmt.Sprintf("run%04d", runID)) + string(os.PathSeparator),
+			Values:  values,
+		}
+	}
+	return points, nil
+}
+
+// ApplySweepPoint sets the swept parameters of the configuration to the
+// values of the sweep point and directs logs to the point's log directory.
+// The log directory is created if it does not exist.
+func (c *EvoEpiConfig) ApplySweepPoint(point *SweepPoint) error {
+	if c.Sweep == nil {
+		return fmt.Errorf("configuration has no sweep section")
+	}
+	if len(point.Values) != len(c.Sweep.Parameters) {
+		return fmt.Errorf(UnequalIntParameterError, "number of sweep values", len(c.Sweep.Parameters), len(point.Values))
+	}
+	for i, p := range c.Sweep.Parameters {
+		err := c.SetField(p.Section, p.ModelName, p.Field, point.Values[i])
+		if err != nil {
+			return errors.Wrapf(err, "applying sweep run %d failed", point.RunID)
+		}
+	}
+	err := os.MkdirAll(point.LogPath, 0755)
+	if err != nil {
+		return errors.Wrap(FileWriteError(err), "creating sweep log directory failed")
+	}
+	c.LogParams.LogPath = point.LogPath
+	return nil
+}
+
+// SetField sets the value of a field in a section of the configuration.
+// The field is identified by its TOML key. For sections with multiple
+// models, the value is set in the model with the given name, or in all
+// models of the section if modelName is empty.
+func (c *EvoEpiConfig) SetField(section, modelName, field string, value interface{}) error {
+	targets, err := c.sectionValues(section, modelName)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		err := setTOMLField(target, field, value)
+		if err != nil {
+			return errors.Wrapf(err, "setting %s in %s failed", field, section)
+		}
+	}
+	return nil
+}
+
+// sectionValues returns the structs of the given configuration section
+// that match the model name. All models in the section are returned if
+// modelName is empty.
+func (c *EvoEpiConfig) sectionValues(section, modelName string) ([]reflect.Value, error) {
+	var targets []reflect.Value
+	switch strings.ToLower(section) {
+	case "simulation":
+		targets = append(targets, reflect.ValueOf(c.SimParams).Elem())
+	case "intrahost_model":
+		for _, m := range c.IntrahostModels {
+			if modelName == "" || m.ModelName == modelName {
+				targets = append(targets, reflect.ValueOf(m).Elem())
+			}
+		}
+	case "transmission_model":
+		for _, m := range c.TransmissionModels {
+			if modelName == "" || m.ModelName == modelName {
+				targets = append(targets, reflect.ValueOf(m).Elem())
+			}
+		}
+	default:
+		return nil, fmt.Errorf(UnrecognizedKeywordError, section, "configuration section")
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("model %s not found in %s", modelName, section)
+	}
+	return targets, nil
+}
+
+// fieldKind returns the type of a field in a section of the configuration.
+// Returns an error if the field does not exist.
+func (c *EvoEpiConfig) fieldKind(section, modelName, field string) (reflect.Kind, error) {
+	targets, err := c.sectionValues(section, modelName)
+	if err != nil {
+		return reflect.Invalid, err
+	}
+	f, exists := tomlField(targets[0], field)
+	if !exists {
+		return reflect.Invalid, fmt.Errorf("%s is not a valid field in %s", field, section)
+	}
+	return f.Kind(), nil
+}
+
+// fieldLabel returns the label of a configuration field used in
+// output files.
+func fieldLabel(section, modelName, field string) string {
+	if len(modelName) > 0 {
+		return fmt.Sprintf("%s.%s.%s", section, modelName, field)
+	}
+	return fmt.Sprintf("%s.%s", section, field)
+}
+
+// tomlField returns the struct field tagged with the given TOML key.
+func tomlField(v reflect.Value, key string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("toml") == key {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// setTOMLField sets the struct field tagged with the given TOML key.
+// Numeric values are converted to the type of the field. Floating point
+// values are rounded to the nearest integer when assigned to integer fields.
+func setTOMLField(v reflect.Value, key string, value interface{}) error {
+	f, exists := tomlField(v, key)
+	if !exists {
+		return fmt.Errorf("%s is not a valid field", key)
+	}
+	switch f.Kind() {
+	case reflect.Int:
+		switch x := value.(type) {
+		case int:
+			f.SetInt(int64(x))
+		case int64:
+			f.SetInt(x)
+		case float64:
+			f.SetInt(int64(math.Round(x)))
+		default:
+			return fmt.Errorf("cannot assign %v to integer field %s", value, key)
+		}
+	case reflect.Float64:
+		switch x := value.(type) {
+		case int:
+			f.SetFloat(float64(x))
+		case int64:
+			f.SetFloat(float64(x))
+		case float64:
+			f.SetFloat(x)
+		default:
+			return fmt.Errorf("cannot assign %v to float field %s", value, key)
+		}
+	case reflect.String:
+		x, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("cannot assign %v to string field %s", value, key)
+		}
+		f.SetString(x)
+	case reflect.Bool:
+		x, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("cannot assign %v to boolean field %s", value, key)
+		}
+		f.SetBool(x)
+	default:
+		return fmt.Errorf("field %s cannot be set", key)
+	}
+	return nil
+}
+
+// WriteSweepManifest writes a CSV file that maps each run ID of the sweep
+// to its log directory and parameter values.
+func WriteSweepManifest(path string, names []string, points []*SweepPoint) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(FileWriteError(err), "writing sweep manifest failed")
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "run,log_path,%s\n", strings.Join(names, ","))
+	for _, point := range points {
+		values := make([]string, len(point.Values))
+		for i, v := range point.Values {
+			values[i] = fmt.Sprintf("%v", v)
+		}
+		fmt.Fprintf(w, "%d,%s,%s\n", point.RunID, point.LogPath, strings.Join(values, ","))
+	}
+	err = w.Flush()
+	if err != nil {
+		return errors.Wrap(FileWriteError(err), "writing sweep manifest failed")
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package contagiongo
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestEvoEpiConfig_SweepPoints(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sweep")
+	if err != nil {
+		t.Fatalf(UnexpectedErrorWhileError, "creating temporary directory", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	conf := &EvoEpiConfig{
+		SimParams: &epidemicSimConfig{NumGenerations: 10},
+		LogParams: &logConfig{LogFreq: 1},
+		IntrahostModels: []*intrahostModelConfig{
+			{ModelName: "a", ConstantPopSize: 10},
+			{ModelName: "b", ConstantPopSize: 10},
+		},
+		Sweep: &sweepConfig{
+			Method:  "grid",
+			LogPath: tmpDir,
+			Parameters: []*sweepParameterConfig{
+				{Section: "simulation", Field: "num_generations", Values: []interface{}{int64(10), int64(20)}},
+				{Section: "intrahost_model", ModelName: "b", Field: "constant_pop_size", Min: 10, Max: 20, Steps: 3},
+			},
+		},
+	}
+	points, err := conf.SweepPoints(0)
+	if err != nil {
+		t.Fatalf(UnexpectedErrorWhileError, "expanding sweep", err)
+	}
+	if len(points) != 6 {
+		t.Fatalf(UnequalIntParameterError, "number of sweep points", 6, len(points))
+	}
+	// Last parameter varies the fastest
+	last := points[5]
+	if last.RunID != 6 || last.Values[0] != int64(20) || last.Values[1] != int64(20) {
+		t.Errorf("expected run 6 with values [20 20], got run %d with values %v instead", last.RunID, last.Values)
+	}
+	err = conf.ApplySweepPoint(points[4])
+	if err != nil {
+		t.Fatalf(UnexpectedErrorWhileError, "applying sweep point", err)
+	}
+	if conf.SimParams.NumGenerations != 20 {
+		t.Errorf(UnequalIntParameterError, "num_generations", 20, conf.SimParams.NumGenerations)
+	}
+	if size := conf.IntrahostModels[1].ConstantPopSize; size != 15 {
+		t.Errorf(UnequalIntParameterError, "constant_pop_size", 15, size)
+	}
+	if size := conf.IntrahostModels[0].ConstantPopSize; size != 10 {
+		t.Errorf(UnequalIntParameterError, "constant_pop_size of unswept model", 10, size)
+	}
+}
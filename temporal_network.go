@@ -0,0 +1,99 @@
+package contagiongo
+
+import "sort"
+
+// TemporalNetwork describes a host network whose connections change
+// over the course of the simulation.
+type TemporalNetwork interface {
+	// ChangeTimes returns the sorted list of generations where
+	// connections are added, removed or reweighted.
+	ChangeTimes() []int
+	// Network returns the connections present at generation t.
+	Network(t int) HostNetwork
+}
+
+// temporalEdge is a weighted connection that is only present from
+// generation start up to and including generation end. If end is negative,
+// the connection is present until the end of the simulation.
+type temporalEdge struct {
+	from, to   int
+	weight     float64
+	start, end int
+}
+
+func (e temporalEdge) activeAt(t int) bool {
+	return t >= e.start && (e.end < 0 || t <= e.end)
+}
+
+// temporalEdgeList is a TemporalNetwork described by a list of edges
+// that each have a start and end generation.
+type temporalEdgeList struct {
+	edges   []temporalEdge
+	changes []int
+}
+
+// newTemporalEdgeList creates a TemporalNetwork from edges with
+// start and end generations.
+func newTemporalEdgeList(edges []temporalEdge) *temporalEdgeList {
+	n := &temporalEdgeList{edges: edges}
+	changeSet := make(map[int]bool)
+	for _, e := range edges {
+		changeSet[e.start] = true
+		if e.end >= 0 {
+			changeSet[e.end+1] = true
+		}
+	}
+	for t := range changeSet {
+		n.changes = append(n.changes, t)
+	}
+	sort.Ints(n.changes)
+	return n
+}
+
+func (n *temporalEdgeList) ChangeTimes() []int {
+	return n.changes
+}
+
+func (n *temporalEdgeList) Network(t int) HostNetwork {
+	m := make(adjacencyMatrix)
+	for _, e := range n.edges {
+		if e.activeAt(t) {
+			m.UpsertConnectionWeight(e.from, e.to, e.weight)
+		}
+	}
+	return m
+}
+
+// networkSnapshots is a TemporalNetwork described by a series of networks
+// where each network replaces the previous one at a given generation.
+type networkSnapshots struct {
+	times    []int
+	networks []HostNetwork
+}
+
+// NewNetworkSnapshots creates a TemporalNetwork from a series of networks
+// keyed by the generation where each network starts. Before the earliest
+// generation, hosts are not connected.
+func NewNetworkSnapshots(snapshots map[int]HostNetwork) TemporalNetwork {
+	n := new(networkSnapshots)
+	for t := range snapshots {
+		n.times = append(n.times, t)
+	}
+	sort.Ints(n.times)
+	for _, t := range n.times {
+		n.networks = append(n.networks, snapshots[t])
+	}
+	return n
+}
+
+func (n *networkSnapshots) ChangeTimes() []int {
+	return n.times
+}
+
+func (n *networkSnapshots) Network(t int) HostNetwork {
+	i := sort.SearchInts(n.times, t+1) - 1
+	if i < 0 {
+		return EmptyAdjacencyMatrix()
+	}
+	return n.networks[i]
+}
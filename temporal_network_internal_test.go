@@ -0,0 +1,45 @@
+package contagiongo
+
+import "testing"
+
+func TestTemporalEdgeList_Network(t *testing.T) {
+	n := newTemporalEdgeList([]temporalEdge{
+		{from: 0, to: 1, weight: 1, start: 0, end: -1},
+		{from: 1, to: 2, weight: 0.5, start: 5, end: 9},
+	})
+	changes := n.ChangeTimes()
+	if len(changes) != 3 || changes[0] != 0 || changes[1] != 5 || changes[2] != 10 {
+		t.Errorf("expected change times %v, got %v instead", []int{0, 5, 10}, changes)
+	}
+	var tests = []struct {
+		t        int
+		a, b     int
+		expected float64
+	}{
+		{0, 0, 1, 1},
+		{4, 1, 2, 0},
+		{5, 1, 2, 0.5},
+		{9, 1, 2, 0.5},
+		{10, 1, 2, 0},
+		{100, 0, 1, 1},
+	}
+	for _, tt := range tests {
+		if w := n.Network(tt.t).Connection(tt.a, tt.b); w != tt.expected {
+			t.Errorf("expected weight %f for %d-%d at generation %d, got %f instead", tt.expected, tt.a, tt.b, tt.t, w)
+		}
+	}
+}
+
+func TestNetworkSnapshots_Network(t *testing.T) {
+	first := EmptyAdjacencyMatrix()
+	first.AddConnection(0, 1)
+	second := EmptyAdjacencyMatrix()
+	second.AddConnection(1, 2)
+	n := NewNetworkSnapshots(map[int]HostNetwork{10: second, 0: first})
+	if !n.Network(9).ConnectionExists(0, 1) {
+		t.Errorf("expected connection 0-1 at generation 9")
+	}
+	if n.Network(10).ConnectionExists(0, 1) || !n.Network(10).ConnectionExists(1, 2) {
+		t.Errorf("expected only connection 1-2 at generation 10")
+	}
+}
@@ -1,6 +1,10 @@
 package contagiongo
 
-import rv "github.com/kentwait/randomvariate"
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
 
 // TransmissionModel describes the transmission probability and number of
 // pathogens that transmits per event. The model may be constant or
@@ -14,11 +18,17 @@ type TransmissionModel interface {
 	SetModelName(name string)
 	// TransmissionProb returns the probability that a transmission event
 	// occurs between one host and one neighbor (per capita event) occurs.
-	TransmissionProb() float64
+	// The probability may depend on the number of pathogens in the source
+	// host (load) and the number of generations since the source host
+	// was infected (age).
+	TransmissionProb(load, age int) float64
+	// SetTransmissionProb replaces the baseline transmission probability
+	// of the model.
+	SetTransmissionProb(prob float64)
 
 	// TransmissionSize returns the number of pathogens transmitted given
-	// a transmission event occurs.
-	TransmissionSize() int
+	// a transmission event occurs. Random draws use the given generator.
+	TransmissionSize(r *rand.Rand) int
 }
 
 type poissonTransmitter struct {
@@ -27,12 +37,16 @@ type poissonTransmitter struct {
 	size float64
 }
 
-func (s *poissonTransmitter) TransmissionProb() float64 {
+func (s *poissonTransmitter) TransmissionProb(load, age int) float64 {
 	return s.prob
 }
 
-func (s *poissonTransmitter) TransmissionSize() int {
-	return rv.Poisson(s.size)
+func (s *poissonTransmitter) SetTransmissionProb(prob float64) {
+	s.prob = prob
+}
+
+func (s *poissonTransmitter) TransmissionSize(r *rand.Rand) int {
+	return poisson(r, s.size)
 }
 
 type constantTransmitter struct {
@@ -41,10 +55,239 @@ type constantTransmitter struct {
 	size int
 }
 
-func (s *constantTransmitter) TransmissionProb() float64 {
+func (s *constantTransmitter) TransmissionProb(load, age int) float64 {
 	return s.prob
 }
 
-func (s *constantTransmitter) TransmissionSize() int {
+func (s *constantTransmitter) SetTransmissionProb(prob float64) {
+	s.prob = prob
+}
+
+func (s *constantTransmitter) TransmissionSize(r *rand.Rand) int {
 	return s.size
 }
+
+// transmissionScaler is implemented by transmission models whose
+// probability is transmission_prob multiplied by a factor that depends on
+// the load or infection age of the source host.
+type transmissionScaler interface {
+	scale(load, age int) float64
+}
+
+// connectionTransmissionProb returns the transmission probability along
+// a connection with the given weight. A positive weight replaces the
+// transmission probability of the model. If the probability of the model
+// depends on the load or infection age of the source host, the weight is
+// scaled in the same way.
+func connectionTransmissionProb(model TransmissionModel, weight float64, load, age int) float64 {
+	if weight <= 0 {
+		return model.TransmissionProb(load, age)
+	}
+	if s, ok := model.(transmissionScaler); ok {
+		return weight * s.scale(load, age)
+	}
+	return weight
+}
+
+// negBinomialTransmitter draws transmission sizes from a negative binomial
+// distribution to model superspreading. Smaller dispersion values give
+// more variable transmission sizes.
+type negBinomialTransmitter struct {
+	modelMetadata
+	prob       float64
+	size       float64
+	dispersion float64
+}
+
+func (s *negBinomialTransmitter) TransmissionProb(load, age int) float64 {
+	return s.prob
+}
+
+func (s *negBinomialTransmitter) SetTransmissionProb(prob float64) {
+	s.prob = prob
+}
+
+func (s *negBinomialTransmitter) TransmissionSize(r *rand.Rand) int {
+	return negativeBinomial(r, s.size, s.dispersion)
+}
+
+// geometricTransmitter draws transmission sizes from a geometric
+// distribution with the given mean.
+type geometricTransmitter struct {
+	modelMetadata
+	prob float64
+	size float64
+}
+
+func (s *geometricTransmitter) TransmissionProb(load, age int) float64 {
+	return s.prob
+}
+
+func (s *geometricTransmitter) SetTransmissionProb(prob float64) {
+	s.prob = prob
+}
+
+func (s *geometricTransmitter) TransmissionSize(r *rand.Rand) int {
+	return geometric(r, s.size)
+}
+
+// betaBinomialTransmitter draws transmission sizes from a beta-binomial
+// distribution with a maximum of trials pathogens.
+type betaBinomialTransmitter struct {
+	modelMetadata
+	prob   float64
+	trials int
+	alpha  float64
+	beta   float64
+}
+
+func (s *betaBinomialTransmitter) TransmissionProb(load, age int) float64 {
+	return s.prob
+}
+
+func (s *betaBinomialTransmitter) SetTransmissionProb(prob float64) {
+	s.prob = prob
+}
+
+func (s *betaBinomialTransmitter) TransmissionSize(r *rand.Rand) int {
+	return betaBinomial(r, s.trials, s.alpha, s.beta)
+}
+
+// loadTransmitter increases the transmission probability with the number
+// of pathogens in the source host. The probability reaches half of prob
+// when the source host has halfLoad pathogens. Transmission sizes are
+// drawn from the embedded model.
+type loadTransmitter struct {
+	TransmissionModel
+	prob     float64
+	halfLoad float64
+}
+
+func (s *loadTransmitter) TransmissionProb(load, age int) float64 {
+	return s.prob * s.scale(load, age)
+}
+
+func (s *loadTransmitter) SetTransmissionProb(prob float64) {
+	s.prob = prob
+}
+
+func (s *loadTransmitter) scale(load, age int) float64 {
+	if load <= 0 {
+		return 0
+	}
+	return float64(load) / (float64(load) + s.halfLoad)
+}
+
+// ageTransmitter changes the transmission probability with the number of
+// generations since the source host was infected. The probability at age a
+// is prob multiplied by the a-th value of the profile. Ages beyond the end
+// of the profile use the last value. Transmission sizes are drawn from
+// the embedded model.
+type ageTransmitter struct {
+	TransmissionModel
+	prob    float64
+	profile []float64
+}
+
+func (s *ageTransmitter) TransmissionProb(load, age int) float64 {
+	return s.prob * s.scale(load, age)
+}
+
+func (s *ageTransmitter) SetTransmissionProb(prob float64) {
+	s.prob = prob
+}
+
+func (s *ageTransmitter) scale(load, age int) float64 {
+	if age < 0 {
+		age = 0
+	}
+	if age >= len(s.profile) {
+		age = len(s.profile) - 1
+	}
+	return s.profile[age]
+}
+
+// fitnessTransmitter weights the pathogens sampled into the transmission
+// bottleneck by their transmission fitness, and scales the transmission
+// probability by the mean transmission fitness of the source host's
+// pathogens. The transmission probability and size are otherwise
+// determined by the embedded model.
+type fitnessTransmitter struct {
+	TransmissionModel
+	fitness FitnessMatrix
+}
+
+func (s *fitnessTransmitter) scale(load, age int) float64 {
+	if scaler, ok := s.TransmissionModel.(transmissionScaler); ok {
+		return scaler.scale(load, age)
+	}
+	return 1
+}
+
+// transmissionWeights returns the transmission fitness in decimal form of
+// each pathogen if the model has a transmission fitness matrix.
+// Returns nil otherwise.
+func transmissionWeights(model TransmissionModel, pathogens []GenotypeNode) []float64 {
+	ft, ok := model.(*fitnessTransmitter)
+	if !ok {
+		return nil
+	}
+	weights := make([]float64, len(pathogens))
+	for i, p := range pathogens {
+		fitness, err := ft.fitness.ComputeFitness(p.Sequence()...)
+		if err != nil {
+			// Sequences not covered by the matrix are neutral
+			weights[i] = 1
+			continue
+		}
+		if ft.fitness.Log() {
+			fitness = math.Exp(fitness)
+		}
+		if fitness > 0 {
+			weights[i] = fitness
+		}
+	}
+	return weights
+}
+
+// pickWeightedPathogens picks up to n pathogens without replacement where
+// the chance of picking each pathogen is proportional to its weight.
+// Pathogens with a weight of 0 are never picked.
+func pickWeightedPathogens(r *rand.Rand, pathogens []GenotypeNode, weights []float64, n int) []GenotypeNode {
+	// Weighted random sampling using exponential keys
+	// (Efraimidis and Spirakis, 2006)
+	type keyedIndex struct {
+		key float64
+		i   int
+	}
+	keys := make([]keyedIndex, 0, len(pathogens))
+	for i, w := range weights {
+		u := r.Float64()
+		if w > 0 {
+			keys = append(keys, keyedIndex{math.Log(1-u) / w, i})
+		}
+	}
+	sort.SliceStable(keys, func(a, b int) bool {
+		return keys[a].key > keys[b].key
+	})
+	if n > len(keys) {
+		n = len(keys)
+	}
+	picked := make([]GenotypeNode, n)
+	for j := 0; j < n; j++ {
+		picked[j] = pathogens[keys[j].i]
+	}
+	return picked
+}
+
+// meanWeight returns the mean of the weights.
+func meanWeight(weights []float64) float64 {
+	if len(weights) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, w := range weights {
+		sum += w
+	}
+	return sum / float64(len(weights))
+}
@@ -0,0 +1,56 @@
+package contagiongo
+
+import "testing"
+
+func TestTransmissionModel_TransmissionProb(t *testing.T) {
+	size := &constantTransmitter{prob: 0.5, size: 1}
+	load := &loadTransmitter{TransmissionModel: size, prob: 0.8, halfLoad: 10}
+	age := &ageTransmitter{TransmissionModel: size, prob: 0.5, profile: []float64{0, 1, 0.5}}
+	var tests = []struct {
+		model     TransmissionModel
+		load, age int
+		expected  float64
+	}{
+		{size, 100, 5, 0.5},
+		{load, 0, 0, 0},
+		{load, 10, 0, 0.4},
+		{age, 1, 0, 0},
+		{age, 1, 1, 0.5},
+		{age, 1, 10, 0.25},
+	}
+	for _, tt := range tests {
+		if p := tt.model.TransmissionProb(tt.load, tt.age); p != tt.expected {
+			t.Errorf(UnequalFloatParameterError, "transmission probability", tt.expected, p)
+		}
+	}
+	if p := connectionTransmissionProb(size, 0.9, 10, 1); p != 0.9 {
+		t.Errorf(UnequalFloatParameterError, "connection transmission probability", 0.9, p)
+	}
+	if p := connectionTransmissionProb(age, 0.9, 10, 2); p != 0.45 {
+		t.Errorf(UnequalFloatParameterError, "scaled connection transmission probability", 0.45, p)
+	}
+}
+
+func TestPickWeightedPathogens(t *testing.T) {
+	r := NewRand(0)
+	tree := EmptyGenotypeTree()
+	var pathogens []GenotypeNode
+	for i := 0; i < 3; i++ {
+		pathogens = append(pathogens, tree.NewNode(newNodeUID(r), []uint8{uint8(i)}, 0))
+	}
+	weights := []float64{0, 1, 9}
+	counts := make(map[int]int)
+	for i := 0; i < 1000; i++ {
+		picked := pickWeightedPathogens(r, pathogens, weights, 1)
+		counts[int(picked[0].Sequence()[0])]++
+	}
+	if counts[0] > 0 {
+		t.Errorf("expected pathogen with weight 0 to never be picked, got %d picks", counts[0])
+	}
+	if counts[2] < 850 || counts[2] > 950 {
+		t.Errorf("expected about 900 picks of pathogen with weight 9, got %d instead", counts[2])
+	}
+	if picked := pickWeightedPathogens(r, pathogens, weights, 3); len(picked) != 2 {
+		t.Errorf(UnequalIntParameterError, "number of picked pathogens", 2, len(picked))
+	}
+}